@@ -0,0 +1,29 @@
+package llm
+
+import (
+	"context"
+	"time"
+)
+
+// BatchStatus is the normalized processing state of a provider batch job.
+type BatchStatus string
+
+const (
+	BatchStatusInProgress BatchStatus = "in_progress"
+	BatchStatusCompleted  BatchStatus = "completed"
+	BatchStatusFailed     BatchStatus = "failed"
+	BatchStatusCancelled  BatchStatus = "cancelled"
+)
+
+// Batch describes a bulk job submitted to a provider's batch API.
+type Batch struct {
+	ID        string      `json:"id"`
+	Status    BatchStatus `json:"status"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// BatchManager is implemented by providers that support managing batch jobs.
+type BatchManager interface {
+	ListBatches(ctx context.Context) ([]Batch, error)
+	CancelBatch(ctx context.Context, id string) (Batch, error)
+}
@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/liushuangls/go-anthropic/v2"
+)
+
+// batchServer answers list requests with two pages and cancel requests with a
+// cancelled batch, in the format of the given provider
+func batchServer(t *testing.T, provider LLMProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch provider {
+		case ClaudeProvider:
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/messages/batches" && r.URL.Query().Get("after_id") == "":
+				fmt.Fprint(w, `{"data":[
+					{"id":"b1","processing_status":"in_progress","created_at":"2024-01-01T00:00:00Z"},
+					{"id":"b2","processing_status":"ended","request_counts":{"succeeded":3},"created_at":"2024-01-01T00:00:00Z"}
+				],"has_more":true,"last_id":"b2"}`)
+			case r.Method == http.MethodGet && r.URL.Path == "/messages/batches" && r.URL.Query().Get("after_id") == "b2":
+				fmt.Fprint(w, `{"data":[
+					{"id":"b3","processing_status":"ended","request_counts":{"errored":2},"created_at":"2024-01-01T00:00:00Z"}
+				],"has_more":false,"last_id":"b3"}`)
+			case r.Method == http.MethodPost && r.URL.Path == "/messages/batches/b1/cancel":
+				fmt.Fprint(w, `{"id":"b1","processing_status":"canceling","created_at":"2024-01-01T00:00:00Z"}`)
+			default:
+				t.Errorf("unexpected request %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case OpenAIProvider:
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v1/batches" && r.URL.Query().Get("after") == "":
+				fmt.Fprint(w, `{"object":"list","data":[
+					{"id":"b1","status":"in_progress","created_at":1704067200},
+					{"id":"b2","status":"completed","created_at":1704067200}
+				],"has_more":true,"last_id":"b2"}`)
+			case r.Method == http.MethodGet && r.URL.Path == "/v1/batches" && r.URL.Query().Get("after") == "b2":
+				fmt.Fprint(w, `{"object":"list","data":[
+					{"id":"b3","status":"failed","created_at":1704067200}
+				],"has_more":false,"last_id":"b3"}`)
+			case r.Method == http.MethodPost && r.URL.Path == "/v1/batches/b1/cancel":
+				fmt.Fprint(w, `{"id":"b1","status":"cancelling","created_at":1704067200}`)
+			default:
+				t.Errorf("unexpected request %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}
+	}
+}
+
+func TestBatchManager(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		provider LLMProvider
+		manager  func(t *testing.T) BatchManager
+	}{
+		{
+			provider: ClaudeProvider,
+			manager:  func(t *testing.T) BatchManager { return newTestClaudeLLM(t, batchServer(t, ClaudeProvider)) },
+		},
+		{
+			provider: OpenAIProvider,
+			manager:  func(t *testing.T) BatchManager { return newTestOpenAILLM(t, batchServer(t, OpenAIProvider)) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.provider), func(t *testing.T) {
+			m := tt.manager(t)
+
+			batches, err := m.ListBatches(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []Batch{
+				{ID: "b1", Status: BatchStatusInProgress, CreatedAt: created},
+				{ID: "b2", Status: BatchStatusCompleted, CreatedAt: created},
+				{ID: "b3", Status: BatchStatusFailed, CreatedAt: created},
+			}
+			if len(batches) != len(want) {
+				t.Fatalf("got %d batches, want %d", len(batches), len(want))
+			}
+			for i := range want {
+				if batches[i].ID != want[i].ID || batches[i].Status != want[i].Status || !batches[i].CreatedAt.Equal(want[i].CreatedAt) {
+					t.Errorf("batch %d = %+v, want %+v", i, batches[i], want[i])
+				}
+			}
+
+			cancelled, err := m.CancelBatch(context.Background(), "b1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cancelled.ID != "b1" || cancelled.Status != BatchStatusCancelled {
+				t.Errorf("cancelled batch = %+v, want b1 %s", cancelled, BatchStatusCancelled)
+			}
+		})
+	}
+}
+
+func TestConvertFromClaudeBatchStatus(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		batch anthropic.BatchRespCore
+		want  BatchStatus
+	}{
+		{"in progress", anthropic.BatchRespCore{ProcessingStatus: anthropic.ProcessingStatusInProgress}, BatchStatusInProgress},
+		{"canceling", anthropic.BatchRespCore{ProcessingStatus: anthropic.ProcessingStatusCanceling}, BatchStatusCancelled},
+		{"ended after cancel", anthropic.BatchRespCore{ProcessingStatus: anthropic.ProcessingStatusEnded, CancelInitiatedAt: &now}, BatchStatusCancelled},
+		{"ended with successes", anthropic.BatchRespCore{ProcessingStatus: anthropic.ProcessingStatusEnded, RequestCounts: anthropic.RequestCounts{Succeeded: 1, Errored: 1}}, BatchStatusCompleted},
+		{"ended with errors only", anthropic.BatchRespCore{ProcessingStatus: anthropic.ProcessingStatusEnded, RequestCounts: anthropic.RequestCounts{Errored: 1}}, BatchStatusFailed},
+		{"ended with expired only", anthropic.BatchRespCore{ProcessingStatus: anthropic.ProcessingStatusEnded, RequestCounts: anthropic.RequestCounts{Expired: 2}}, BatchStatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := convertFromClaudeBatchStatus(tt.batch); got != tt.want {
+				t.Errorf("status = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertFromOpenAIBatchStatus(t *testing.T) {
+	want := map[string]BatchStatus{
+		"validating":  BatchStatusInProgress,
+		"in_progress": BatchStatusInProgress,
+		"finalizing":  BatchStatusInProgress,
+		"completed":   BatchStatusCompleted,
+		"failed":      BatchStatusFailed,
+		"expired":     BatchStatusFailed,
+		"cancelling":  BatchStatusCancelled,
+		"cancelled":   BatchStatusCancelled,
+	}
+	got := make(map[string]BatchStatus, len(want))
+	for status := range want {
+		got[status] = convertFromOpenAIBatchStatus(status)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BenchResult aggregates the outcome of a Benchmark run.
+type BenchResult struct {
+	// Total is the number of completions attempted.
+	Total int
+	// Errors is the number of completions that failed.
+	Errors int
+	// ErrorRate is Errors divided by Total.
+	ErrorRate float64
+	// Duration is the wall time of the whole run.
+	Duration time.Duration
+	// Throughput is the number of successful completions per second.
+	Throughput float64
+	// P50, P90 and P99 are latency percentiles of the successful completions.
+	P50, P90, P99 time.Duration
+	// PromptTokensPerSecond and CompletionTokensPerSecond are the token rates over the run.
+	PromptTokensPerSecond     float64
+	CompletionTokensPerSecond float64
+}
+
+// Benchmark sends total copies of req to llm with at most concurrency
+// requests in flight and reports latency percentiles, throughput, error rate
+// and token rates. Failed completions are counted but do not stop the run.
+func Benchmark(ctx context.Context, llm LLM, req ChatCompletionRequest, concurrency, total int) (BenchResult, error) {
+	if concurrency < 1 {
+		return BenchResult{}, fmt.Errorf("concurrency must be at least 1, got %d", concurrency)
+	}
+	if total < 1 {
+		return BenchResult{}, fmt.Errorf("total must be at least 1, got %d", total)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var latencies []time.Duration
+	var usage Usage
+	failures := 0
+
+	jobs := make(chan struct{})
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				callStart := time.Now()
+				resp, err := llm.CreateChatCompletion(ctx, req.Clone())
+				latency := time.Since(callStart)
+
+				mu.Lock()
+				if err != nil {
+					failures++
+				} else {
+					latencies = append(latencies, latency)
+					usage.PromptTokens += resp.Usage.PromptTokens
+					usage.CompletionTokens += resp.Usage.CompletionTokens
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < total; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	wg.Wait()
+	duration := time.Since(start)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	seconds := duration.Seconds()
+	return BenchResult{
+		Total:                     total,
+		Errors:                    failures,
+		ErrorRate:                 float64(failures) / float64(total),
+		Duration:                  duration,
+		Throughput:                float64(len(latencies)) / seconds,
+		P50:                       percentile(latencies, 0.50),
+		P90:                       percentile(latencies, 0.90),
+		P99:                       percentile(latencies, 0.99),
+		PromptTokensPerSecond:     float64(usage.PromptTokens) / seconds,
+		CompletionTokensPerSecond: float64(usage.CompletionTokens) / seconds,
+	}, nil
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
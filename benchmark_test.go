@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBenchmark(t *testing.T) {
+	var calls, running, peak atomic.Int32
+	mock := &stubLLM{complete: func(context.Context, ChatCompletionRequest) (ChatCompletionResponse, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if calls.Add(1)%4 == 0 {
+			return ChatCompletionResponse{}, errors.New("overloaded")
+		}
+		return ChatCompletionResponse{Usage: Usage{PromptTokens: 10, CompletionTokens: 3}}, nil
+	}}
+
+	result, err := Benchmark(context.Background(), mock, testRequest(ModelGPT4o, "hi"), 3, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Total != 20 || result.Errors != 5 || result.ErrorRate != 0.25 {
+		t.Errorf("got total %d, errors %d, error rate %v, want 20, 5, 0.25", result.Total, result.Errors, result.ErrorRate)
+	}
+	if got := peak.Load(); got > 3 {
+		t.Errorf("%d completions ran at once, want at most 3", got)
+	}
+	if result.P50 < 5*time.Millisecond || result.P50 > result.P90 || result.P90 > result.P99 {
+		t.Errorf("got percentiles %v, %v, %v", result.P50, result.P90, result.P99)
+	}
+
+	// the rates are the totals of the 15 successful completions over the run
+	seconds := result.Duration.Seconds()
+	rates := []struct {
+		name      string
+		got, want float64
+	}{
+		{"completions", result.Throughput * seconds, 15},
+		{"prompt tokens", result.PromptTokensPerSecond * seconds, 150},
+		{"completion tokens", result.CompletionTokensPerSecond * seconds, 45},
+	}
+	for _, r := range rates {
+		if math.Abs(r.got-r.want) > 1e-6 {
+			t.Errorf("%s over the run = %v, want %v", r.name, r.got, r.want)
+		}
+	}
+}
+
+func TestBenchmarkInvalidArguments(t *testing.T) {
+	for _, args := range [][2]int{{0, 10}, {1, 0}} {
+		if _, err := Benchmark(context.Background(), answerLLM("ok"), testRequest(ModelGPT4o, "hi"), args[0], args[1]); err == nil {
+			t.Errorf("Benchmark with concurrency %d and total %d succeeded", args[0], args[1])
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0.50, 5 * time.Millisecond},
+		{0.90, 9 * time.Millisecond},
+		{0.99, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("percentile of no latencies = %v, want 0", got)
+	}
+}
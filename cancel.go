@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"context"
+	"sync"
+)
+
+// CancellableLLM wraps an LLM and cancels all of its in-flight requests and
+// streams at once, e.g. when a server shuts down.
+type CancellableLLM struct {
+	llm LLM
+
+	mu      sync.Mutex
+	nextID  int
+	cancels map[int]context.CancelFunc
+}
+
+// WithCancelAll wraps llm so that CancelAll can cancel every request and
+// stream created through the returned client.
+func WithCancelAll(llm LLM) *CancellableLLM {
+	return &CancellableLLM{llm: llm, cancels: make(map[int]context.CancelFunc)}
+}
+
+// CancelAll cancels all requests and streams in flight. Streams fail with a
+// context error on their next Recv. Later requests are not affected.
+func (c *CancellableLLM) CancelAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, cancel := range c.cancels {
+		cancel()
+		delete(c.cancels, id)
+	}
+}
+
+// track derives a context that CancelAll cancels and returns the function
+// that releases it
+func (c *CancellableLLM) track(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.mu.Lock()
+	id := c.nextID
+	c.nextID++
+	c.cancels[id] = cancel
+	c.mu.Unlock()
+
+	return ctx, func() {
+		c.mu.Lock()
+		delete(c.cancels, id)
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+func (c *CancellableLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	ctx, release := c.track(ctx)
+	defer release()
+	return c.llm.CreateChatCompletion(ctx, req)
+}
+
+func (c *CancellableLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	ctx, release := c.track(ctx)
+	stream, err := c.llm.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &cancellableStream{ChatCompletionStream: stream, release: release}, nil
+}
+
+// cancellableStream releases its context when it is closed
+type cancellableStream struct {
+	ChatCompletionStream
+	release func()
+}
+
+func (s *cancellableStream) Close() error {
+	err := s.ChatCompletionStream.Close()
+	s.release()
+	return err
+}
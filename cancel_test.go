@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startedHandler signals started on the first token of a stream
+type startedHandler struct {
+	recordingHandler
+	once    sync.Once
+	started chan struct{}
+}
+
+func (h *startedHandler) OnToken(token string) {
+	h.once.Do(func() { close(h.started) })
+}
+
+func TestCancelAllStopsStreams(t *testing.T) {
+	backend := &endlessLLM{chunk: textChunk("token ", "")}
+	llm := WithCancelAll(backend)
+
+	const streams = 5
+	handlers := make([]*startedHandler, streams)
+	errs := make([]error, streams)
+	var wg sync.WaitGroup
+	for i := range handlers {
+		handlers[i] = &startedHandler{started: make(chan struct{})}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = StreamChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"), handlers[i], llm)
+		}(i)
+	}
+	for i, h := range handlers {
+		select {
+		case <-h.started:
+		case <-time.After(time.Second):
+			t.Fatalf("stream %d did not start", i)
+		}
+	}
+
+	llm.CancelAll()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the streams did not stop after CancelAll")
+	}
+	for i, err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("stream %d ended with %v, want it cancelled", i, err)
+		}
+	}
+
+	llm.mu.Lock()
+	tracked := len(llm.cancels)
+	llm.mu.Unlock()
+	if tracked != 0 {
+		t.Errorf("%d streams are still tracked after they were closed", tracked)
+	}
+
+	// later streams are not affected
+	stream, err := llm.CreateChatCompletionStream(context.Background(), testRequest(ModelGPT4o, "hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if _, err := stream.Recv(); err != nil {
+		t.Errorf("a stream created after CancelAll failed: %v", err)
+	}
+}
+
+func TestCancelAllStopsRequests(t *testing.T) {
+	backend := &blockingLLM{release: make(chan struct{})}
+	llm := WithCancelAll(backend)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := llm.CreateChatCompletion(context.Background(), dedupRequest())
+		errc <- err
+	}()
+	waitForCall(t, backend)
+	llm.CancelAll()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v, want the request cancelled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the request did not stop after CancelAll")
+	}
+}
@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// Citation references the part of a document that supports a part of the
+// response, see ContentPart.Citations.
+type Citation struct {
+	// Type is char_location, page_location or content_block_location and
+	// selects whether Start and End count characters, pages or content blocks.
+	Type string `json:"type"`
+	// Text is the response text the citation supports.
+	Text      string `json:"text"`
+	CitedText string `json:"cited_text"`
+	// DocumentIndex is the position of the cited document among the documents of the request.
+	DocumentIndex int    `json:"document_index"`
+	DocumentTitle string `json:"document_title,omitempty"`
+	// Start and End locate CitedText in the document, End is exclusive.
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// The Anthropic SDK has no fields for citations, so they are enabled on the
+// document blocks of the request body and parsed from the response body by
+// claudeCitationsTransport.
+
+type citationsKey struct{}
+
+// citationsSlot holds the documents of a request to cite and receives the body
+// of the response
+type citationsSlot struct {
+	// documents holds the base64 data of the documents with citations enabled
+	documents map[string]bool
+	body      []byte
+}
+
+// withClaudeCitations returns a context that enables citations for the
+// documents of req with Citations set, and the slot receiving the response,
+// which is nil if no document is cited
+func withClaudeCitations(ctx context.Context, req ChatCompletionRequest) (context.Context, *citationsSlot) {
+	documents := make(map[string]bool)
+	for _, msg := range req.Messages {
+		for _, part := range msg.MultiContent {
+			if part.Type == ContentTypeDocument && part.Citations {
+				documents[part.Data] = true
+			}
+		}
+	}
+	if len(documents) == 0 {
+		return ctx, nil
+	}
+	slot := &citationsSlot{documents: documents}
+	return context.WithValue(ctx, citationsKey{}, slot), slot
+}
+
+// citations returns the citations of the text blocks of the captured response
+func (s *citationsSlot) citations() []Citation {
+	if s == nil {
+		return nil
+	}
+	var resp struct {
+		Content []struct {
+			Type      string `json:"type"`
+			Text      string `json:"text"`
+			Citations []struct {
+				Type            string `json:"type"`
+				CitedText       string `json:"cited_text"`
+				DocumentIndex   int    `json:"document_index"`
+				DocumentTitle   string `json:"document_title"`
+				StartCharIndex  int    `json:"start_char_index"`
+				EndCharIndex    int    `json:"end_char_index"`
+				StartPageNumber int    `json:"start_page_number"`
+				EndPageNumber   int    `json:"end_page_number"`
+				StartBlockIndex int    `json:"start_block_index"`
+				EndBlockIndex   int    `json:"end_block_index"`
+			} `json:"citations"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(s.body, &resp); err != nil {
+		return nil
+	}
+
+	var citations []Citation
+	for _, block := range resp.Content {
+		for _, c := range block.Citations {
+			citation := Citation{
+				Type:          c.Type,
+				Text:          block.Text,
+				CitedText:     c.CitedText,
+				DocumentIndex: c.DocumentIndex,
+				DocumentTitle: c.DocumentTitle,
+			}
+			switch c.Type {
+			case "char_location":
+				citation.Start, citation.End = c.StartCharIndex, c.EndCharIndex
+			case "page_location":
+				citation.Start, citation.End = c.StartPageNumber, c.EndPageNumber
+			case "content_block_location":
+				citation.Start, citation.End = c.StartBlockIndex, c.EndBlockIndex
+			}
+			citations = append(citations, citation)
+		}
+	}
+	return citations
+}
+
+// withClaudeCitationsTransport returns a copy of client, or of a default
+// client if nil, that enables citations for requests with a citationsSlot
+func withClaudeCitationsTransport(client *http.Client) *http.Client {
+	c := &http.Client{}
+	if client != nil {
+		*c = *client
+	}
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = &claudeCitationsTransport{base: base}
+	return c
+}
+
+// claudeCitationsTransport enables citations on the cited document blocks of
+// a request body and stores the response body in the request's citationsSlot
+type claudeCitationsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *claudeCitationsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	slot, ok := req.Context().Value(citationsKey{}).(*citationsSlot)
+	if !ok || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	body, err = enableClaudeCitations(body, slot.documents)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	slot.body = respBody
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+// enableClaudeCitations sets citations.enabled on the document blocks of a
+// messages request body whose data is one of documents
+func enableClaudeCitations(body []byte, documents map[string]bool) ([]byte, error) {
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	// numbers are kept as they are, e.g. in tool call inputs
+	dec := json.NewDecoder(bytes.NewReader(req["messages"]))
+	dec.UseNumber()
+	var messages []map[string]any
+	if err := dec.Decode(&messages); err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		content, _ := msg["content"].([]any)
+		for _, b := range content {
+			block, _ := b.(map[string]any)
+			source, _ := block["source"].(map[string]any)
+			if data, _ := source["data"].(string); block["type"] == "document" && documents[data] {
+				block["citations"] = map[string]bool{"enabled": true}
+			}
+		}
+	}
+
+	encoded, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+	req["messages"] = encoded
+	return json.Marshal(req)
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/liushuangls/go-anthropic/v2"
 	"golang.org/x/oauth2/google"
@@ -15,7 +16,11 @@ import (
 
 // ClaudeLLM implements the LLM interface for Anthropic's Claude
 type ClaudeLLM struct {
-	client *anthropic.Client
+	client           *anthropic.Client
+	betaVersions     []BetaVersion
+	coalesceMessages bool
+	timeout          time.Duration
+	conversion       conversionConfig
 }
 
 type BetaVersion string
@@ -29,30 +34,58 @@ const (
 	BetaMaxTokens35_2024_07_15   BetaVersion = "max-tokens-3-5-sonnet-2024-07-15"
 )
 
-type ClientOption func(*ClaudeLLM)
+// defaultBetaVersions are the beta versions activated unless WithBetaVersions is used
+var defaultBetaVersions = []BetaVersion{BetaTools2024_04_04, BetaTools2024_05_16, BetaPromptCaching2024_07_31, BetaMessageBatches2024_09_24, BetaTokenCounting2024_11_01, BetaMaxTokens35_2024_07_15}
+
+// WithBetaVersions sets the Anthropic beta versions activated for a Claude
+// client instead of the default of all BetaVersion constants.
+func WithBetaVersions(versions ...BetaVersion) ClientOption {
+	return func(c *clientConfig) {
+		c.betaVersions = append([]BetaVersion{}, versions...)
+	}
+}
+
+// claudeBetaVersions returns the beta versions configured for a Claude client
+func (c *clientConfig) claudeBetaVersions() []BetaVersion {
+	if c.betaVersions == nil {
+		return defaultBetaVersions
+	}
+	return c.betaVersions
+}
+
+// WithMessageCoalescing merges consecutive messages that Claude would receive
+// with the same role into one, as Claude rejects roles that do not alternate.
+// This happens e.g. for histories with a user message following a tool result.
+func WithMessageCoalescing() ClientOption {
+	return func(c *clientConfig) {
+		c.coalesceMessages = true
+	}
+}
 
 // NewAnthropicLLM creates a new Claude LLM client (via Anthropic API)
-func NewAnthropicLLM(apiKey string) *ClaudeLLM {
+func NewAnthropicLLM(apiKey string, clientOpts ...ClientOption) *ClaudeLLM {
+	cfg := newClientConfig(clientOpts)
 
-	// activate all beta versions by default
-	opts := []BetaVersion{BetaTools2024_04_04, BetaTools2024_05_16, BetaPromptCaching2024_07_31, BetaMessageBatches2024_09_24, BetaTokenCounting2024_11_01, BetaMaxTokens35_2024_07_15}
+	opts := cfg.claudeBetaVersions()
 
 	anthropicOpts := make([]anthropic.ClientOption, len(opts))
 	for i, opt := range opts {
 		anthropicOpts[i] = anthropic.WithBetaVersion(anthropic.BetaVersion(opt))
 	}
 
+	anthropicOpts = append(anthropicOpts, anthropic.WithHTTPClient(withClaudeCitationsTransport(cfg.httpClient())))
+
 	client := anthropic.NewClient(apiKey, anthropicOpts...)
 
-	return &ClaudeLLM{client: client}
+	return &ClaudeLLM{client: client, betaVersions: opts, coalesceMessages: cfg.coalesceMessages, timeout: cfg.timeout, conversion: cfg.conversion}
 
 }
 
 // NewVertexLLM creates a new Claude LLM client (via Vertex AI custom integration)
-func NewVertexLLM(credBytes []byte, projectID string, location string) *ClaudeLLM {
+func NewVertexLLM(credBytes []byte, projectID string, location string, clientOpts ...ClientOption) *ClaudeLLM {
+	cfg := newClientConfig(clientOpts)
 
-	// activate all beta versions by default
-	opts := []BetaVersion{BetaTools2024_04_04, BetaTools2024_05_16, BetaPromptCaching2024_07_31, BetaMessageBatches2024_09_24, BetaTokenCounting2024_11_01, BetaMaxTokens35_2024_07_15}
+	opts := cfg.claudeBetaVersions()
 
 	ts, err := google.JWTAccessTokenSourceWithScope(
 		credBytes,
@@ -72,18 +105,16 @@ func NewVertexLLM(credBytes []byte, projectID string, location string) *ClaudeLL
 
 	fmt.Println("Using Vertex AI with token prefix:", token.AccessToken[:10], "...")
 
-	// activate all beta versions by default
-	opts = append(opts, BetaTools2024_04_04, BetaTools2024_05_16, BetaPromptCaching2024_07_31, BetaMessageBatches2024_09_24, BetaTokenCounting2024_11_01, BetaMaxTokens35_2024_07_15)
-
 	betaOpts := make([]anthropic.ClientOption, len(opts))
 	for i, opt := range opts {
 		betaOpts[i] = anthropic.WithBetaVersion(anthropic.BetaVersion(opt))
 	}
 
-	anthropicOpts := append(betaOpts, anthropic.WithVertexAI(projectID, location))
+	anthropicOpts := append(betaOpts, anthropic.WithVertexAI(projectID, location),
+		anthropic.WithHTTPClient(withClaudeCitationsTransport(cfg.httpClient())))
 
 	client := anthropic.NewClient(token.AccessToken, anthropicOpts...)
-	return &ClaudeLLM{client: client}
+	return &ClaudeLLM{client: client, betaVersions: opts, coalesceMessages: cfg.coalesceMessages, timeout: cfg.timeout, conversion: cfg.conversion}
 }
 
 // convertToClaudeMessages converts our generic InputMessage type to Anthropic's messages
@@ -108,69 +139,151 @@ func convertToClaudeMessages(messages []InputMessage) []anthropic.Message {
 			Role: anthropic.ChatRole(role),
 		}
 
-		claudeMessage.Content = convertToClaudeMessageContent(msg.MultiContent)
+		content := convertToClaudeMessageContent(msg.MultiContent)
 
 		if msg.Role == RoleTool && len(msg.ToolResults) > 0 {
-			toolResult := convertToClaudeMessageContentToolResult(msg.ToolResults[0])
-			claudeMessage.Content = []anthropic.MessageContent{
-				{
+			// Claude expects the tool_result blocks before any other content
+			results := make([]anthropic.MessageContent, 0, len(msg.ToolResults)+len(content))
+			for _, tr := range msg.ToolResults {
+				toolResult := convertToClaudeMessageContentToolResult(tr)
+				results = append(results, anthropic.MessageContent{
 					Type:                     anthropic.MessagesContentTypeToolResult,
 					MessageContentToolResult: &toolResult,
-				},
+				})
 			}
+			content = append(results, content...)
 		}
 
-		// If it's an assistant message calling a tool
-		if msg.Role == RoleAssistant && len(msg.ToolCalls) > 0 {
-			toolCall := msg.ToolCalls[0]
-			claudeMessage.Content = []anthropic.MessageContent{
-				{
+		// If it's an assistant message calling tools, the tool_use blocks follow its text
+		if msg.Role == RoleAssistant {
+			for _, toolCall := range msg.ToolCalls {
+				content = append(content, anthropic.MessageContent{
 					Type: anthropic.MessagesContentTypeToolUse,
 					MessageContentToolUse: anthropic.NewMessageContentToolUse(
 						toolCall.ID,
 						toolCall.Function.Name,
 						json.RawMessage(toolCall.Function.Arguments),
 					),
-				},
+				})
 			}
 		}
+		claudeMessage.Content = content
 
 		claudeMessages = append(claudeMessages, claudeMessage)
 	}
 	return claudeMessages
 }
 
+// convertMessages converts the messages for a request, merging consecutive
+// messages with the same role if the client was created with WithMessageCoalescing
+func (c *ClaudeLLM) convertMessages(messages []InputMessage) []anthropic.Message {
+	claudeMessages := convertToClaudeMessages(messages)
+	if !c.coalesceMessages {
+		return claudeMessages
+	}
+	return coalesceClaudeMessages(claudeMessages)
+}
+
+// coalesceClaudeMessages merges consecutive messages with the same role by
+// concatenating their content
+func coalesceClaudeMessages(messages []anthropic.Message) []anthropic.Message {
+	coalesced := make([]anthropic.Message, 0, len(messages))
+	for _, msg := range messages {
+		if n := len(coalesced); n > 0 && coalesced[n-1].Role == msg.Role {
+			content := append([]anthropic.MessageContent(nil), coalesced[n-1].Content...)
+			coalesced[n-1].Content = append(content, msg.Content...)
+			continue
+		}
+		coalesced = append(coalesced, msg)
+	}
+	return coalesced
+}
+
 // convertToClaudeMessageContent transforms our list of ContentPart into anthropic.MessageContent slices
 func convertToClaudeMessageContent(content []ContentPart) []anthropic.MessageContent {
 	multiContent := make([]anthropic.MessageContent, 0, len(content))
 	for _, part := range content {
+		var messageContent anthropic.MessageContent
 		switch part.Type {
 		case ContentTypeText:
-			multiContent = append(multiContent, anthropic.NewTextMessageContent(part.Text))
+			messageContent = anthropic.NewTextMessageContent(part.Text)
 		case ContentTypeImage:
-			multiContent = append(multiContent, anthropic.NewImageMessageContent(
+			messageContent = anthropic.NewImageMessageContent(
+				anthropic.NewMessageContentSource(
+					anthropic.MessagesContentSourceTypeBase64,
+					part.MediaType,
+					part.Data,
+				),
+			)
+		case ContentTypeDocument:
+			messageContent = anthropic.NewDocumentMessageContent(
 				anthropic.NewMessageContentSource(
 					anthropic.MessagesContentSourceTypeBase64,
 					part.MediaType,
 					part.Data,
 				),
-			))
+			)
+		default:
+			continue
 		}
+		messageContent.CacheControl = convertToClaudeCacheControl(part.CacheControl)
+		multiContent = append(multiContent, messageContent)
 	}
 	return multiContent
 }
 
+// convertToClaudeSystem builds the system blocks from the system prompt and system content,
+// keeping the cache control of every block
+func convertToClaudeSystem(req ChatCompletionRequest) []anthropic.MessageSystemPart {
+	var system []anthropic.MessageSystemPart
+	if req.SystemPrompt != nil && *req.SystemPrompt != "" {
+		system = append(system, anthropic.NewSystemMessagePart(*req.SystemPrompt))
+	}
+	for _, part := range req.SystemContent {
+		if part.Type != ContentTypeText {
+			continue
+		}
+		systemPart := anthropic.NewSystemMessagePart(part.Text)
+		systemPart.CacheControl = convertToClaudeCacheControl(part.CacheControl)
+		system = append(system, systemPart)
+	}
+	return system
+}
+
+func convertToClaudeCacheControl(cacheControl CacheControl) *anthropic.MessageCacheControl {
+	if cacheControl == CacheControlNone {
+		return nil
+	}
+	return &anthropic.MessageCacheControl{Type: anthropic.CacheControlType(cacheControl)}
+}
+
+// convertToClaudeMetadata sets the end user id of the request metadata
+func convertToClaudeMetadata(user string) map[string]any {
+	if user == "" {
+		return nil
+	}
+	return map[string]any{"user_id": user}
+}
+
 func convertToClaudeMessageContentToolResult(toolResult ToolResult) anthropic.MessageContentToolResult {
+	var content []anthropic.MessageContent
+	if toolResult.Result != "" || len(toolResult.ResultParts) == 0 {
+		content = append(content, anthropic.NewTextMessageContent(toolResult.Result))
+	}
+	content = append(content, convertToClaudeMessageContent(toolResult.ResultParts)...)
+
 	return anthropic.MessageContentToolResult{
 		ToolUseID: &toolResult.ToolCallID,
-		Content:   []anthropic.MessageContent{anthropic.NewTextMessageContent(toolResult.Result)},
+		Content:   content,
 		IsError:   &toolResult.IsError,
 	}
 }
 
-// convertFromClaudeMessage converts an anthropic.MessagesResponse to our OutputMessage
-func convertFromClaudeMessage(msg anthropic.MessagesResponse) OutputMessage {
+// convertFromClaudeMessage converts an anthropic.MessagesResponse to our OutputMessage,
+// joining its text blocks with separator
+func convertFromClaudeMessage(msg anthropic.MessagesResponse, separator string) OutputMessage {
 	var content string
+	var contentParts []ContentPart
 	var toolCalls []anthropic.MessageContentToolUse
 
 	// Gather text parts and possible tool calls
@@ -181,6 +294,7 @@ func convertFromClaudeMessage(msg anthropic.MessagesResponse) OutputMessage {
 			case anthropic.MessagesContentTypeText:
 				if part.Text != nil {
 					textParts = append(textParts, *part.Text)
+					contentParts = append(contentParts, ContentPart{Type: ContentTypeText, Text: *part.Text})
 				}
 			case anthropic.MessagesContentTypeToolUse:
 				if part.MessageContentToolUse != nil {
@@ -188,13 +302,14 @@ func convertFromClaudeMessage(msg anthropic.MessagesResponse) OutputMessage {
 				}
 			}
 		}
-		content = strings.Join(textParts, "")
+		content = strings.Join(textParts, separator)
 	}
 
 	return OutputMessage{
-		Role:      Role(msg.Role),
-		Content:   content,
-		ToolCalls: convertFromClaudeToolCalls(toolCalls),
+		Role:         Role(msg.Role),
+		Content:      content,
+		ToolCalls:    convertFromClaudeToolCalls(toolCalls),
+		ContentParts: contentParts,
 	}
 }
 
@@ -235,11 +350,73 @@ func convertToClaudeTools(tools []Tool) []anthropic.ToolDefinition {
 	return claudeTools
 }
 
+// claudeResponseToolName returns the name of the tool that Claude is forced to
+// call for a ResponseSchema, as it has no structured output of its own
+func claudeResponseToolName(schema *ResponseSchema) string {
+	if schema.Name != "" {
+		return schema.Name
+	}
+	return "json_response"
+}
+
+// convertToClaudeResponseTool returns the tool whose input is the structured
+// output for the schema, and the tool choice forcing its call
+func convertToClaudeResponseTool(schema *ResponseSchema) (anthropic.ToolDefinition, *anthropic.ToolChoice) {
+	name := claudeResponseToolName(schema)
+	tool := anthropic.ToolDefinition{
+		Name:        name,
+		Description: "Respond with JSON matching the input schema.",
+		InputSchema: schema.Schema,
+	}
+	return tool, &anthropic.ToolChoice{Type: "tool", Name: name}
+}
+
+// convertFromClaudeResponseTool turns the call of the response tool into the
+// content of the message, as if Claude had answered with the JSON directly
+func convertFromClaudeResponseTool(choice Choice, schema *ResponseSchema) Choice {
+	name := claudeResponseToolName(schema)
+	for i, tc := range choice.Message.ToolCalls {
+		if tc.Function.Name != name {
+			continue
+		}
+		choice.Message.Content = tc.Function.Arguments
+		choice.Message.ContentParts = []ContentPart{{Type: ContentTypeText, Text: tc.Function.Arguments}}
+		choice.Message.ToolCalls = append(choice.Message.ToolCalls[:i:i], choice.Message.ToolCalls[i+1:]...)
+		if len(choice.Message.ToolCalls) == 0 {
+			choice.Message.ToolCalls = nil
+			if choice.FinishReason == FinishReasonToolCalls {
+				choice.FinishReason = FinishReasonStop
+			}
+		}
+		break
+	}
+	return choice
+}
+
 // CreateChatCompletion implements the non-streaming LLM interface for Claude
 func (c *ClaudeLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	ctx, cancel := withRequestTimeout(ctx, c.timeout)
+	defer cancel()
 	if !c.isSupported(req.Model) {
 		return ChatCompletionResponse{}, fmt.Errorf("model %s is not available", req.Model)
 	}
+	if err := validateRequestSize(req, ClaudeProvider); err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	if err := c.conversion.validate(req, ClaudeProvider); err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	c.conversion.reportIgnored(req, ClaudeProvider)
+	if err := c.validateMaxTokens(req); err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	req, err := Normalize(req, ClaudeProvider)
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	if err := validateClaudeFirstMessage(req.Messages); err != nil {
+		return ChatCompletionResponse{}, err
+	}
 	model := anthropic.Model(req.Model)
 
 	tools := convertToClaudeTools(req.Tools)
@@ -249,40 +426,50 @@ func (c *ClaudeLLM) CreateChatCompletion(ctx context.Context, req ChatCompletion
 	if len(tools) > 0 {
 		toolChoice = &anthropic.ToolChoice{Type: "auto"}
 	}
-
-	topP := float32(1)
-	if req.TopP != nil {
-		topP = *req.TopP
+	if req.ResponseSchema != nil {
+		var responseTool anthropic.ToolDefinition
+		responseTool, toolChoice = convertToClaudeResponseTool(req.ResponseSchema)
+		tools = append(tools, responseTool)
 	}
 
-	var systemPrompt string
-	if req.SystemPrompt != nil {
-		systemPrompt = *req.SystemPrompt
+	claudeReq := anthropic.MessagesRequest{
+		Model:         model,
+		Messages:      c.convertMessages(req.Messages),
+		MultiSystem:   convertToClaudeSystem(req),
+		Temperature:   &req.Temperature,
+		TopP:          req.TopP,
+		TopK:          req.TopK,
+		Metadata:      convertToClaudeMetadata(req.User),
+		StopSequences: req.Stop,
+		Tools:         tools,
+		Stream:        false,
+		MaxTokens:     req.MaxTokens,
+		ToolChoice:    toolChoice,
 	}
 
-	claudeReq := anthropic.MessagesRequest{
-		Model:       model,
-		Messages:    convertToClaudeMessages(req.Messages),
-		System:      systemPrompt,
-		Temperature: &req.Temperature,
-		TopP:        &topP,
-		Tools:       tools,
-		Stream:      false,
-		MaxTokens:   req.MaxTokens,
-		ToolChoice:  toolChoice,
+	if ext, ok := req.Extensions[ClaudeProvider].(ClaudeExtensions); ok {
+		ext.apply(&claudeReq, req.ResponseSchema != nil)
 	}
 
+	ctx, raw := withRawResponseCapture(ctx)
+	ctx, citations := withClaudeCitations(ctx, req)
 	resp, err := c.client.CreateMessages(ctx, claudeReq)
 	if err != nil {
 		return ChatCompletionResponse{}, err
 	}
 
 	choices := make([]Choice, 1)
-	msg := convertFromClaudeMessage(resp)
+	msg := convertFromClaudeMessage(resp, c.conversion.textPartSeparator)
 	choices[0] = Choice{
-		Index:        0,
-		Message:      msg,
-		FinishReason: convertFromClaudeFinishReason(resp.StopReason),
+		Index:           0,
+		Message:         msg,
+		FinishReason:    convertFromClaudeFinishReason(resp.StopReason),
+		RawFinishReason: string(resp.StopReason),
+		StopSequence:    resp.StopSequence,
+		Citations:       citations.citations(),
+	}
+	if req.ResponseSchema != nil {
+		choices[0] = convertFromClaudeResponseTool(choices[0], req.ResponseSchema)
 	}
 
 	return ChatCompletionResponse{
@@ -293,6 +480,7 @@ func (c *ClaudeLLM) CreateChatCompletion(ctx context.Context, req ChatCompletion
 			CompletionTokens: resp.Usage.OutputTokens,
 			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
 		},
+		RawResponse: raw.json(),
 	}, nil
 }
 
@@ -307,7 +495,72 @@ func convertFromClaudeFinishReason(reason anthropic.MessagesStopReason) FinishRe
 	case anthropic.MessagesStopReasonStopSequence:
 		return FinishReasonStop
 	}
-	return FinishReason(reason)
+	return FinishReasonOther
+}
+
+// claudeMaxOutputTokens is the maximum output of each Claude model without betas.
+var claudeMaxOutputTokens = map[Model]int{
+	ModelClaude2Dot0:               4096,
+	ModelClaude2Dot1:               4096,
+	ModelClaude3Opus20240229:       4096,
+	ModelClaude3Sonnet20240229:     4096,
+	ModelClaude3Dot5Sonnet20240620: 4096,
+	ModelClaude3Dot5Sonnet20241022: 8192,
+	ModelClaude3Dot5SonnetLatest:   8192,
+	ModelClaude3Haiku20240307:      4096,
+	ModelClaude3Dot5HaikuLatest:    8192,
+	ModelClaude3Dot5Haiku20241022:  8192,
+}
+
+// claudeBetaMaxOutputTokens is the maximum output with BetaMaxTokens35_2024_07_15.
+const claudeBetaMaxOutputTokens = 8192
+
+// validateMaxTokens checks MaxTokens against the output limit of the model,
+// which BetaMaxTokens35_2024_07_15 raises for the June 2024 Claude 3.5 Sonnet
+func (c *ClaudeLLM) validateMaxTokens(req ChatCompletionRequest) error {
+	limit, ok := claudeMaxOutputTokens[req.Model]
+	if !ok || req.MaxTokens <= limit {
+		return nil
+	}
+	if req.Model != ModelClaude3Dot5Sonnet20240620 {
+		return fmt.Errorf("max_tokens %d exceeds the %d output tokens of %s", req.MaxTokens, limit, req.Model)
+	}
+	if !c.hasBetaVersion(BetaMaxTokens35_2024_07_15) {
+		return fmt.Errorf("max_tokens %d exceeds the %d output tokens of %s, activate %s for up to %d",
+			req.MaxTokens, limit, req.Model, BetaMaxTokens35_2024_07_15, claudeBetaMaxOutputTokens)
+	}
+	if req.MaxTokens > claudeBetaMaxOutputTokens {
+		return fmt.Errorf("max_tokens %d exceeds the %d output tokens of %s", req.MaxTokens, claudeBetaMaxOutputTokens, req.Model)
+	}
+	return nil
+}
+
+// validateClaudeFirstMessage checks that the conversation starts with a user
+// turn, which Claude requires. System messages are not part of the conversation.
+func validateClaudeFirstMessage(messages []InputMessage) error {
+	for i, msg := range messages {
+		switch msg.Role {
+		case RoleUser, RoleTool:
+			return nil
+		case RoleAssistant:
+			return fmt.Errorf("claude requires the conversation to start with a user message, message %d is from the assistant", i)
+		}
+	}
+	return nil
+}
+
+func (c *ClaudeLLM) hasBetaVersion(version BetaVersion) bool {
+	for _, v := range c.betaVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// ProviderName returns ClaudeProvider
+func (c *ClaudeLLM) ProviderName() LLMProvider {
+	return ClaudeProvider
 }
 
 // isSupported checks if the model is recognized as a Claude-friendly model
@@ -357,7 +610,8 @@ func (w *claudeStreamWrapper) Recv() (ChatCompletionResponse, error) {
 	return resp, nil
 }
 
-// Close stops the stream and cleans up any resources
+// Close stops the stream and cleans up any resources. The channels are closed
+// by the streaming goroutine once it returned, so it never sends on a closed channel.
 func (w *claudeStreamWrapper) Close() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -369,17 +623,37 @@ func (w *claudeStreamWrapper) Close() error {
 	if w.cancelFunc != nil {
 		w.cancelFunc()
 	}
-	// Drain channels
-	close(w.eventsChan)
-	close(w.errChan)
 	return nil
 }
 
 // CreateChatCompletionStream implements streaming for Claude with callbacks
 func (c *ClaudeLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	return withStreamTimeout(ctx, c.timeout, func(ctx context.Context) (ChatCompletionStream, error) {
+		return c.createChatCompletionStream(ctx, req)
+	})
+}
+
+func (c *ClaudeLLM) createChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
 	if !c.isSupported(req.Model) {
 		return nil, fmt.Errorf("model %s is not available", req.Model)
 	}
+	if err := validateRequestSize(req, ClaudeProvider); err != nil {
+		return nil, err
+	}
+	if err := c.conversion.validate(req, ClaudeProvider); err != nil {
+		return nil, err
+	}
+	c.conversion.reportIgnored(req, ClaudeProvider)
+	if err := c.validateMaxTokens(req); err != nil {
+		return nil, err
+	}
+	req, err := Normalize(req, ClaudeProvider)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateClaudeFirstMessage(req.Messages); err != nil {
+		return nil, err
+	}
 	model := anthropic.Model(req.Model)
 
 	// We'll create a child context to cancel if needed
@@ -393,7 +667,23 @@ func (c *ClaudeLLM) CreateChatCompletionStream(ctx context.Context, req ChatComp
 	// We'll accumulate them as content comes in
 	var partialTextBuilder strings.Builder
 	var toolCalls []ToolCall
-	// var stopReason anthropic.MessagesStopReason
+	var stopReason anthropic.MessagesStopReason
+	var stopSequence string
+	// toolCallBuffers holds the tool calls being streamed by content block index
+	toolCallBuffers := make(map[int]*ToolCallDelta)
+	// responseBlock is the index of the content block calling the response
+	// tool of a ResponseSchema, whose input is streamed as content
+	responseBlock := -1
+
+	tools := convertToClaudeTools(req.Tools)
+	var toolChoice *anthropic.ToolChoice
+	var responseToolName string
+	if req.ResponseSchema != nil {
+		var responseTool anthropic.ToolDefinition
+		responseTool, toolChoice = convertToClaudeResponseTool(req.ResponseSchema)
+		tools = append(tools, responseTool)
+		responseToolName = responseTool.Name
+	}
 
 	wrapper := &claudeStreamWrapper{
 		eventsChan: eventsChan,
@@ -401,32 +691,34 @@ func (c *ClaudeLLM) CreateChatCompletionStream(ctx context.Context, req ChatComp
 		cancelFunc: cancel,
 	}
 
-	topP := float32(1)
-	if req.TopP != nil {
-		topP = *req.TopP
-	}
-
-	var systemPrompt string
-	if req.SystemPrompt != nil {
-		systemPrompt = *req.SystemPrompt
+	// send pushes a chunk unless the stream was closed
+	send := func(resp ChatCompletionResponse) {
+		select {
+		case eventsChan <- resp:
+		case <-ctxStream.Done():
+		}
 	}
 
 	// Build request for streaming
 	streamReq := anthropic.MessagesStreamRequest{
 		MessagesRequest: anthropic.MessagesRequest{
-			Model:       model,
-			Messages:    convertToClaudeMessages(req.Messages),
-			System:      systemPrompt,
-			Temperature: &req.Temperature,
-			TopP:        &topP,
-			Tools:       convertToClaudeTools(req.Tools),
-			Stream:      true,
-			MaxTokens:   req.MaxTokens,
+			Model:         model,
+			Messages:      c.convertMessages(req.Messages),
+			MultiSystem:   convertToClaudeSystem(req),
+			Temperature:   &req.Temperature,
+			TopP:          req.TopP,
+			TopK:          req.TopK,
+			Metadata:      convertToClaudeMetadata(req.User),
+			StopSequences: req.Stop,
+			Tools:         tools,
+			ToolChoice:    toolChoice,
+			Stream:        true,
+			MaxTokens:     req.MaxTokens,
 		},
 
 		OnError: func(e anthropic.ErrorResponse) {
 			select {
-			case errChan <- e.Error:
+			case errChan <- newStreamError(e.Error, partialTextBuilder.String(), toolCalls):
 			default:
 			}
 		},
@@ -439,105 +731,149 @@ func (c *ClaudeLLM) CreateChatCompletionStream(ctx context.Context, req ChatComp
 			// This indicates a new "assistant" message is starting
 			partialTextBuilder.Reset()
 			toolCalls = nil
+			stopReason = ""
+			stopSequence = ""
+			responseBlock = -1
+			clear(toolCallBuffers)
 		},
 
 		OnContentBlockStart: func(d anthropic.MessagesEventContentBlockStartData) {
-			// We'll do nothing special here. We wait for deltas
+			// Text is handled by its deltas, a tool call gets a buffer for its arguments
+			if d.ContentBlock.Type == anthropic.MessagesContentTypeToolUse && d.ContentBlock.MessageContentToolUse != nil {
+				if d.ContentBlock.MessageContentToolUse.Name == responseToolName {
+					responseBlock = d.Index
+					return
+				}
+				toolCallBuffers[d.Index] = &ToolCallDelta{
+					Index: len(toolCalls) + len(toolCallBuffers),
+					ID:    d.ContentBlock.MessageContentToolUse.ID,
+					Name:  d.ContentBlock.MessageContentToolUse.Name,
+				}
+			}
 		},
 
 		OnContentBlockDelta: func(d anthropic.MessagesEventContentBlockDeltaData) {
-			// We only handle partial text or partial JSON for tool calls
-			if d.Delta.Type == anthropic.MessagesContentTypeTextDelta && d.Delta.Text != nil {
-				partialTextBuilder.WriteString(*d.Delta.Text)
+			// We only handle partial text or partial JSON for tool calls, the
+			// input of the response tool is the content of the message
+			var text *string
+			if d.Delta.Type == anthropic.MessagesContentTypeTextDelta {
+				text = d.Delta.Text
+			} else if d.Delta.Type == anthropic.MessagesContentTypeInputJsonDelta && d.Index == responseBlock {
+				text = d.Delta.PartialJson
+			}
+			if text != nil {
+				partialTextBuilder.WriteString(*text)
 				// Send partial response
-				eventsChan <- ChatCompletionResponse{
+				send(ChatCompletionResponse{
 					Choices: []Choice{{
 						Index: 0,
 						Message: OutputMessage{
 							Role:    RoleAssistant,
-							Content: *d.Delta.Text,
-							// tool calls remain the same
-							ToolCalls: toolCalls,
+							Content: *text,
 						},
 						FinishReason: FinishReasonNull,
 					}},
-				}
+				})
 			} else if d.Delta.Type == anthropic.MessagesContentTypeInputJsonDelta && d.Delta.PartialJson != nil {
-				// For a tool call, accumulate partial JSON
-				// We'll finalize it at content_block_stop
-				// If we wanted partial function calls, we'd do something here
+				// For a tool call, accumulate partial JSON and pass on the fragment,
+				// the tool call itself is sent at content_block_stop
+				buffer, ok := toolCallBuffers[d.Index]
+				if !ok {
+					return
+				}
+				buffer.Arguments += *d.Delta.PartialJson
+				delta := *buffer
+				delta.Arguments = *d.Delta.PartialJson
+				send(ChatCompletionResponse{
+					Choices: []Choice{{
+						Index: 0,
+						Message: OutputMessage{
+							Role:           RoleAssistant,
+							ToolCallDeltas: []ToolCallDelta{delta},
+						},
+						FinishReason: FinishReasonNull,
+					}},
+				})
 			}
 		},
 
 		OnContentBlockStop: func(d anthropic.MessagesEventContentBlockStopData, block anthropic.MessageContent) {
-			// If the content block is a tool call, finalize its partial JSON
-			if block.Type == anthropic.MessagesContentTypeToolUse &&
-				block.MessageContentToolUse != nil {
+			// If the content block is a tool call, finalize it from its buffer
+			buffer, ok := toolCallBuffers[d.Index]
+			if ok {
+				delete(toolCallBuffers, d.Index)
 				tc := ToolCall{
-					ID:   block.MessageContentToolUse.ID,
+					ID:   buffer.ID,
 					Type: "function",
 					Function: ToolCallFunction{
-						Name:      block.MessageContentToolUse.Name,
-						Arguments: string(block.MessageContentToolUse.Input),
+						Name:      buffer.Name,
+						Arguments: buffer.Arguments,
 					},
 				}
 				toolCalls = append(toolCalls, tc)
 
-				// Now send partial update with the new tool call
-				eventsChan <- ChatCompletionResponse{
+				// Now send partial update with the new tool call, chunks only carry
+				// deltas as StreamChatCompletion concatenates them
+				send(ChatCompletionResponse{
 					Choices: []Choice{{
 						Index: 0,
 						Message: OutputMessage{
 							Role:      RoleAssistant,
-							Content:   partialTextBuilder.String(),
-							ToolCalls: toolCalls,
+							ToolCalls: []ToolCall{tc},
 						},
 						FinishReason: FinishReasonNull,
 					}},
-				}
+				})
 			}
 		},
 
 		OnMessageDelta: func(d anthropic.MessagesEventMessageDeltaData) {
-			// This might indicate a new stop reason or usage changes
-			// if d.Delta.StopReason != "" {
-			// 	stopReason = d.Delta.StopReason
-			// }
-			// We ignore usage here, or we could track usage tokens
+			// This carries the stop reason and usage changes, we ignore usage here
+			if d.Delta.StopReason != "" {
+				stopReason = d.Delta.StopReason
+			}
+			if d.Delta.StopSequence != "" {
+				stopSequence = d.Delta.StopSequence
+			}
 		},
 
 		OnMessageStop: func(d anthropic.MessagesEventMessageStopData) {
-			// This indicates the final chunk of the stream for the message
-			// We'll push a final chunk with the full content
-			// finalMsg := ChatCompletionResponse{
-			// 	Choices: []Choice{{
-			// 		Index: 0,
-			// 		Message: OutputMessage{
-			// 			Role:      RoleAssistant,
-			// 			Content:   partialTextBuilder.String(),
-			// 			ToolCalls: toolCalls,
-			// 		},
-			// 		FinishReason: convertFromClaudeFinishReason(stopReason),
-			// 	}},
-			// }
-			// eventsChan <- finalMsg
-
-			// streaming is complete, so close the channel
-			wrapper.Close()
+			// This indicates the end of the message, push a final chunk with
+			// the finish reason. Its content and tool calls were already sent.
+			finishReason := convertFromClaudeFinishReason(stopReason)
+			if finishReason == FinishReasonToolCalls && responseBlock >= 0 && len(toolCalls) == 0 {
+				finishReason = FinishReasonStop
+			}
+			send(ChatCompletionResponse{
+				Choices: []Choice{{
+					Index: 0,
+					Message: OutputMessage{
+						Role: RoleAssistant,
+					},
+					FinishReason:    finishReason,
+					RawFinishReason: string(stopReason),
+					StopSequence:    stopSequence,
+				}},
+			})
 		},
 	}
 
+	if ext, ok := req.Extensions[ClaudeProvider].(ClaudeExtensions); ok {
+		ext.apply(&streamReq.MessagesRequest, req.ResponseSchema != nil)
+	}
+
 	// Run the streaming request in a goroutine
 	go func() {
 		defer func() {
-			// Ensure we close everything if an unexpected error occurs
-			_ = wrapper.Close()
+			// Errors are sent before the events channel is closed, so Recv sees them
+			close(eventsChan)
+			cancel()
 		}()
 
 		_, err := c.client.CreateMessagesStream(ctxStream, streamReq)
 		if err != nil && !errors.Is(err, io.EOF) {
 			select {
-			case errChan <- err:
+			case errChan <- newStreamError(err, partialTextBuilder.String(), toolCalls):
 			default:
 			}
 		}
@@ -545,3 +881,60 @@ func (c *ClaudeLLM) CreateChatCompletionStream(ctx context.Context, req ChatComp
 
 	return wrapper, nil
 }
+
+// ListBatches returns all message batches of the Anthropic account
+func (c *ClaudeLLM) ListBatches(ctx context.Context) ([]Batch, error) {
+	var batches []Batch
+	var req anthropic.ListBatchesRequest
+	for {
+		resp, err := c.client.ListBatches(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list batches: %w", err)
+		}
+		for _, b := range resp.Data {
+			batches = append(batches, convertFromClaudeBatch(b))
+		}
+		if !resp.HasMore || resp.LastId == nil {
+			return batches, nil
+		}
+		afterID := string(*resp.LastId)
+		req.AfterId = &afterID
+	}
+}
+
+// CancelBatch cancels the message batch with the given id
+func (c *ClaudeLLM) CancelBatch(ctx context.Context, id string) (Batch, error) {
+	resp, err := c.client.CancelBatch(ctx, anthropic.BatchId(id))
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to cancel batch %s: %w", id, err)
+	}
+	return convertFromClaudeBatch(resp.BatchRespCore), nil
+}
+
+func convertFromClaudeBatch(b anthropic.BatchRespCore) Batch {
+	return Batch{
+		ID:        string(b.Id),
+		Status:    convertFromClaudeBatchStatus(b),
+		CreatedAt: b.CreatedAt,
+	}
+}
+
+// convertFromClaudeBatchStatus derives the normalized status. Anthropic only reports
+// whether processing has ended, so the outcome is taken from the request counts.
+func convertFromClaudeBatchStatus(b anthropic.BatchRespCore) BatchStatus {
+	switch b.ProcessingStatus {
+	case anthropic.ProcessingStatusInProgress:
+		return BatchStatusInProgress
+	case anthropic.ProcessingStatusCanceling:
+		return BatchStatusCancelled
+	case anthropic.ProcessingStatusEnded:
+		if b.CancelInitiatedAt != nil {
+			return BatchStatusCancelled
+		}
+		if b.RequestCounts.Succeeded == 0 && b.RequestCounts.Errored+b.RequestCounts.Expired > 0 {
+			return BatchStatusFailed
+		}
+		return BatchStatusCompleted
+	}
+	return BatchStatusInProgress
+}
@@ -0,0 +1,565 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/liushuangls/go-anthropic/v2"
+)
+
+// newTestClaudeLLM returns a client sending its requests to handler
+func newTestClaudeLLM(t *testing.T, handler http.HandlerFunc, opts ...ClientOption) *ClaudeLLM {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cfg := newClientConfig(opts)
+	betaVersions := cfg.claudeBetaVersions()
+	anthropicOpts := []anthropic.ClientOption{
+		anthropic.WithBaseURL(srv.URL),
+		anthropic.WithHTTPClient(withClaudeCitationsTransport(cfg.httpClient())),
+	}
+	for _, v := range betaVersions {
+		anthropicOpts = append(anthropicOpts, anthropic.WithBetaVersion(anthropic.BetaVersion(v)))
+	}
+	return &ClaudeLLM{
+		client:           anthropic.NewClient("test", anthropicOpts...),
+		betaVersions:     betaVersions,
+		coalesceMessages: cfg.coalesceMessages,
+		conversion:       cfg.conversion,
+	}
+}
+
+// writeClaudeMessage answers with a message made of the given content blocks
+func writeClaudeMessage(w http.ResponseWriter, stopReason string, blocks ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-5-sonnet-latest","content":[%s],"stop_reason":%q,"usage":{"input_tokens":3,"output_tokens":2}}`,
+		strings.Join(blocks, ","), stopReason)
+}
+
+func TestClaudeSystemCacheControl(t *testing.T) {
+	instruction := "Answer briefly."
+	knowledge := ContentPart{Type: ContentTypeText, Text: "A large knowledge base.", CacheControl: CacheControlEphemeral}
+	dynamic := ContentPart{Type: ContentTypeText, Text: "Today is Monday."}
+
+	tests := []struct {
+		name          string
+		prompt        *string
+		content       []ContentPart
+		wantTexts     []string
+		wantCacheable []bool
+	}{
+		{
+			name:          "only the marked block",
+			prompt:        &instruction,
+			content:       []ContentPart{knowledge, dynamic},
+			wantTexts:     []string{instruction, knowledge.Text, dynamic.Text},
+			wantCacheable: []bool{false, true, false},
+		},
+		{
+			name:          "no marked block",
+			content:       []ContentPart{dynamic},
+			wantTexts:     []string{dynamic.Text},
+			wantCacheable: []bool{false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent struct {
+				System []struct {
+					Text         string          `json:"text"`
+					CacheControl json.RawMessage `json:"cache_control"`
+				} `json:"system"`
+			}
+			c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				writeClaudeMessage(w, "end_turn", `{"type":"text","text":"ok"}`)
+			})
+
+			req := testRequest(ModelClaude3Dot5SonnetLatest, "hi")
+			req.MaxTokens = 100
+			req.SystemPrompt = tt.prompt
+			req.SystemContent = tt.content
+			if _, err := c.CreateChatCompletion(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(sent.System) != len(tt.wantTexts) {
+				t.Fatalf("got %d system blocks, want %d", len(sent.System), len(tt.wantTexts))
+			}
+			for i, block := range sent.System {
+				if block.Text != tt.wantTexts[i] {
+					t.Errorf("block %d text = %q, want %q", i, block.Text, tt.wantTexts[i])
+				}
+				cacheable := len(block.CacheControl) > 0 && string(block.CacheControl) != "null"
+				if cacheable != tt.wantCacheable[i] {
+					t.Errorf("block %d cache_control = %s, want cacheable %v", i, block.CacheControl, tt.wantCacheable[i])
+				}
+				if cacheable && string(block.CacheControl) != `{"type":"ephemeral"}` {
+					t.Errorf("block %d cache_control = %s", i, block.CacheControl)
+				}
+			}
+		})
+	}
+}
+
+func TestClaudeContentParts(t *testing.T) {
+	c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		writeClaudeMessage(w, "tool_use",
+			`{"type":"text","text":"Let me check."}`,
+			`{"type":"tool_use","id":"toolu_1","name":"weather","input":{"city":"Paris"}}`,
+			`{"type":"text","text":"One moment."}`)
+	}, WithTextPartSeparator("\n"))
+
+	req := testRequest(ModelClaude3Dot5SonnetLatest, "hi")
+	req.MaxTokens = 100
+	resp, err := c.CreateChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := resp.Choices[0].Message
+	want := []ContentPart{
+		{Type: ContentTypeText, Text: "Let me check."},
+		{Type: ContentTypeText, Text: "One moment."},
+	}
+	if len(msg.ContentParts) != len(want) {
+		t.Fatalf("got content parts %+v, want %+v", msg.ContentParts, want)
+	}
+	for i := range want {
+		if msg.ContentParts[i].Type != want[i].Type || msg.ContentParts[i].Text != want[i].Text {
+			t.Errorf("content part %d = %+v, want %+v", i, msg.ContentParts[i], want[i])
+		}
+	}
+	if msg.Content != "Let me check.\nOne moment." {
+		t.Errorf("content = %q, want the joined text blocks", msg.Content)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Name != "weather" {
+		t.Errorf("tool calls = %+v, want the tool_use block", msg.ToolCalls)
+	}
+}
+
+func TestClaudeTopKAndUser(t *testing.T) {
+	topK := 40
+	tests := []struct {
+		name     string
+		topK     *int
+		user     string
+		wantTopK any
+		wantMeta any
+	}{
+		{
+			name:     "both set",
+			topK:     &topK,
+			user:     "user-42",
+			wantTopK: float64(40),
+			wantMeta: map[string]any{"user_id": "user-42"},
+		},
+		{
+			name: "neither set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent map[string]any
+			c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				captureBody(t, r, &sent)
+				writeClaudeMessage(w, "end_turn", `{"type":"text","text":"ok"}`)
+			})
+
+			req := testRequest(ModelClaude3Dot5SonnetLatest, "hi")
+			req.MaxTokens = 100
+			req.TopK = tt.topK
+			req.User = tt.user
+			if _, err := c.CreateChatCompletion(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(sent["top_k"], tt.wantTopK) {
+				t.Errorf("top_k = %v, want %v", sent["top_k"], tt.wantTopK)
+			}
+			if !reflect.DeepEqual(sent["metadata"], tt.wantMeta) {
+				t.Errorf("metadata = %v, want %v", sent["metadata"], tt.wantMeta)
+			}
+		})
+	}
+}
+
+func TestClaudeStopSequence(t *testing.T) {
+	var sent map[string]any
+	c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		captureBody(t, r, &sent)
+		if sent["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":3,\"output_tokens\":1}}}\n\n")
+			fmt.Fprint(w, "event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"stop_sequence\",\"stop_sequence\":\"END\"},\"usage\":{\"output_tokens\":2}}\n\n")
+			fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"1, 2, 3"}],"stop_reason":"stop_sequence","stop_sequence":"END","usage":{"input_tokens":3,"output_tokens":2}}`)
+	})
+
+	req := testRequest(ModelClaude3Dot5SonnetLatest, "count")
+	req.MaxTokens = 100
+	req.Stop = []string{"STOP", "END"}
+
+	resp, err := c.CreateChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sent["stop_sequences"], []any{"STOP", "END"}) {
+		t.Errorf("stop_sequences = %v, want the request's stop sequences", sent["stop_sequences"])
+	}
+	choice := resp.Choices[0]
+	if choice.StopSequence != "END" || choice.FinishReason != FinishReasonStop || choice.RawFinishReason != "stop_sequence" {
+		t.Errorf("choice = %+v, want it stopped on END", choice)
+	}
+
+	stream, err := c.CreateChatCompletionStream(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	var last Choice
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = chunk.Choices[0]
+	}
+	if last.StopSequence != "END" || last.FinishReason != FinishReasonStop {
+		t.Errorf("final chunk = %+v, want it stopped on END", last)
+	}
+}
+
+func TestClaudeImageToolResult(t *testing.T) {
+	var sent struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content []struct {
+				Type      string `json:"type"`
+				ToolUseID string `json:"tool_use_id"`
+				Content   []struct {
+					Type   string `json:"type"`
+					Text   string `json:"text"`
+					Source struct {
+						Type      string `json:"type"`
+						MediaType string `json:"media_type"`
+						Data      string `json:"data"`
+					} `json:"source"`
+				} `json:"content"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		writeClaudeMessage(w, "end_turn", `{"type":"text","text":"Sales doubled."}`)
+	})
+
+	chart := testPNG(t, 4, 4)
+	req := testRequest(ModelClaude3Dot5SonnetLatest, "plot the sales")
+	req.MaxTokens = 100
+	req.Messages = append(req.Messages,
+		InputMessage{Role: RoleAssistant, ToolCalls: []ToolCall{{
+			ID: "toolu_1", Type: "function", Function: ToolCallFunction{Name: "plot", Arguments: "{}"},
+		}}},
+		InputMessage{Role: RoleTool, ToolResults: []ToolResult{{
+			ToolCallID:  "toolu_1",
+			Result:      "the sales chart",
+			ResultParts: []ContentPart{{Type: ContentTypeImage, MediaType: "image/png", Data: chart}},
+		}}},
+	)
+	if _, err := c.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	last := sent.Messages[len(sent.Messages)-1]
+	if last.Role != "user" || len(last.Content) != 1 || last.Content[0].Type != "tool_result" {
+		t.Fatalf("last message = %+v, want a single tool result", last)
+	}
+	result := last.Content[0]
+	if result.ToolUseID != "toolu_1" {
+		t.Errorf("tool_use_id = %q, want toolu_1", result.ToolUseID)
+	}
+	if len(result.Content) != 2 {
+		t.Fatalf("tool result content = %+v, want the text and the image", result.Content)
+	}
+	if result.Content[0].Type != "text" || result.Content[0].Text != "the sales chart" {
+		t.Errorf("block 0 = %+v, want the text result", result.Content[0])
+	}
+	image := result.Content[1]
+	if image.Type != "image" || image.Source.Type != "base64" || image.Source.MediaType != "image/png" || image.Source.Data != chart {
+		t.Errorf("block 1 = %+v, want the base64 image", image)
+	}
+}
+
+func TestClaudeExtendedMaxTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     Model
+		maxTokens int
+		opts      []ClientOption
+		wantErr   string
+	}{
+		{name: "extended output with the beta", model: ModelClaude3Dot5Sonnet20240620, maxTokens: 8192},
+		{name: "within the limit without the beta", model: ModelClaude3Dot5Sonnet20240620, maxTokens: 4096, opts: []ClientOption{WithBetaVersions()}},
+		{name: "model with a larger limit", model: ModelClaude3Dot5Sonnet20241022, maxTokens: 8192, opts: []ClientOption{WithBetaVersions()}},
+		{
+			name: "extended output without the beta", model: ModelClaude3Dot5Sonnet20240620, maxTokens: 8192,
+			opts: []ClientOption{WithBetaVersions(BetaPromptCaching2024_07_31)}, wantErr: string(BetaMaxTokens35_2024_07_15),
+		},
+		{name: "above the extended output", model: ModelClaude3Dot5Sonnet20240620, maxTokens: 8193, wantErr: "8192 output tokens"},
+		{name: "model without the beta", model: ModelClaude3Opus20240229, maxTokens: 8192, wantErr: "4096 output tokens"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent map[string]any
+			var betas string
+			c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				betas = r.Header.Get("anthropic-beta")
+				captureBody(t, r, &sent)
+				writeClaudeMessage(w, "end_turn", `{"type":"text","text":"ok"}`)
+			}, tt.opts...)
+
+			req := testRequest(tt.model, "hi")
+			req.MaxTokens = tt.maxTokens
+			_, err := c.CreateChatCompletion(context.Background(), req)
+
+			if tt.wantErr != "" {
+				_, streamErr := c.CreateChatCompletionStream(context.Background(), req)
+				for _, err := range []error{err, streamErr} {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Errorf("got error %v, want it to mention %q", err, tt.wantErr)
+					}
+				}
+				if sent != nil {
+					t.Error("the request was sent")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sent["max_tokens"] != float64(tt.maxTokens) {
+				t.Errorf("max_tokens = %v, want %d", sent["max_tokens"], tt.maxTokens)
+			}
+			if tt.maxTokens > 4096 && tt.model == ModelClaude3Dot5Sonnet20240620 && !strings.Contains(betas, string(BetaMaxTokens35_2024_07_15)) {
+				t.Errorf("anthropic-beta = %q, want the max tokens beta", betas)
+			}
+		})
+	}
+}
+
+func TestClaudeCitations(t *testing.T) {
+	var sent struct {
+		Messages []struct {
+			Content []map[string]any `json:"content"`
+		} `json:"messages"`
+	}
+	c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		writeClaudeMessage(w, "end_turn",
+			`{"type":"text","text":"According to the report, "}`,
+			`{"type":"text","text":"revenue grew 10%","citations":[{"type":"page_location","cited_text":"Revenue grew by 10%.","document_index":0,"document_title":"Report","start_page_number":2,"end_page_number":3}]}`,
+			`{"type":"text","text":" and the grass is green.","citations":[{"type":"char_location","cited_text":"The grass is green.","document_index":1,"start_char_index":0,"end_char_index":19}]}`)
+	})
+
+	report := ContentPart{Type: ContentTypeDocument, MediaType: "application/pdf", Data: "JVBERi0xLjc=", Citations: true}
+	notes := ContentPart{Type: ContentTypeDocument, MediaType: "application/pdf", Data: "JVBERi0xLjQ=", Citations: true}
+	appendix := ContentPart{Type: ContentTypeDocument, MediaType: "application/pdf", Data: "JVBERi0xLjU="}
+	req := testRequest(ModelClaude3Dot5SonnetLatest, "Summarize the documents.")
+	req.MaxTokens = 100
+	req.Messages[0].MultiContent = append([]ContentPart{report, notes, appendix}, req.Messages[0].MultiContent...)
+
+	resp, err := c.CreateChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := sent.Messages[0].Content
+	for i, wantCited := range []bool{true, true, false} {
+		cited := reflect.DeepEqual(blocks[i]["citations"], map[string]any{"enabled": true})
+		if blocks[i]["type"] != "document" || cited != wantCited {
+			t.Errorf("block %d = %v, want citations enabled %v", i, blocks[i], wantCited)
+		}
+	}
+	if _, ok := blocks[3]["citations"]; ok {
+		t.Errorf("citations were enabled for the text block %v", blocks[3])
+	}
+
+	want := []Citation{
+		{Type: "page_location", Text: "revenue grew 10%", CitedText: "Revenue grew by 10%.", DocumentIndex: 0, DocumentTitle: "Report", Start: 2, End: 3},
+		{Type: "char_location", Text: " and the grass is green.", CitedText: "The grass is green.", DocumentIndex: 1, Start: 0, End: 19},
+	}
+	if got := resp.Choices[0].Citations; !reflect.DeepEqual(got, want) {
+		t.Errorf("citations = %+v, want %+v", got, want)
+	}
+	if got := resp.Choices[0].Message.Content; got != "According to the report, revenue grew 10% and the grass is green." {
+		t.Errorf("content = %q", got)
+	}
+}
+
+func TestClaudeCitationsDisabled(t *testing.T) {
+	var body map[string]any
+	c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		captureBody(t, r, &body)
+		writeClaudeMessage(w, "end_turn", `{"type":"text","text":"ok","citations":[{"type":"char_location","cited_text":"ok","document_index":0,"start_char_index":0,"end_char_index":2}]}`)
+	})
+
+	req := testRequest(ModelClaude3Dot5SonnetLatest, "hi")
+	req.MaxTokens = 100
+	req.Messages[0].MultiContent = append(req.Messages[0].MultiContent,
+		ContentPart{Type: ContentTypeDocument, MediaType: "application/pdf", Data: "JVBERi0xLjc="})
+	resp, err := c.CreateChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(fmt.Sprint(body), "citations") {
+		t.Errorf("citations were enabled: %v", body)
+	}
+	if resp.Choices[0].Citations != nil {
+		t.Errorf("citations = %+v, want none without cited documents", resp.Choices[0].Citations)
+	}
+}
+
+func TestClaudeTextPartSeparator(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+		want string
+	}{
+		{"default", nil, "HelloWorld"},
+		{"newline", []ClientOption{WithTextPartSeparator("\n")}, "Hello\nWorld"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				writeClaudeMessage(w, "end_turn", `{"type":"text","text":"Hello"}`, `{"type":"text","text":"World"}`)
+			}, tt.opts...)
+
+			resp, err := c.CreateChatCompletion(context.Background(), testRequest(ModelClaude3Dot5SonnetLatest, "hi"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.Choices[0].Message.Content; got != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaudeMessageCoalescing(t *testing.T) {
+	req := testRequest(ModelClaude3Dot5SonnetLatest, "Here is the report.")
+	req.Messages = append(req.Messages,
+		InputMessage{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "Summarize it."}}},
+		InputMessage{Role: RoleAssistant, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "Sure."}}},
+		InputMessage{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "Go on."}}},
+	)
+
+	tests := []struct {
+		name      string
+		opts      []ClientOption
+		wantRoles []string
+		// wantFirst are the texts of the first message
+		wantFirst []string
+	}{
+		{"disabled", nil, []string{"user", "user", "assistant", "user"}, []string{"Here is the report."}},
+		{"enabled", []ClientOption{WithMessageCoalescing()}, []string{"user", "assistant", "user"}, []string{"Here is the report.", "Summarize it."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body struct {
+				Messages []struct {
+					Role    string `json:"role"`
+					Content []struct {
+						Text string `json:"text"`
+					} `json:"content"`
+				} `json:"messages"`
+			}
+			c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				writeClaudeMessage(w, "end_turn", `{"type":"text","text":"ok"}`)
+			}, tt.opts...)
+
+			if _, err := c.CreateChatCompletion(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			var roles []string
+			for _, msg := range body.Messages {
+				roles = append(roles, msg.Role)
+			}
+			if !reflect.DeepEqual(roles, tt.wantRoles) {
+				t.Fatalf("roles = %v, want %v", roles, tt.wantRoles)
+			}
+			var first []string
+			for _, block := range body.Messages[0].Content {
+				first = append(first, block.Text)
+			}
+			if !reflect.DeepEqual(first, tt.wantFirst) {
+				t.Errorf("first message has texts %q, want %q", first, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestClaudeFirstMessage(t *testing.T) {
+	assistant := InputMessage{Role: RoleAssistant, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "Hello!"}}}
+	user := InputMessage{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "hi"}}}
+
+	tests := []struct {
+		name     string
+		messages []InputMessage
+		wantErr  bool
+	}{
+		{"user first", []InputMessage{user, assistant, user}, false},
+		{"assistant first", []InputMessage{assistant, user}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				writeClaudeMessage(w, "end_turn", `{"type":"text","text":"ok"}`)
+			})
+			req := ChatCompletionRequest{Model: ModelClaude3Dot5SonnetLatest, Messages: tt.messages}
+
+			_, err := c.CreateChatCompletion(context.Background(), req)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "start with a user message") {
+				t.Errorf("got error %v, want the conversation to be rejected", err)
+			}
+			if _, err := c.CreateChatCompletionStream(context.Background(), req); err == nil {
+				t.Error("the stream was created")
+			}
+			if requests != 0 {
+				t.Errorf("sent %d requests, want none", requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package llm
+
+// Clone returns a deep copy of the request. Messages, tools and tool parameter
+// maps are copied so the clone can be mutated without affecting the original.
+func (r ChatCompletionRequest) Clone() ChatCompletionRequest {
+	c := r
+
+	if r.SystemPrompt != nil {
+		systemPrompt := *r.SystemPrompt
+		c.SystemPrompt = &systemPrompt
+	}
+	c.SystemContent = cloneContentParts(r.SystemContent)
+	if r.FewShot != nil {
+		c.FewShot = append([]Example(nil), r.FewShot...)
+	}
+	if r.Store != nil {
+		store := *r.Store
+		c.Store = &store
+	}
+	if r.Stop != nil {
+		c.Stop = append([]string(nil), r.Stop...)
+	}
+	if r.Extensions != nil {
+		c.Extensions = make(map[LLMProvider]any, len(r.Extensions))
+		for p, ext := range r.Extensions {
+			c.Extensions[p] = cloneExtension(ext)
+		}
+	}
+	if r.Metadata != nil {
+		c.Metadata = make(map[string]string, len(r.Metadata))
+		for k, v := range r.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	if r.TopK != nil {
+		topK := *r.TopK
+		c.TopK = &topK
+	}
+	if r.Creativity != nil {
+		creativity := *r.Creativity
+		c.Creativity = &creativity
+	}
+	if r.ReasoningEffort != nil {
+		reasoningEffort := *r.ReasoningEffort
+		c.ReasoningEffort = &reasoningEffort
+	}
+	if r.Seed != nil {
+		seed := *r.Seed
+		c.Seed = &seed
+	}
+	if r.TopP != nil {
+		topP := *r.TopP
+		c.TopP = &topP
+	}
+
+	if r.ResponseSchema != nil {
+		schema := *r.ResponseSchema
+		schema.Schema, _ = cloneValue(r.ResponseSchema.Schema).(map[string]interface{})
+		c.ResponseSchema = &schema
+	}
+
+	if r.Messages != nil {
+		c.Messages = make([]InputMessage, len(r.Messages))
+		for i, msg := range r.Messages {
+			c.Messages[i] = msg.Clone()
+		}
+	}
+
+	if r.Tools != nil {
+		c.Tools = make([]Tool, len(r.Tools))
+		for i, tool := range r.Tools {
+			c.Tools[i] = tool.Clone()
+		}
+	}
+
+	return c
+}
+
+// Clone returns a deep copy of the message.
+func (m InputMessage) Clone() InputMessage {
+	c := m
+	c.MultiContent = cloneContentParts(m.MultiContent)
+	if m.ToolCalls != nil {
+		c.ToolCalls = append([]ToolCall(nil), m.ToolCalls...)
+	}
+	if m.ToolResults != nil {
+		c.ToolResults = append([]ToolResult(nil), m.ToolResults...)
+		for i, tr := range c.ToolResults {
+			c.ToolResults[i].ResultParts = cloneContentParts(tr.ResultParts)
+		}
+	}
+	return c
+}
+
+// Clone returns a deep copy of the response.
+func (r ChatCompletionResponse) Clone() ChatCompletionResponse {
+	c := r
+	if r.RawResponse != nil {
+		c.RawResponse = append([]byte(nil), r.RawResponse...)
+	}
+	if r.Choices != nil {
+		c.Choices = make([]Choice, len(r.Choices))
+		for i, choice := range r.Choices {
+			c.Choices[i] = choice
+			msg := &c.Choices[i].Message
+			if msg.ToolCalls != nil {
+				msg.ToolCalls = append([]ToolCall(nil), msg.ToolCalls...)
+			}
+			if msg.ToolCallDeltas != nil {
+				msg.ToolCallDeltas = append([]ToolCallDelta(nil), msg.ToolCallDeltas...)
+			}
+			msg.ContentParts = cloneContentParts(msg.ContentParts)
+			if choice.Citations != nil {
+				c.Choices[i].Citations = append([]Citation(nil), choice.Citations...)
+			}
+		}
+	}
+	return c
+}
+
+// cloneContentParts deep copies content parts including their images
+func cloneContentParts(parts []ContentPart) []ContentPart {
+	if parts == nil {
+		return nil
+	}
+	c := append([]ContentPart(nil), parts...)
+	for i, part := range c {
+		if part.Images != nil {
+			c[i].Images = append([]string(nil), part.Images...)
+		}
+	}
+	return c
+}
+
+// Clone returns a deep copy of the tool including its parameter schema.
+func (t Tool) Clone() Tool {
+	c := t
+	if t.Function != nil {
+		function := *t.Function
+		if t.Function.Parameters != nil {
+			function.Parameters, _ = cloneValue(t.Function.Parameters).(map[string]interface{})
+		}
+		c.Function = &function
+	}
+	return c
+}
+
+// cloneExtension deep copies the maps and pointers of provider extensions
+func cloneExtension(ext any) any {
+	e, ok := ext.(OpenAIExtensions)
+	if !ok {
+		return ext
+	}
+	if e.LogitBias != nil {
+		logitBias := make(map[string]int, len(e.LogitBias))
+		for token, bias := range e.LogitBias {
+			logitBias[token] = bias
+		}
+		e.LogitBias = logitBias
+	}
+	if e.ParallelToolCalls != nil {
+		parallel := *e.ParallelToolCalls
+		e.ParallelToolCalls = &parallel
+	}
+	return e
+}
+
+// cloneValue deep copies JSON-like values made of maps and slices
+func cloneValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[k] = cloneValue(item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(val))
+		for i, item := range val {
+			s[i] = cloneValue(item)
+		}
+		return s
+	case []string:
+		return append([]string(nil), val...)
+	case OrderedProperties:
+		p := make(OrderedProperties, len(val))
+		for i, prop := range val {
+			p[i] = Property{Name: prop.Name}
+			if prop.Schema != nil {
+				p[i].Schema, _ = cloneValue(prop.Schema).(map[string]interface{})
+			}
+		}
+		return p
+	default:
+		return v
+	}
+}
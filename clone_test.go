@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// cloneTestRequest returns a request with every kind of nested data set
+func cloneTestRequest() ChatCompletionRequest {
+	systemPrompt := "be brief"
+	topP := float32(0.9)
+	parallel := true
+	return ChatCompletionRequest{
+		Model:        ModelGPT4o,
+		SystemPrompt: &systemPrompt,
+		SystemContent: []ContentPart{
+			{Type: ContentTypeImages, Images: []string{"aGk="}, MediaType: "image/png"},
+		},
+		TopP:     &topP,
+		Stop:     []string{"END"},
+		Metadata: map[string]string{"user": "1"},
+		FewShot:  []Example{{Input: "a", Output: "b"}},
+		Messages: []InputMessage{
+			{Role: RoleUser, MultiContent: []ContentPart{
+				{Type: ContentTypeText, Text: "hi"},
+				{Type: ContentTypeImages, Images: []string{"aGk="}, MediaType: "image/png"},
+			}},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Function: ToolCallFunction{Name: "chart"}}}},
+			{Role: RoleTool, ToolResults: []ToolResult{{
+				ToolCallID:  "call_1",
+				Result:      "done",
+				ResultParts: []ContentPart{{Type: ContentTypeImage, Data: "aGk=", MediaType: "image/png"}},
+			}}},
+		},
+		Tools: []Tool{{Type: "function", Function: &Function{
+			Name:       "chart",
+			Parameters: map[string]interface{}{"type": "object", "required": []interface{}{"x"}},
+		}}},
+		ResponseSchema: &ResponseSchema{Name: "answer", Schema: map[string]interface{}{"type": "object"}},
+	}.WithOpenAI(OpenAIExtensions{LogitBias: map[string]int{"1": 5}, ParallelToolCalls: &parallel})
+}
+
+func TestRequestCloneDoesNotAlias(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(c *ChatCompletionRequest)
+	}{
+		{"system prompt", func(c *ChatCompletionRequest) { *c.SystemPrompt = "x" }},
+		{"system content image", func(c *ChatCompletionRequest) { c.SystemContent[0].Images[0] = "x" }},
+		{"top p", func(c *ChatCompletionRequest) { *c.TopP = 0.1 }},
+		{"stop", func(c *ChatCompletionRequest) { c.Stop[0] = "x" }},
+		{"metadata", func(c *ChatCompletionRequest) { c.Metadata["user"] = "x" }},
+		{"few shot", func(c *ChatCompletionRequest) { c.FewShot[0].Input = "x" }},
+		{"message text", func(c *ChatCompletionRequest) { c.Messages[0].MultiContent[0].Text = "x" }},
+		{"message image", func(c *ChatCompletionRequest) { c.Messages[0].MultiContent[1].Images[0] = "x" }},
+		{"tool call", func(c *ChatCompletionRequest) { c.Messages[1].ToolCalls[0].ID = "x" }},
+		{"tool result", func(c *ChatCompletionRequest) { c.Messages[2].ToolResults[0].Result = "x" }},
+		{"tool result part", func(c *ChatCompletionRequest) { c.Messages[2].ToolResults[0].ResultParts[0].Data = "x" }},
+		{"tool parameters", func(c *ChatCompletionRequest) {
+			c.Tools[0].Function.Parameters["required"].([]interface{})[0] = "y"
+		}},
+		{"response schema", func(c *ChatCompletionRequest) { c.ResponseSchema.Schema["type"] = "array" }},
+		{"logit bias", func(c *ChatCompletionRequest) {
+			c.Extensions[OpenAIProvider].(OpenAIExtensions).LogitBias["1"] = -5
+		}},
+		{"parallel tool calls", func(c *ChatCompletionRequest) {
+			*c.Extensions[OpenAIProvider].(OpenAIExtensions).ParallelToolCalls = false
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := cloneTestRequest()
+			clone := original.Clone()
+			if !reflect.DeepEqual(clone, original) {
+				t.Fatal("clone differs from the original")
+			}
+
+			tt.mutate(&clone)
+			if !reflect.DeepEqual(original, cloneTestRequest()) {
+				t.Error("mutating the clone changed the original")
+			}
+		})
+	}
+}
+
+func TestResponseCloneDoesNotAlias(t *testing.T) {
+	original := ChatCompletionResponse{
+		Choices: []Choice{{Message: OutputMessage{
+			ToolCalls:      []ToolCall{{ID: "call_1"}},
+			ToolCallDeltas: []ToolCallDelta{{ID: "call_1"}},
+			ContentParts:   []ContentPart{{Type: ContentTypeImages, Images: []string{"aGk="}}},
+		}}},
+		RawResponse: []byte(`{}`),
+	}
+	clone := original.Clone()
+	clone.Choices[0].Message.ToolCalls[0].ID = "x"
+	clone.Choices[0].Message.ToolCallDeltas[0].ID = "x"
+	clone.Choices[0].Message.ContentParts[0].Images[0] = "x"
+	clone.RawResponse[0] = '['
+
+	if original.Choices[0].Message.ToolCalls[0].ID != "call_1" ||
+		original.Choices[0].Message.ToolCallDeltas[0].ID != "call_1" ||
+		original.Choices[0].Message.ContentParts[0].Images[0] != "aGk=" ||
+		string(original.RawResponse) != `{}` {
+		t.Errorf("mutating the clone changed the original: %+v", original)
+	}
+}
@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// defaultSamplingTemperature is used by SelfConsistency when the request does
+// not set a temperature, since identical greedy samples would make voting useless.
+const defaultSamplingTemperature = 0.7
+
+// SelfConsistency samples n completions for the request, extracts an answer
+// from each with extract and returns the most common answer. Ties are broken
+// in favor of the answer that was seen first. Empty answers are not counted.
+func SelfConsistency(ctx context.Context, llm LLM, req ChatCompletionRequest, n int, extract func(string) string) (string, error) {
+	if n < 1 {
+		return "", fmt.Errorf("self-consistency needs at least one sample, got %d", n)
+	}
+	if req.Temperature <= 0 {
+		req.Temperature = defaultSamplingTemperature
+	}
+
+	counts := make(map[string]int)
+	var order []string
+	for i := 0; i < n; i++ {
+		resp, err := llm.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return "", fmt.Errorf("sample %d failed: %w", i+1, err)
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		answer := extract(resp.Choices[0].Message.Content)
+		if answer == "" {
+			continue
+		}
+		if counts[answer] == 0 {
+			order = append(order, answer)
+		}
+		counts[answer]++
+	}
+
+	if len(order) == 0 {
+		return "", errors.New("no answer could be extracted from any sample")
+	}
+
+	best := order[0]
+	for _, answer := range order[1:] {
+		if counts[answer] > counts[best] {
+			best = answer
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// sequenceLLM answers the n-th call with the n-th answer and records the requests
+func sequenceLLM(answers []string, requests *[]ChatCompletionRequest) *stubLLM {
+	var calls int
+	return &stubLLM{complete: func(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+		*requests = append(*requests, req)
+		answer := answers[calls%len(answers)]
+		calls++
+		if answer == "error" {
+			return ChatCompletionResponse{}, errors.New("overloaded")
+		}
+		return ChatCompletionResponse{Choices: []Choice{{Message: OutputMessage{Role: RoleAssistant, Content: answer}}}}, nil
+	}}
+}
+
+func TestSelfConsistency(t *testing.T) {
+	// extract takes the text after "Answer:"
+	extract := func(content string) string {
+		_, answer, ok := strings.Cut(content, "Answer:")
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(answer)
+	}
+
+	tests := []struct {
+		name        string
+		answers     []string
+		n           int
+		temperature float32
+		want        string
+		wantErr     bool
+		wantTemp    float32
+	}{
+		{
+			name:     "majority wins",
+			answers:  []string{"Answer: 12", "Answer: 13", "Answer: 12", "Answer: 11", "Answer: 12"},
+			n:        5,
+			want:     "12",
+			wantTemp: defaultSamplingTemperature,
+		},
+		{
+			name:        "tie goes to the first answer",
+			answers:     []string{"Answer: 13", "Answer: 12", "Answer: 12", "Answer: 13"},
+			n:           4,
+			temperature: 0.3,
+			want:        "13",
+			wantTemp:    0.3,
+		},
+		{
+			name:     "unextractable samples are not counted",
+			answers:  []string{"I am not sure", "no idea", "Answer: 7"},
+			n:        3,
+			want:     "7",
+			wantTemp: defaultSamplingTemperature,
+		},
+		{
+			name:    "no answer extracted",
+			answers: []string{"I am not sure"},
+			n:       3,
+			wantErr: true,
+		},
+		{
+			name:    "failing sample",
+			answers: []string{"Answer: 1", "error"},
+			n:       3,
+			wantErr: true,
+		},
+		{
+			name:    "no samples",
+			answers: []string{"Answer: 1"},
+			n:       0,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []ChatCompletionRequest
+			req := testRequest(ModelGPT4o, "How many?")
+			req.Temperature = tt.temperature
+
+			got, err := SelfConsistency(context.Background(), sequenceLLM(tt.answers, &requests), req, tt.n, extract)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("answer = %q, want %q", got, tt.want)
+			}
+			if len(requests) != tt.n {
+				t.Errorf("sampled %d times, want %d", len(requests), tt.n)
+			}
+			for _, r := range requests {
+				if r.Temperature != tt.wantTemp {
+					t.Errorf("sampled with temperature %v, want %v", r.Temperature, tt.wantTemp)
+				}
+			}
+		})
+	}
+}
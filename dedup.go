@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"context"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// dedupLLM wraps an LLM so that concurrent identical requests share a
+// single provider call.
+type dedupLLM struct {
+	llm   LLM
+	group singleflight.Group
+}
+
+// WithDeduplication wraps llm so that when multiple goroutines issue the same
+// request concurrently only one call reaches the provider and all callers
+// receive its result. Requests are matched by their Fingerprint.
+// Streaming requests are passed through unchanged.
+func WithDeduplication(llm LLM) LLM {
+	return &dedupLLM{llm: llm}
+}
+
+// CreateChatCompletion forwards the request, coalescing it with any identical in-flight request
+func (d *dedupLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	key, err := req.Fingerprint()
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
+
+	// the shared call must not fail because the caller that started it gave up,
+	// but it keeps the caller's deadline so that it cannot hang forever
+	ch := d.group.DoChan(key, func() (interface{}, error) {
+		callCtx := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			callCtx, cancel = context.WithDeadline(callCtx, deadline)
+			defer cancel()
+		}
+		return d.llm.CreateChatCompletion(callCtx, req)
+	})
+	select {
+	case <-ctx.Done():
+		return ChatCompletionResponse{}, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return ChatCompletionResponse{}, res.Err
+		}
+		// every caller gets its own copy of the shared response
+		resp, _ := res.Val.(ChatCompletionResponse)
+		return resp.Clone(), nil
+	}
+}
+
+// CreateChatCompletionStream forwards the request; streams cannot be shared between callers
+func (d *dedupLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	return d.llm.CreateChatCompletionStream(ctx, req)
+}
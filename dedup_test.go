@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingLLM answers blocking calls once release is closed and counts them
+type blockingLLM struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (b *blockingLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	b.calls.Add(1)
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		return ChatCompletionResponse{}, ctx.Err()
+	}
+	return ChatCompletionResponse{Choices: []Choice{{
+		Message: OutputMessage{Content: "hi", ToolCalls: []ToolCall{{ID: "call_1"}}},
+	}}}, nil
+}
+
+func (b *blockingLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	return nil, errors.New("not implemented")
+}
+
+func dedupRequest() ChatCompletionRequest {
+	return ChatCompletionRequest{
+		Model:    ModelGPT4o,
+		Messages: []InputMessage{{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "hi"}}}},
+	}
+}
+
+// waitForCall waits until the first call reached the provider
+func waitForCall(t *testing.T, b *blockingLLM) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for b.calls.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the provider was not called")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDeduplicationConcurrentCalls(t *testing.T) {
+	backend := &blockingLLM{release: make(chan struct{})}
+	llm := WithDeduplication(backend)
+
+	const callers = 10
+	responses := make([]ChatCompletionResponse, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], errs[i] = llm.CreateChatCompletion(context.Background(), dedupRequest())
+		}(i)
+	}
+	waitForCall(t, backend)
+	// give the other callers time to join the in-flight call
+	time.Sleep(20 * time.Millisecond)
+	close(backend.release)
+	wg.Wait()
+
+	if calls := backend.calls.Load(); calls != 1 {
+		t.Errorf("provider called %d times, want 1", calls)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("caller %d: %v", i, err)
+		}
+	}
+	responses[0].Choices[0].Message.ToolCalls[0].ID = "modified"
+	if id := responses[1].Choices[0].Message.ToolCalls[0].ID; id != "call_1" {
+		t.Errorf("responses share their tool calls, got ID %q", id)
+	}
+}
+
+func TestDeduplicationCancelledCaller(t *testing.T) {
+	backend := &blockingLLM{release: make(chan struct{})}
+	llm := WithDeduplication(backend)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := llm.CreateChatCompletion(ctx, dedupRequest())
+		firstErr <- err
+	}()
+	waitForCall(t, backend)
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := llm.CreateChatCompletion(context.Background(), dedupRequest())
+		second <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got %v, want context.Canceled", err)
+	}
+
+	close(backend.release)
+	if err := <-second; err != nil {
+		t.Errorf("waiting caller failed with the first caller's cancellation: %v", err)
+	}
+}
+
+func TestDeduplicationKeepsDeadline(t *testing.T) {
+	// the provider never answers, only the deadline ends the shared call
+	backend := &blockingLLM{release: make(chan struct{})}
+	llm := WithDeduplication(backend)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	go func() {
+		_, _ = llm.CreateChatCompletion(ctx, dedupRequest())
+	}()
+	waitForCall(t, backend)
+
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := llm.CreateChatCompletion(context.Background(), dedupRequest())
+		waiter <- err
+	}()
+
+	select {
+	case err := <-waiter:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("waiting caller got %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the shared call outlived the deadline of the caller that started it")
+	}
+}
@@ -17,6 +17,8 @@ func NewSimpleStreamHandler() *SimpleStreamHandler {
 }
 
 type SimpleStreamHandler struct {
+	// ToolCallAccumulator assembles the arguments of tool calls while they are streamed
+	llm.ToolCallAccumulator
 	builder *strings.Builder
 }
 
@@ -24,6 +26,7 @@ type SimpleStreamHandler struct {
 func (h *SimpleStreamHandler) OnStart() {
 	fmt.Println("[SimpleStreamHandler] Stream started.")
 	h.builder.Reset()
+	h.ToolCallAccumulator.Reset()
 }
 
 // OnToken appends new tokens to an internal string builder.
@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"github.com/liushuangls/go-anthropic/v2"
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAIExtensions holds request parameters only supported by OpenAI. They
+// are set with ChatCompletionRequest.WithOpenAI and ignored by other providers.
+type OpenAIExtensions struct {
+	PresencePenalty  float32
+	FrequencyPenalty float32
+	// LogitBias maps token IDs to a bias from -100 to 100.
+	LogitBias map[string]int
+	// ParallelToolCalls allows or forbids multiple tool calls in one response.
+	ParallelToolCalls *bool
+}
+
+// ClaudeExtensions holds request parameters only supported by Claude. They
+// are set with ChatCompletionRequest.WithClaude and ignored by other providers.
+type ClaudeExtensions struct {
+	// ToolChoice is "auto", "any" to force some tool call or "tool" to force
+	// a call of the tool named ToolName. It is ignored for requests with a
+	// ResponseSchema, which force the call of the response tool.
+	ToolChoice string
+	ToolName   string
+}
+
+// WithOpenAI returns a copy of the request with the given OpenAI extensions.
+func (r ChatCompletionRequest) WithOpenAI(ext OpenAIExtensions) ChatCompletionRequest {
+	return r.withExtension(OpenAIProvider, ext)
+}
+
+// WithClaude returns a copy of the request with the given Claude extensions.
+func (r ChatCompletionRequest) WithClaude(ext ClaudeExtensions) ChatCompletionRequest {
+	return r.withExtension(ClaudeProvider, ext)
+}
+
+// withExtension sets the extension of a provider on a copy of the request,
+// the extensions of the original request are not modified
+func (r ChatCompletionRequest) withExtension(provider LLMProvider, ext any) ChatCompletionRequest {
+	extensions := make(map[LLMProvider]any, len(r.Extensions)+1)
+	for p, e := range r.Extensions {
+		extensions[p] = e
+	}
+	extensions[provider] = ext
+	r.Extensions = extensions
+	return r
+}
+
+func (e OpenAIExtensions) apply(req *openai.ChatCompletionRequest) {
+	req.PresencePenalty = e.PresencePenalty
+	req.FrequencyPenalty = e.FrequencyPenalty
+	req.LogitBias = e.LogitBias
+	if e.ParallelToolCalls != nil {
+		req.ParallelToolCalls = *e.ParallelToolCalls
+	}
+}
+
+// apply sets the extensions on req, forcedTool is set if req already forces
+// the response tool, whose choice must not be replaced
+func (e ClaudeExtensions) apply(req *anthropic.MessagesRequest, forcedTool bool) {
+	if e.ToolChoice != "" && len(req.Tools) > 0 && !forcedTool {
+		req.ToolChoice = &anthropic.ToolChoice{Type: e.ToolChoice, Name: e.ToolName}
+	}
+}
@@ -0,0 +1,147 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// captureBody decodes the JSON body of the request into body
+func captureBody(t *testing.T, r *http.Request, body *map[string]any) {
+	t.Helper()
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		t.Errorf("failed to decode request: %v", err)
+	}
+}
+
+func TestOpenAIExtensions(t *testing.T) {
+	parallel := false
+	ext := OpenAIExtensions{PresencePenalty: 0.5, FrequencyPenalty: 0.25, LogitBias: map[string]int{"50256": -100}, ParallelToolCalls: &parallel}
+	tools := []Tool{{Type: "function", Function: &Function{Name: "get_time", Parameters: map[string]any{"type": "object"}}}}
+
+	tests := []struct {
+		name     string
+		provider LLMProvider
+		want     map[string]any
+	}{
+		{
+			name:     "applied by OpenAI",
+			provider: OpenAIProvider,
+			want: map[string]any{
+				"presence_penalty":    0.5,
+				"frequency_penalty":   0.25,
+				"logit_bias":          map[string]any{"50256": -100.0},
+				"parallel_tool_calls": false,
+			},
+		},
+		{
+			name:     "ignored by Claude",
+			provider: ClaudeProvider,
+			want: map[string]any{
+				"presence_penalty":    nil,
+				"frequency_penalty":   nil,
+				"logit_bias":          nil,
+				"parallel_tool_calls": nil,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			var model LLM
+			req := testRequest(ModelGPT4o, "hi")
+			switch tt.provider {
+			case OpenAIProvider:
+				model = newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+					captureBody(t, r, &body)
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprint(w, `{"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"ok"}}]}`)
+				})
+			case ClaudeProvider:
+				req.Model = ModelClaude3Dot5SonnetLatest
+				req.MaxTokens = 100
+				model = newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+					captureBody(t, r, &body)
+					writeClaudeMessage(w, "end_turn", `{"type":"text","text":"ok"}`)
+				})
+			}
+			req.Tools = tools
+
+			if _, err := model.CreateChatCompletion(context.Background(), req.WithOpenAI(ext)); err != nil {
+				t.Fatal(err)
+			}
+			for field, want := range tt.want {
+				got, ok := body[field]
+				if want == nil {
+					if ok {
+						t.Errorf("%s = %v, want it left out", field, got)
+					}
+					continue
+				}
+				if fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Errorf("%s = %v, want %v", field, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestClaudeExtensionsToolChoice(t *testing.T) {
+	schema := &ResponseSchema{Name: "answer", Schema: map[string]any{"type": "object", "properties": map[string]any{"answer": map[string]any{"type": "string"}}}}
+	responseTool := claudeResponseToolName(schema)
+	tools := []Tool{{Type: "function", Function: &Function{Name: "get_time", Parameters: map[string]any{"type": "object"}}}}
+
+	tests := []struct {
+		name        string
+		schema      *ResponseSchema
+		ext         ClaudeExtensions
+		wantChoice  map[string]any
+		wantContent string
+	}{
+		{
+			name:        "tool choice applied",
+			ext:         ClaudeExtensions{ToolChoice: "tool", ToolName: "get_time"},
+			wantChoice:  map[string]any{"type": "tool", "name": "get_time"},
+			wantContent: "",
+		},
+		{
+			name:        "response schema keeps the response tool",
+			schema:      schema,
+			ext:         ClaudeExtensions{ToolChoice: "tool", ToolName: "get_time"},
+			wantChoice:  map[string]any{"type": "tool", "name": responseTool},
+			wantContent: `{"answer":"42"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				captureBody(t, r, &body)
+				choice, _ := body["tool_choice"].(map[string]any)
+				name, _ := choice["name"].(string)
+				writeClaudeMessage(w, "tool_use", fmt.Sprintf(`{"type":"tool_use","id":"toolu_1","name":%q,"input":{"answer":"42"}}`, name))
+			})
+
+			req := testRequest(ModelClaude3Dot5SonnetLatest, "hi")
+			req.MaxTokens = 100
+			req.Tools = tools
+			req.ResponseSchema = tt.schema
+			resp, err := c.CreateChatCompletion(context.Background(), req.WithClaude(tt.ext))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			choice, _ := body["tool_choice"].(map[string]any)
+			for k, want := range tt.wantChoice {
+				if choice[k] != want {
+					t.Errorf("tool_choice.%s = %v, want %v", k, choice[k], want)
+				}
+			}
+			if got := resp.Choices[0].Message.Content; got != tt.wantContent {
+				t.Errorf("content = %q, want %q", got, tt.wantContent)
+			}
+		})
+	}
+}
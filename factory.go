@@ -0,0 +1,64 @@
+package llm
+
+import "fmt"
+
+// ProviderCredentials holds the keys and endpoints used by NewLLMForModel.
+// Only the credentials of the providers that are used need to be set.
+type ProviderCredentials struct {
+	OpenAIAPIKey string
+	// AzureOpenAIEndpoint routes OpenAI models through Azure with OpenAIAPIKey.
+	AzureOpenAIEndpoint string
+
+	AnthropicAPIKey string
+	// VertexCredentials routes Claude models through Vertex AI instead of the
+	// Anthropic API, using VertexProjectID and VertexLocation.
+	VertexCredentials []byte
+	VertexProjectID   string
+	VertexLocation    string
+
+	GeminiAPIKey string
+}
+
+// NewLLMForModel returns a client of the provider serving model, e.g. for
+// applications that let users pick the model. The options are passed to the
+// provider's constructor.
+func NewLLMForModel(model Model, creds ProviderCredentials, opts ...ClientOption) (LLM, error) {
+	provider, ok := ProviderForModel(model)
+	if !ok {
+		return nil, fmt.Errorf("model %s is not available", model)
+	}
+
+	switch provider {
+	case OpenAIProvider:
+		if creds.OpenAIAPIKey == "" {
+			return nil, fmt.Errorf("no OpenAI API key for model %s", model)
+		}
+		if creds.AzureOpenAIEndpoint != "" {
+			return NewAzureLLM(creds.OpenAIAPIKey, creds.AzureOpenAIEndpoint, opts...), nil
+		}
+		return NewOpenAILLM(creds.OpenAIAPIKey, opts...), nil
+	case ClaudeProvider:
+		if creds.VertexCredentials != nil {
+			client := NewVertexLLM(creds.VertexCredentials, creds.VertexProjectID, creds.VertexLocation, opts...)
+			if client == nil {
+				return nil, fmt.Errorf("failed to create Vertex AI client for model %s", model)
+			}
+			return client, nil
+		}
+		if creds.AnthropicAPIKey == "" {
+			return nil, fmt.Errorf("no Anthropic API key for model %s", model)
+		}
+		return NewAnthropicLLM(creds.AnthropicAPIKey, opts...), nil
+	case GeminiProvider:
+		if creds.GeminiAPIKey == "" {
+			return nil, fmt.Errorf("no Gemini API key for model %s", model)
+		}
+		client, err := NewGeminiLLMWithOptions(creds.GeminiAPIKey, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	default:
+		return nil, fmt.Errorf("provider %s of model %s is not supported", provider, model)
+	}
+}
@@ -0,0 +1,51 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewLLMForModel(t *testing.T) {
+	creds := ProviderCredentials{OpenAIAPIKey: "sk-test", AnthropicAPIKey: "sk-ant-test", GeminiAPIKey: "gm-test"}
+	azure := ProviderCredentials{OpenAIAPIKey: "sk-test", AzureOpenAIEndpoint: "https://example.openai.azure.com"}
+
+	tests := []struct {
+		name  string
+		model Model
+		creds ProviderCredentials
+		want  LLMProvider
+		azure bool
+		// wantErr is a substring of the error, empty if a client is created
+		wantErr string
+	}{
+		{name: "openai", model: ModelGPT4o, creds: creds, want: OpenAIProvider},
+		{name: "azure", model: ModelGPT4o, creds: azure, want: OpenAIProvider, azure: true},
+		{name: "claude", model: ModelClaude3Dot5SonnetLatest, creds: creds, want: ClaudeProvider},
+		{name: "gemini", model: ModelGemini2Flash, creds: creds, want: GeminiProvider},
+		{name: "missing OpenAI key", model: ModelGPT4o, creds: ProviderCredentials{AnthropicAPIKey: "sk-ant-test"}, wantErr: "no OpenAI API key"},
+		{name: "missing Anthropic key", model: ModelClaude3Dot5SonnetLatest, creds: azure, wantErr: "no Anthropic API key"},
+		{name: "missing Gemini key", model: ModelGemini2Flash, creds: azure, wantErr: "no Gemini API key"},
+		{name: "unknown model", model: "unknown", creds: creds, wantErr: "not available"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewLLMForModel(tt.model, tt.creds)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			namer, ok := client.(ProviderNamer)
+			if !ok || namer.ProviderName() != tt.want {
+				t.Fatalf("got client %T, want one of %s", client, tt.want)
+			}
+			if o, ok := client.(*OpenAILLM); ok && o.azure != tt.azure {
+				t.Errorf("azure = %v, want %v", o.azure, tt.azure)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxFanOutConcurrency bounds the number of providers queried at once by FanOut.
+const maxFanOutConcurrency = 4
+
+// FanOutError collects the errors of all providers that failed during FanOut.
+type FanOutError struct {
+	Errors map[LLMProvider]error
+}
+
+func (e *FanOutError) Error() string {
+	providers := make([]string, 0, len(e.Errors))
+	for provider := range e.Errors {
+		providers = append(providers, string(provider))
+	}
+	sort.Strings(providers)
+
+	msgs := make([]string, len(providers))
+	for i, provider := range providers {
+		msgs[i] = fmt.Sprintf("%s: %v", provider, e.Errors[LLMProvider(provider)])
+	}
+	return "fan-out failed for " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the individual provider errors.
+func (e *FanOutError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// FanOut sends the same request to several providers concurrently and returns
+// all successful responses keyed by provider. If the request's model is not
+// served by a provider, the provider's entry in DefaultModels is used instead.
+// When any provider fails, the successful responses are still returned along
+// with a *FanOutError describing the failures.
+func FanOut(ctx context.Context, req ChatCompletionRequest, models map[LLMProvider]LLM) (map[LLMProvider]ChatCompletionResponse, error) {
+	responses := make(map[LLMProvider]ChatCompletionResponse, len(models))
+	errs := make(map[LLMProvider]error)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxFanOutConcurrency)
+
+	for provider, model := range models {
+		providerReq := req.Clone()
+		providerReq.Model = modelForProvider(req.Model, provider)
+		if providerReq.Model == "" {
+			errs[provider] = fmt.Errorf("no model available for provider %s", provider)
+			continue
+		}
+
+		wg.Add(1)
+		go func(provider LLMProvider, model LLM, req ChatCompletionRequest) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			resp, err := model.CreateChatCompletion(ctx, req)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[provider] = err
+				return
+			}
+			responses[provider] = resp
+		}(provider, model, providerReq)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return responses, &FanOutError{Errors: errs}
+	}
+	return responses, nil
+}
+
+// modelForProvider keeps the requested model if the provider serves it and
+// falls back to the provider's default model otherwise
+func modelForProvider(model Model, provider LLMProvider) Model {
+	if p, ok := ProviderForModel(model); ok && p == provider {
+		return model
+	}
+	return DefaultModels[provider]
+}
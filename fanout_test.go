@@ -0,0 +1,172 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubLLM answers blocking calls with complete
+type stubLLM struct {
+	complete func(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error)
+}
+
+func (s *stubLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	return s.complete(ctx, req)
+}
+
+func (s *stubLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	return nil, errors.New("not implemented")
+}
+
+// answerLLM answers with content and echoes the requested model in the response ID
+func answerLLM(content string) *stubLLM {
+	return &stubLLM{complete: func(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+		return ChatCompletionResponse{ID: string(req.Model), Choices: []Choice{{Message: OutputMessage{Role: RoleAssistant, Content: content}}}}, nil
+	}}
+}
+
+func TestFanOut(t *testing.T) {
+	failure := errors.New("overloaded")
+	failing := &stubLLM{complete: func(context.Context, ChatCompletionRequest) (ChatCompletionResponse, error) {
+		return ChatCompletionResponse{}, failure
+	}}
+
+	tests := []struct {
+		name       string
+		model      Model
+		models     map[LLMProvider]LLM
+		wantModels map[LLMProvider]Model
+		wantFailed []LLMProvider
+		wantErrIs  error
+	}{
+		{
+			name:  "all providers answer",
+			model: ModelClaude3Dot5HaikuLatest,
+			models: map[LLMProvider]LLM{
+				OpenAIProvider: answerLLM("openai"),
+				ClaudeProvider: answerLLM("claude"),
+				GeminiProvider: answerLLM("gemini"),
+			},
+			wantModels: map[LLMProvider]Model{
+				OpenAIProvider: DefaultModels[OpenAIProvider],
+				ClaudeProvider: ModelClaude3Dot5HaikuLatest,
+				GeminiProvider: DefaultModels[GeminiProvider],
+			},
+		},
+		{
+			name:  "a provider fails",
+			model: ModelGPT4oMini,
+			models: map[LLMProvider]LLM{
+				OpenAIProvider: answerLLM("openai"),
+				ClaudeProvider: failing,
+			},
+			wantModels: map[LLMProvider]Model{OpenAIProvider: ModelGPT4oMini},
+			wantFailed: []LLMProvider{ClaudeProvider},
+			wantErrIs:  failure,
+		},
+		{
+			name:       "provider without a model",
+			model:      ModelGPT4o,
+			models:     map[LLMProvider]LLM{"other": answerLLM("other")},
+			wantModels: map[LLMProvider]Model{},
+			wantFailed: []LLMProvider{"other"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses, err := FanOut(context.Background(), testRequest(tt.model, "hi"), tt.models)
+
+			if len(tt.wantFailed) == 0 && err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.wantFailed) > 0 {
+				var fanOutErr *FanOutError
+				if !errors.As(err, &fanOutErr) || len(fanOutErr.Errors) != len(tt.wantFailed) {
+					t.Fatalf("got error %v, want failures of %v", err, tt.wantFailed)
+				}
+				for _, provider := range tt.wantFailed {
+					if fanOutErr.Errors[provider] == nil {
+						t.Errorf("no error recorded for %s", provider)
+					}
+				}
+			}
+			if len(responses) != len(tt.wantModels) {
+				t.Fatalf("got %d responses, want %d", len(responses), len(tt.wantModels))
+			}
+			for provider, model := range tt.wantModels {
+				resp := responses[provider]
+				if resp.ID != string(model) {
+					t.Errorf("%s was sent model %q, want %q", provider, resp.ID, model)
+				}
+				if resp.Choices[0].Message.Content != string(provider) {
+					t.Errorf("response of %s is %q", provider, resp.Choices[0].Message.Content)
+				}
+			}
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("error %v does not wrap the provider's error", err)
+			}
+		})
+	}
+}
+
+func TestFanOutConcurrency(t *testing.T) {
+	models := make(map[LLMProvider]LLM)
+	var running, peak atomic.Int32
+	for _, provider := range []LLMProvider{"p1", "p2", "p3", "p4", "p5", "p6"} {
+		DefaultModels[provider] = Model(provider)
+		models[provider] = &stubLLM{complete: func(context.Context, ChatCompletionRequest) (ChatCompletionResponse, error) {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			running.Add(-1)
+			return ChatCompletionResponse{}, nil
+		}}
+	}
+	t.Cleanup(func() {
+		for provider := range models {
+			delete(DefaultModels, provider)
+		}
+	})
+
+	responses, err := FanOut(context.Background(), testRequest(ModelGPT4o, "hi"), models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != len(models) {
+		t.Errorf("got %d responses, want %d", len(responses), len(models))
+	}
+	if got := peak.Load(); got > maxFanOutConcurrency {
+		t.Errorf("%d providers were queried at once, want at most %d", got, maxFanOutConcurrency)
+	}
+}
+
+func TestFanOutOllama(t *testing.T) {
+	if OllamaProvider != "ollama" {
+		t.Fatalf("OllamaProvider = %q", OllamaProvider)
+	}
+	const model Model = "llama3.2"
+	if provider, ok := ProviderForModel(model); ok {
+		t.Fatalf("%s is registered with %s", model, provider)
+	}
+	DefaultModels[OllamaProvider] = model
+	t.Cleanup(func() { delete(DefaultModels, OllamaProvider) })
+
+	responses, err := FanOut(context.Background(), testRequest(ModelGPT4o, "hi"), map[LLMProvider]LLM{
+		OpenAIProvider: answerLLM("openai"),
+		OllamaProvider: answerLLM("ollama"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := responses[OllamaProvider].ID; got != string(model) {
+		t.Errorf("ollama was sent model %q, want its default %q", got, model)
+	}
+}
@@ -0,0 +1,106 @@
+package llm
+
+// ProviderFeatures reports which of the generic request fields a provider
+// honors. Fields it does not honor are ignored when the request is converted.
+type ProviderFeatures struct {
+	Tools          bool
+	JSONMode       bool
+	ResponseSchema bool
+	// Images, Documents and Audio report the supported input content types.
+	Images    bool
+	Documents bool
+	Audio     bool
+	TopK      bool
+	Seed      bool
+	Logprobs  bool
+	User      bool
+	Store     bool
+	Metadata  bool
+	// PromptCaching reports whether ContentPart.CacheControl is honored.
+	PromptCaching bool
+	// CachedContent reports whether ChatCompletionRequest.CachedContent is honored.
+	CachedContent bool
+}
+
+// FeatureReporter is implemented by LLMs that report the request fields they honor.
+type FeatureReporter interface {
+	Features() ProviderFeatures
+}
+
+// providerFeatures holds the features of each provider.
+var providerFeatures = map[LLMProvider]ProviderFeatures{
+	OpenAIProvider: {Tools: true, JSONMode: true, ResponseSchema: true, Images: true, Seed: true, User: true, Store: true, Metadata: true},
+	ClaudeProvider: {Tools: true, ResponseSchema: true, Images: true, Documents: true, TopK: true, User: true, PromptCaching: true},
+	GeminiProvider: {Tools: true, JSONMode: true, ResponseSchema: true, Images: true, Documents: true, TopK: true, CachedContent: true},
+}
+
+// FeaturesForProvider returns the request fields honored by the given provider.
+func FeaturesForProvider(provider LLMProvider) (ProviderFeatures, bool) {
+	features, ok := providerFeatures[provider]
+	return features, ok
+}
+
+// Features returns the request fields honored by OpenAI.
+func (o *OpenAILLM) Features() ProviderFeatures {
+	return providerFeatures[OpenAIProvider]
+}
+
+// Features returns the request fields honored by Claude.
+func (c *ClaudeLLM) Features() ProviderFeatures {
+	return providerFeatures[ClaudeProvider]
+}
+
+// Features returns the request fields honored by Gemini.
+func (g *GeminiLLM) Features() ProviderFeatures {
+	return providerFeatures[GeminiProvider]
+}
+
+// WithIgnoredFieldHandler makes the client call fn for every field of a
+// request that is set but ignored because the provider does not support it,
+// e.g. TopK for OpenAI. The field is named as in ChatCompletionRequest.
+func WithIgnoredFieldHandler(fn func(field string, provider LLMProvider)) ClientOption {
+	return func(c *clientConfig) {
+		c.conversion.onIgnoredField = fn
+	}
+}
+
+// reportIgnored passes the set fields of req that the provider ignores to onIgnoredField
+func (c conversionConfig) reportIgnored(req ChatCompletionRequest, provider LLMProvider) {
+	if c.onIgnoredField == nil {
+		return
+	}
+	for _, field := range ignoredFields(req, provider) {
+		c.onIgnoredField(field, provider)
+	}
+}
+
+// ignoredFields returns the names of the set fields of req that the provider ignores
+func ignoredFields(req ChatCompletionRequest, provider LLMProvider) []string {
+	features, ok := providerFeatures[provider]
+	if !ok {
+		return nil
+	}
+
+	checks := []struct {
+		field     string
+		set       bool
+		supported bool
+	}{
+		{"Tools", len(req.Tools) > 0, features.Tools},
+		{"JSONMode", req.JSONMode, features.JSONMode},
+		{"ResponseSchema", req.ResponseSchema != nil, features.ResponseSchema},
+		{"TopK", req.TopK != nil, features.TopK},
+		{"Seed", req.Seed != nil, features.Seed},
+		{"User", req.User != "", features.User},
+		{"Store", req.Store != nil, features.Store},
+		{"Metadata", len(req.Metadata) > 0, features.Metadata},
+		{"CachedContent", req.CachedContent != "", features.CachedContent},
+	}
+	var fields []string
+	for _, c := range checks {
+		if c.set && !c.supported {
+			fields = append(fields, c.field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,103 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestFeatures(t *testing.T) {
+	tests := []struct {
+		llm      FeatureReporter
+		provider LLMProvider
+		// honored and ignored are checked against the reported features
+		honored []string
+		ignored []string
+	}{
+		{&OpenAILLM{}, OpenAIProvider, []string{"Tools", "JSONMode", "Images", "Seed", "Store", "Metadata"}, []string{"Documents", "TopK", "PromptCaching", "CachedContent"}},
+		{&ClaudeLLM{}, ClaudeProvider, []string{"Tools", "Images", "Documents", "TopK", "User", "PromptCaching"}, []string{"JSONMode", "Seed", "Store", "CachedContent"}},
+		{&GeminiLLM{}, GeminiProvider, []string{"Tools", "JSONMode", "Documents", "TopK", "CachedContent"}, []string{"Seed", "User", "Store", "PromptCaching"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.provider), func(t *testing.T) {
+			features := tt.llm.Features()
+			if want, ok := FeaturesForProvider(tt.provider); !ok || features != want {
+				t.Errorf("Features() = %+v, FeaturesForProvider = %+v", features, want)
+			}
+
+			flags := map[string]bool{
+				"Tools": features.Tools, "JSONMode": features.JSONMode, "Images": features.Images,
+				"Documents": features.Documents, "TopK": features.TopK, "Seed": features.Seed,
+				"User": features.User, "Store": features.Store, "Metadata": features.Metadata,
+				"PromptCaching": features.PromptCaching, "CachedContent": features.CachedContent,
+			}
+			for _, name := range tt.honored {
+				if !flags[name] {
+					t.Errorf("%s is not reported as honored", name)
+				}
+			}
+			for _, name := range tt.ignored {
+				if flags[name] {
+					t.Errorf("%s is reported as honored", name)
+				}
+			}
+		})
+	}
+
+	if _, ok := FeaturesForProvider("unknown"); ok {
+		t.Error("found features of an unknown provider")
+	}
+}
+
+func TestIgnoredFields(t *testing.T) {
+	seed, topK, store := 42, 5, true
+	req := testRequest(ModelGPT4o, "hi")
+	req.Seed = &seed
+	req.TopK = &topK
+	req.Store = &store
+	req.JSONMode = true
+	req.User = "user-1"
+	req.Metadata = map[string]string{"run": "1"}
+	req.CachedContent = "cachedContents/1"
+
+	tests := []struct {
+		provider LLMProvider
+		want     []string
+	}{
+		{OpenAIProvider, []string{"TopK", "CachedContent"}},
+		{ClaudeProvider, []string{"JSONMode", "Seed", "Store", "Metadata", "CachedContent"}},
+		{GeminiProvider, []string{"Seed", "User", "Store", "Metadata"}},
+		{"unknown", nil},
+	}
+	for _, tt := range tests {
+		if got := ignoredFields(req, tt.provider); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ignored fields for %s = %v, want %v", tt.provider, got, tt.want)
+		}
+	}
+	if got := ignoredFields(testRequest(ModelGPT4o, "hi"), ClaudeProvider); got != nil {
+		t.Errorf("ignored fields of a plain request = %v, want none", got)
+	}
+}
+
+func TestClaudeIgnoredFieldHandler(t *testing.T) {
+	var ignored []string
+	c := newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		writeClaudeMessage(w, "end_turn", `{"type":"text","text":"ok"}`)
+	}, WithIgnoredFieldHandler(func(field string, provider LLMProvider) {
+		ignored = append(ignored, fmt.Sprintf("%s/%s", provider, field))
+	}))
+
+	seed := 42
+	req := testRequest(ModelClaude3Dot5SonnetLatest, "hi")
+	req.Seed = &seed
+	req.Metadata = map[string]string{"run": "1"}
+	if _, err := c.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"claude/Seed", "claude/Metadata"}
+	if !reflect.DeepEqual(ignored, want) {
+		t.Errorf("ignored fields = %v, want %v", ignored, want)
+	}
+}
@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Fingerprint returns a stable hash of the request which can be used as a
+// cache or deduplication key. Two requests with the same content always
+// produce the same fingerprint.
+func (r ChatCompletionRequest) Fingerprint() (string, error) {
+	// encoding/json sorts map keys, so tool parameters hash deterministically
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint request: %w", err)
+	}
+	h := sha256.New()
+	h.Write(data)
+
+	// extensions are not serialized with the request, so they are hashed by provider in a fixed order
+	providers := make([]string, 0, len(r.Extensions))
+	for provider := range r.Extensions {
+		providers = append(providers, string(provider))
+	}
+	sort.Strings(providers)
+	for _, provider := range providers {
+		ext, err := json.Marshal(r.Extensions[LLMProvider(provider)])
+		if err != nil {
+			return "", fmt.Errorf("failed to fingerprint %s extensions: %w", provider, err)
+		}
+		h.Write([]byte("\x00" + provider + "\x00"))
+		h.Write(ext)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
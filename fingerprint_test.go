@@ -0,0 +1,48 @@
+package llm
+
+import "testing"
+
+func TestFingerprintExtensions(t *testing.T) {
+	base := ChatCompletionRequest{
+		Model:    ModelGPT4o,
+		Messages: []InputMessage{{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "hi"}}}},
+	}
+	parallel := false
+
+	tests := []struct {
+		name string
+		a, b ChatCompletionRequest
+		same bool
+	}{
+		{"identical", base, base, true},
+		{"same extensions", base.WithOpenAI(OpenAIExtensions{PresencePenalty: 1}), base.WithOpenAI(OpenAIExtensions{PresencePenalty: 1}), true},
+		{"extension added", base, base.WithOpenAI(OpenAIExtensions{PresencePenalty: 1}), false},
+		{"penalty differs", base.WithOpenAI(OpenAIExtensions{PresencePenalty: 1}), base.WithOpenAI(OpenAIExtensions{PresencePenalty: 2}), false},
+		{"logit bias differs", base.WithOpenAI(OpenAIExtensions{LogitBias: map[string]int{"1": 5}}), base.WithOpenAI(OpenAIExtensions{LogitBias: map[string]int{"1": -5}}), false},
+		{"parallel tool calls differs", base.WithOpenAI(OpenAIExtensions{}), base.WithOpenAI(OpenAIExtensions{ParallelToolCalls: &parallel}), false},
+		{"tool choice differs", base.WithClaude(ClaudeExtensions{ToolChoice: "auto"}), base.WithClaude(ClaudeExtensions{ToolChoice: "any"}), false},
+		{"provider differs", base.WithOpenAI(OpenAIExtensions{}), base.WithClaude(ClaudeExtensions{}), false},
+		{
+			"order of providers",
+			base.WithOpenAI(OpenAIExtensions{PresencePenalty: 1}).WithClaude(ClaudeExtensions{ToolChoice: "any"}),
+			base.WithClaude(ClaudeExtensions{ToolChoice: "any"}).WithOpenAI(OpenAIExtensions{PresencePenalty: 1}),
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := tt.a.Fingerprint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := tt.b.Fingerprint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (a == b) != tt.same {
+				t.Errorf("fingerprints equal = %v, want %v", a == b, tt.same)
+			}
+		})
+	}
+}
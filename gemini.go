@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/generative-ai-go/genai"
 	"google.golang.org/api/iterator"
@@ -17,7 +19,10 @@ import (
 
 // GeminiLLM implements the LLM interface for Google's Gemini
 type GeminiLLM struct {
-	client *genai.Client
+	client     *genai.Client
+	options    GeminiOptions
+	timeout    time.Duration
+	conversion conversionConfig
 }
 
 // GeminiOptions contains configuration options for the Gemini model
@@ -25,24 +30,82 @@ type GeminiOptions struct {
 	Model          string
 	HarmThreshold  genai.HarmBlockThreshold
 	SafetySettings []*genai.SafetySetting
+	// GenerationConfig is passed through to every request, e.g. to set TopK.
+	// CandidateCount is always 1 since requests are sent as chat messages.
+	// Fields set in the ChatCompletionRequest take precedence, a zero Temperature
+	// or MaxTokens counts as unset.
+	GenerationConfig *genai.GenerationConfig
+}
+
+// WithGeminiOptions applies Gemini specific options such as the generation config to a Gemini client
+func WithGeminiOptions(opts GeminiOptions) ClientOption {
+	return func(c *clientConfig) {
+		c.geminiOptions = &opts
+	}
 }
 
 // NewGeminiLLM creates a new Gemini LLM client
 func NewGeminiLLM(apiKey string, opts ...GeminiOptions) (*GeminiLLM, error) {
+	var clientOpts []ClientOption
+	for _, o := range opts {
+		clientOpts = append(clientOpts, WithGeminiOptions(o))
+	}
+	return NewGeminiLLMWithOptions(apiKey, clientOpts...)
+}
+
+// NewGeminiLLMWithOptions creates a new Gemini LLM client configured with
+// client options such as WithTLSConfig or WithGeminiOptions
+func NewGeminiLLMWithOptions(apiKey string, opts ...ClientOption) (*GeminiLLM, error) {
+	cfg := newClientConfig(opts)
+
+	clientOpts := []option.ClientOption{option.WithAPIKey(apiKey)}
+	if httpClient := cfg.httpClient(); httpClient != nil {
+		// a custom HTTP client replaces the API key authentication, so the key is sent as a header instead
+		httpClient.Transport = &geminiAPIKeyTransport{apiKey: apiKey, base: httpClient.Transport}
+		clientOpts = append(clientOpts, option.WithHTTPClient(httpClient))
+	}
+
 	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	client, err := genai.NewClient(ctx, clientOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
 	}
 
-	return &GeminiLLM{
-		client: client,
-	}, nil
+	llm := &GeminiLLM{
+		client:     client,
+		timeout:    cfg.timeout,
+		conversion: cfg.conversion,
+	}
+	if cfg.geminiOptions != nil {
+		llm.options = *cfg.geminiOptions
+	}
+	return llm, nil
+}
+
+// geminiAPIKeyTransport authenticates requests made with a custom HTTP client
+type geminiAPIKeyTransport struct {
+	apiKey string
+	base   http.RoundTripper
+}
+
+func (t *geminiAPIKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("x-goog-api-key", t.apiKey)
+	return t.base.RoundTrip(req)
+}
+
+// applyOptions configures the model with the client's generation options
+func (g *GeminiLLM) applyOptions(model *genai.GenerativeModel) {
+	if g.options.GenerationConfig != nil {
+		model.GenerationConfig = *g.options.GenerationConfig
+	}
 }
 
 // convertToGeminiMessages converts our generic Message type to Gemini's content type
 func convertToGeminiMessages(messages []InputMessage) []genai.Content {
 	var contents []genai.Content
+	// functionNames maps the IDs of the tool calls so far to their function names
+	functionNames := make(map[string]string)
 
 	for _, msg := range messages {
 		parts := convertToGeminiParts(msg.MultiContent)
@@ -51,19 +114,28 @@ func convertToGeminiMessages(messages []InputMessage) []genai.Content {
 		switch msg.Role {
 		case RoleTool:
 			// For tool results, treat them as user content with a function response
-			if len(msg.ToolResults) > 0 {
-				tr := msg.ToolResults[0]
+			// Parallel calls are answered by one function response per call
+			var media []genai.Part
+			for _, tr := range msg.ToolResults {
+				// Gemini pairs the response with its call by the function name
+				name := tr.FunctionName
+				if name == "" {
+					name = functionNames[tr.ToolCallID]
+				}
 				response := map[string]any{
 					"response": map[string]any{
-						"name":    tr.FunctionName,
+						"name":    name,
 						"content": tr.Result,
 					},
 				}
 				parts = append(parts, genai.FunctionResponse{
-					Name:     tr.ToolCallID,
+					Name:     name,
 					Response: response,
 				})
+				// media is not allowed inside a function response, so it follows as separate parts
+				media = append(media, convertToGeminiParts(tr.ResultParts)...)
 			}
+			parts = append(parts, media...)
 			content.Role = "user"
 		case RoleAssistant:
 			content.Role = "model"
@@ -77,6 +149,7 @@ func convertToGeminiMessages(messages []InputMessage) []genai.Content {
 		if msg.Role == RoleAssistant && len(msg.ToolCalls) > 0 {
 			// We'll store them as if the assistant invoked a function
 			for _, tc := range msg.ToolCalls {
+				functionNames[tc.ID] = tc.Function.Name
 				argsJSON := make(map[string]any)
 				_ = json.Unmarshal([]byte(tc.Function.Arguments), &argsJSON)
 				call := genai.FunctionCall{
@@ -100,7 +173,7 @@ func convertToGeminiParts(content []ContentPart) []genai.Part {
 		switch part.Type {
 		case ContentTypeText:
 			multiContent = append(multiContent, genai.Text(part.Text))
-		case ContentTypeImage:
+		case ContentTypeImage, ContentTypeDocument:
 			imageBytes, err := base64.StdEncoding.DecodeString(part.Data)
 			if err != nil {
 				continue // Skip if decoding fails
@@ -122,35 +195,10 @@ func convertToGeminiTools(tools []Tool) []*genai.Tool {
 
 	geminiTools := make([]*genai.Tool, len(tools))
 	for i, tool := range tools {
-		schema := &genai.Schema{
-			Type: genai.TypeObject,
-		}
-
-		schema.Properties = make(map[string]*genai.Schema)
-
-		if properties, ok := tool.Function.Parameters["properties"].(map[string]interface{}); ok {
-			for name, prop := range properties {
-				if propMap, ok := prop.(map[string]interface{}); ok {
-					propSchema := &genai.Schema{}
-					if typ, ok := propMap["type"].(string); ok {
-						propSchema.Type = convertSchemaType(typ)
-					}
-					if desc, ok := propMap["description"].(string); ok {
-						propSchema.Description = desc
-					}
-					schema.Properties[name] = propSchema
-				}
-			}
-		}
-
-		if required, ok := tool.Function.Parameters["required"].([]interface{}); ok {
-			reqFields := make([]string, len(required))
-			for i, r := range required {
-				if str, ok := r.(string); ok {
-					reqFields[i] = str
-				}
-			}
-			schema.Required = reqFields
+		schema := convertToGeminiSchema(tool.Function.Parameters)
+		schema.Type = genai.TypeObject
+		if schema.Properties == nil {
+			schema.Properties = make(map[string]*genai.Schema)
 		}
 
 		geminiTools[i] = &genai.Tool{
@@ -166,6 +214,62 @@ func convertToGeminiTools(tools []Tool) []*genai.Tool {
 	return geminiTools
 }
 
+// convertToGeminiSchema converts a JSON Schema map to Gemini's schema type
+func convertToGeminiSchema(schema map[string]interface{}) *genai.Schema {
+	s := &genai.Schema{}
+	if typ, ok := schema["type"].(string); ok {
+		s.Type = convertSchemaType(typ)
+	}
+	if desc, ok := schema["description"].(string); ok {
+		s.Description = desc
+	}
+	if format, ok := schema["format"].(string); ok {
+		s.Format = format
+	}
+	if nullable, ok := schema["nullable"].(bool); ok {
+		s.Nullable = nullable
+	}
+	s.Enum = toStringSlice(schema["enum"])
+	s.Required = toStringSlice(schema["required"])
+
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		s.Items = convertToGeminiSchema(items)
+	}
+
+	switch properties := schema["properties"].(type) {
+	case map[string]interface{}:
+		s.Properties = make(map[string]*genai.Schema, len(properties))
+		for name, prop := range properties {
+			if propMap, ok := prop.(map[string]interface{}); ok {
+				s.Properties[name] = convertToGeminiSchema(propMap)
+			}
+		}
+	case OrderedProperties:
+		s.Properties = make(map[string]*genai.Schema, len(properties))
+		for _, prop := range properties {
+			s.Properties[prop.Name] = convertToGeminiSchema(prop.Schema)
+		}
+	}
+	return s
+}
+
+// toStringSlice accepts both []string and []interface{} as found in JSON Schema maps
+func toStringSlice(v interface{}) []string {
+	switch val := v.(type) {
+	case []string:
+		return val
+	case []interface{}:
+		strs := make([]string, 0, len(val))
+		for _, item := range val {
+			if str, ok := item.(string); ok {
+				strs = append(strs, str)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
 // convertSchemaType converts a JSON Schema type to Gemini schema type
 func convertSchemaType(typ string) genai.Type {
 	switch typ {
@@ -193,6 +297,7 @@ func convertFromGeminiToolCalls(parts []genai.Part) []ToolCall {
 		if fc, ok := part.(genai.FunctionCall); ok {
 			args, _ := json.Marshal(fc.Args)
 			calls = append(calls, ToolCall{
+				ID:   syntheticToolCallID(len(calls), fc.Name, string(args)),
 				Type: "function",
 				Function: ToolCallFunction{
 					Name:      fc.Name,
@@ -206,21 +311,30 @@ func convertFromGeminiToolCalls(parts []genai.Part) []ToolCall {
 
 // CreateChatCompletion implements the LLM interface for Gemini (non-streaming).
 func (g *GeminiLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	ctx, cancel := withRequestTimeout(ctx, g.timeout)
+	defer cancel()
 	if !g.isSupported(req.Model) {
 		return ChatCompletionResponse{}, fmt.Errorf("model %s is not supported", req.Model)
 	}
+	if err := validateRequestSize(req, GeminiProvider); err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	if err := g.conversion.validate(req, GeminiProvider); err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	g.conversion.reportIgnored(req, GeminiProvider)
+	req, err := Normalize(req, GeminiProvider)
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	if err := validateGeminiCachedContent(req); err != nil {
+		return ChatCompletionResponse{}, err
+	}
 
 	modelName := string(req.Model)
 	model := g.client.GenerativeModel(modelName)
-
-	// Set system prompt if provided
-	if req.SystemPrompt != nil {
-		model.SystemInstruction = &genai.Content{
-			Parts: []genai.Part{
-				genai.Text(*req.SystemPrompt),
-			},
-		}
-	}
+	model.CachedContentName = req.CachedContent
+	g.applyOptions(model)
 
 	setModelConfig(model, req)
 
@@ -235,48 +349,82 @@ func (g *GeminiLLM) CreateChatCompletion(ctx context.Context, req ChatCompletion
 	chatSession := model.StartChat()
 	loadChatSession(chatSession, geminiMessages[:len(geminiMessages)-1])
 	newMessage := geminiMessages[len(geminiMessages)-1]
+	ctx, raw := withRawResponseCapture(ctx)
 	resp, err := chatSession.SendMessage(ctx, newMessage.Parts...)
 	if err != nil {
+		var blockedErr *genai.BlockedError
+		if errors.As(err, &blockedErr) && blockedErr.PromptFeedback != nil {
+			return ChatCompletionResponse{}, fmt.Errorf("prompt was blocked by Gemini: %s", blockedErr.PromptFeedback.BlockReason)
+		}
+		// the library reports a filtered output as an error, it is a response with its finish reason instead
+		if errors.As(err, &blockedErr) && blockedErr.Candidate != nil {
+			return ChatCompletionResponse{
+				Choices:     []Choice{convertFromGeminiCandidate(blockedErr.Candidate, 0, g.conversion.textPartSeparator)},
+				RawResponse: raw.json(),
+			}, nil
+		}
 		return ChatCompletionResponse{}, fmt.Errorf("failed to generate content: %v", err)
 	}
 
+	// When the prompt is blocked entirely there are no candidates, only the feedback
+	if len(resp.Candidates) == 0 {
+		if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != genai.BlockReasonUnspecified {
+			return ChatCompletionResponse{}, fmt.Errorf("prompt was blocked by Gemini: %s", resp.PromptFeedback.BlockReason)
+		}
+		return ChatCompletionResponse{}, errors.New("gemini returned no candidates")
+	}
+
 	// Convert response to our format
 	choices := make([]Choice, len(resp.Candidates))
 	for i, c := range resp.Candidates {
-		choices[i] = convertFromGeminiCandidate(c, i)
+		choices[i] = convertFromGeminiCandidate(c, i, g.conversion.textPartSeparator)
 	}
 
 	response := ChatCompletionResponse{
-		Choices: choices,
+		Choices:     choices,
+		RawResponse: raw.json(),
 	}
 
 	if resp.UsageMetadata != nil {
 		response.Usage = Usage{
-			PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
-			CompletionTokens: int(resp.UsageMetadata.CandidatesTokenCount),
-			TotalTokens:      int(resp.UsageMetadata.TotalTokenCount),
+			PromptTokens:       int(resp.UsageMetadata.PromptTokenCount),
+			CompletionTokens:   int(resp.UsageMetadata.CandidatesTokenCount),
+			TotalTokens:        int(resp.UsageMetadata.TotalTokenCount),
+			CachedPromptTokens: int(resp.UsageMetadata.CachedContentTokenCount),
 		}
 	}
 
 	return response, nil
 }
 
-func convertFromGeminiCandidate(c *genai.Candidate, index int) Choice {
+// convertFromGeminiCandidate converts a candidate to a Choice, joining its text parts with separator
+func convertFromGeminiCandidate(c *genai.Candidate, index int, separator string) Choice {
 	msg := OutputMessage{
 		Role:    RoleAssistant,
 		Content: "",
 	}
 	var textParts []string
-	for _, part := range c.Content.Parts {
+	// a filtered candidate may have no content
+	var parts []genai.Part
+	if c.Content != nil {
+		parts = c.Content.Parts
+	}
+	for _, part := range parts {
 		switch p := part.(type) {
 		case genai.Text:
 			textParts = append(textParts, string(p))
+			msg.ContentParts = append(msg.ContentParts, ContentPart{Type: ContentTypeText, Text: string(p)})
+		case genai.Blob:
+			if part, ok := convertFromGeminiBlob(p); ok {
+				msg.ContentParts = append(msg.ContentParts, part)
+			}
 		case genai.FunctionCall:
 			args, err := json.Marshal(p.Args)
 			if err != nil {
 				continue
 			}
 			msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+				ID:   syntheticToolCallID(len(msg.ToolCalls), p.Name, string(args)),
 				Type: "function",
 				Function: ToolCallFunction{
 					Name:      p.Name,
@@ -285,39 +433,165 @@ func convertFromGeminiCandidate(c *genai.Candidate, index int) Choice {
 			})
 		}
 	}
-	msg.Content = strings.Join(textParts, "")
+	msg.Content = strings.Join(textParts, separator)
 
 	return Choice{
-		Index:        index,
-		Message:      msg,
-		FinishReason: FinishReason(c.FinishReason),
+		Index:           index,
+		Message:         msg,
+		FinishReason:    convertFromGeminiFinishReason(c.FinishReason, len(msg.ToolCalls) > 0),
+		RawFinishReason: c.FinishReason.String(),
+	}
+}
+
+// convertFromGeminiFinishReason maps a Gemini finish reason; Gemini reports tool calls as a regular stop
+func convertFromGeminiFinishReason(reason genai.FinishReason, hasToolCalls bool) FinishReason {
+	switch reason {
+	case genai.FinishReasonStop:
+		if hasToolCalls {
+			return FinishReasonToolCalls
+		}
+		return FinishReasonStop
+	case genai.FinishReasonSafety:
+		return FinishReasonContentFilter
+	case genai.FinishReasonMaxTokens:
+		return FinishReasonMaxTokens
+	case genai.FinishReasonUnspecified:
+		return FinishReasonNull
+	default:
+		return FinishReasonOther
+	}
+}
+
+// convertFromGeminiBlob converts generated inline media to a base64 encoded ContentPart
+func convertFromGeminiBlob(blob genai.Blob) (ContentPart, bool) {
+	var contentType ContentType
+	switch {
+	case strings.HasPrefix(blob.MIMEType, "image/"):
+		contentType = ContentTypeImage
+	case strings.HasPrefix(blob.MIMEType, "audio/"):
+		contentType = ContentTypeAudio
+	default:
+		return ContentPart{}, false
 	}
+	return ContentPart{
+		Type:      contentType,
+		Data:      base64.StdEncoding.EncodeToString(blob.Data),
+		MediaType: blob.MIMEType,
+	}, true
 }
 
+// setModelConfig configures the model for the request, shared by the
+// blocking and streaming paths
 func setModelConfig(model *genai.GenerativeModel, req ChatCompletionRequest) {
+	// Set system prompt if provided
+	if systemPrompt, ok := req.systemPromptText(); ok {
+		model.SystemInstruction = &genai.Content{
+			Parts: []genai.Part{
+				genai.Text(systemPrompt),
+			},
+		}
+	}
 
-	// https://cloud.google.com/vertex-ai/generative-ai/docs/learn/prompts/adjust-parameter-values
-	// Default value is not 0. It's safer to set the temperature to a small non zero value to avoid the initial value from being lost when marshalled/unmarshalled when sending over an API
-	if req.Temperature > 0 {
-		model.SetTemperature(float32(req.Temperature))
-	} else {
-		model.SetTemperature(math.SmallestNonzeroFloat32)
+	// the request is normalized, so a zero temperature is already replaced by a
+	// small non zero value, which counts as unset if the generation config sets one
+	if model.Temperature == nil || req.Temperature > math.SmallestNonzeroFloat32 {
+		model.SetTemperature(req.Temperature)
 	}
 
 	if req.TopP != nil && *req.TopP > 0 {
 		model.SetTopP(*req.TopP)
 	}
 
-	model.SetMaxOutputTokens(int32(req.MaxTokens))
+	if req.TopK != nil {
+		model.SetTopK(int32(*req.TopK))
+	}
+
+	if len(req.Stop) > 0 {
+		model.StopSequences = req.Stop
+	}
+
+	if req.MaxTokens > 0 {
+		model.SetMaxOutputTokens(int32(req.MaxTokens))
+	}
 
 	if req.JSONMode {
 		model.ResponseMIMEType = "application/json"
 	}
 
+	// controlled generation forces the output to match the schema
+	if req.ResponseSchema != nil {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = convertToGeminiSchema(req.ResponseSchema.Schema)
+	}
+
 	geminiTools := convertToGeminiTools(req.Tools)
 	model.Tools = geminiTools
 }
 
+// CacheRef references content cached by Gemini, see GeminiLLM.CreateCachedContent.
+type CacheRef struct {
+	// Name is set as ChatCompletionRequest.CachedContent to use the cached content.
+	Name       string
+	Model      Model
+	ExpireTime time.Time
+}
+
+// CreateCachedContent caches a system prompt and content, e.g. a large
+// document, for the given model for ttl, so that requests referencing it in
+// CachedContent are billed at a reduced rate for these tokens. This is
+// Gemini's counterpart to Claude's prompt caching. Gemini requires a minimum
+// amount of cached tokens and rejects requests that set a system prompt or
+// tools in addition to cached content.
+func (g *GeminiLLM) CreateCachedContent(ctx context.Context, model Model, systemPrompt string, content []ContentPart, ttl time.Duration) (CacheRef, error) {
+	if !g.isSupported(model) {
+		return CacheRef{}, fmt.Errorf("model %s is not supported", model)
+	}
+
+	cc := &genai.CachedContent{
+		Model:      string(model),
+		Expiration: genai.ExpireTimeOrTTL{TTL: ttl},
+	}
+	if systemPrompt != "" {
+		cc.SystemInstruction = genai.NewUserContent(genai.Text(systemPrompt))
+	}
+	if parts := convertToGeminiParts(content); len(parts) > 0 {
+		cc.Contents = []*genai.Content{genai.NewUserContent(parts...)}
+	}
+
+	created, err := g.client.CreateCachedContent(ctx, cc)
+	if err != nil {
+		return CacheRef{}, fmt.Errorf("failed to create cached content: %w", err)
+	}
+	return CacheRef{Name: created.Name, Model: model, ExpireTime: created.Expiration.ExpireTime}, nil
+}
+
+// DeleteCachedContent deletes cached content before it expires.
+func (g *GeminiLLM) DeleteCachedContent(ctx context.Context, ref CacheRef) error {
+	if err := g.client.DeleteCachedContent(ctx, ref.Name); err != nil {
+		return fmt.Errorf("failed to delete cached content %s: %w", ref.Name, err)
+	}
+	return nil
+}
+
+// validateGeminiCachedContent rejects what Gemini does not allow alongside cached content
+func validateGeminiCachedContent(req ChatCompletionRequest) error {
+	if req.CachedContent == "" {
+		return nil
+	}
+	if _, ok := req.systemPromptText(); ok {
+		return fmt.Errorf("a system prompt cannot be combined with cached content %s, cache it instead", req.CachedContent)
+	}
+	if len(req.Tools) > 0 {
+		return fmt.Errorf("tools cannot be combined with cached content %s", req.CachedContent)
+	}
+	return nil
+}
+
+// ProviderName returns GeminiProvider
+func (g *GeminiLLM) ProviderName() LLMProvider {
+	return GeminiProvider
+}
+
 // isSupported checks if the given model is recognized as a valid Gemini model
 func (g *GeminiLLM) isSupported(model Model) bool {
 	switch model {
@@ -334,6 +608,8 @@ type geminiStreamWrapper struct {
 	done                 bool
 	accumulatedText      string     // aggregator for text so far
 	accumulatedToolCalls []ToolCall // aggregator for tool calls so far
+	usage                Usage      // latest usage reported by Gemini, sent with the final chunk
+	received             bool       // set once a candidate was received
 }
 
 // Recv returns the next partial or final ChatCompletionResponse from Gemini.
@@ -343,11 +619,31 @@ func (w *geminiStreamWrapper) Recv() (ChatCompletionResponse, error) {
 	}
 
 	resp, err := w.iter.Next()
+	var blockedErr *genai.BlockedError
+	if errors.As(err, &blockedErr) && blockedErr.Candidate != nil {
+		// the library reports a filtered output as an error, it ends the stream with its finish reason instead
+		resp, err = &genai.GenerateContentResponse{Candidates: []*genai.Candidate{blockedErr.Candidate}}, nil
+	}
 	if err != nil {
 		if errors.Is(err, iterator.Done) {
+			if !w.received {
+				return ChatCompletionResponse{}, errors.New("gemini returned no candidates")
+			}
 			return ChatCompletionResponse{}, io.EOF
 		}
-		return ChatCompletionResponse{}, err
+		if errors.As(err, &blockedErr) && blockedErr.PromptFeedback != nil {
+			err = fmt.Errorf("prompt was blocked by Gemini: %s", blockedErr.PromptFeedback.BlockReason)
+		}
+		return ChatCompletionResponse{}, newStreamError(err, w.accumulatedText, w.accumulatedToolCalls)
+	}
+
+	if resp.UsageMetadata != nil {
+		w.usage = Usage{
+			PromptTokens:       int(resp.UsageMetadata.PromptTokenCount),
+			CompletionTokens:   int(resp.UsageMetadata.CandidatesTokenCount),
+			TotalTokens:        int(resp.UsageMetadata.TotalTokenCount),
+			CachedPromptTokens: int(resp.UsageMetadata.CachedContentTokenCount),
+		}
 	}
 
 	if len(resp.Candidates) == 0 {
@@ -366,11 +662,16 @@ func (w *geminiStreamWrapper) Recv() (ChatCompletionResponse, error) {
 
 	// We'll only handle the first candidate for partial streaming.
 	candidate := resp.Candidates[0]
+	w.received = true
 	var newText string
 	var newToolCalls []ToolCall
 
 	// 1. Extract text/tool calls from this partial
-	for _, part := range candidate.Content.Parts {
+	var parts []genai.Part
+	if candidate.Content != nil {
+		parts = candidate.Content.Parts
+	}
+	for _, part := range parts {
 		switch p := part.(type) {
 		case genai.Text:
 			newText += string(p)
@@ -409,36 +710,18 @@ func (w *geminiStreamWrapper) Recv() (ChatCompletionResponse, error) {
 			}
 		}
 		if isNew {
+			tc.ID = syntheticToolCallID(len(w.accumulatedToolCalls), tc.Function.Name, tc.Function.Arguments)
 			deltaCalls = append(deltaCalls, tc)
 			w.accumulatedToolCalls = append(w.accumulatedToolCalls, tc)
 		}
 	}
 
 	// 4. Determine finish reason
-	fr := FinishReasonNull
-	switch candidate.FinishReason {
-	case genai.FinishReasonStop:
-		if len(w.accumulatedToolCalls) > 0 {
-			fr = FinishReasonToolCalls
-			w.done = true
-		} else {
-			fr = FinishReasonStop
-			w.done = true
-		}
-	case genai.FinishReasonSafety:
-		// The gemini library might block or produce partial or final
-		// We'll treat those like a stop with an error or just "stop"
-		fr = FinishReasonStop
-		w.done = true
-	case genai.FinishReasonMaxTokens:
-		fr = FinishReasonMaxTokens
-		w.done = true
-	case genai.FinishReasonUnspecified:
-		fr = FinishReasonNull
-		w.done = false
-	default:
-		err = fmt.Errorf("unknown finish reason: %v", candidate.FinishReason)
-		panic(err)
+	fr := convertFromGeminiFinishReason(candidate.FinishReason, len(w.accumulatedToolCalls) > 0)
+	w.done = fr != FinishReasonNull
+	var rawFinishReason string
+	if w.done {
+		rawFinishReason = candidate.FinishReason.String()
 	}
 
 	// 5. Construct the partial chunk response
@@ -451,10 +734,14 @@ func (w *geminiStreamWrapper) Recv() (ChatCompletionResponse, error) {
 					Content:   deltaContent,
 					ToolCalls: deltaCalls,
 				},
-				FinishReason: fr,
+				FinishReason:    fr,
+				RawFinishReason: rawFinishReason,
 			},
 		},
 	}
+	if w.done {
+		chunk.Usage = w.usage
+	}
 
 	return chunk, nil
 }
@@ -470,12 +757,34 @@ func (w *geminiStreamWrapper) Close() error {
 
 // CreateChatCompletionStream implements the LLM interface for Gemini streaming
 func (g *GeminiLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	return withStreamTimeout(ctx, g.timeout, func(ctx context.Context) (ChatCompletionStream, error) {
+		return g.createChatCompletionStream(ctx, req)
+	})
+}
+
+func (g *GeminiLLM) createChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
 	if !g.isSupported(req.Model) {
 		return nil, fmt.Errorf("model %s is not supported", req.Model)
 	}
+	if err := validateRequestSize(req, GeminiProvider); err != nil {
+		return nil, err
+	}
+	if err := g.conversion.validate(req, GeminiProvider); err != nil {
+		return nil, err
+	}
+	g.conversion.reportIgnored(req, GeminiProvider)
+	req, err := Normalize(req, GeminiProvider)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateGeminiCachedContent(req); err != nil {
+		return nil, err
+	}
 
 	modelName := string(req.Model)
 	model := g.client.GenerativeModel(modelName)
+	model.CachedContentName = req.CachedContent
+	g.applyOptions(model)
 
 	setModelConfig(model, req)
 
@@ -496,7 +805,7 @@ func (g *GeminiLLM) CreateChatCompletionStream(ctx context.Context, req ChatComp
 }
 
 func loadChatSession(chatSession *genai.ChatSession, geminiMessages []genai.Content) {
-	if len(geminiMessages) > 1 {
+	if len(geminiMessages) > 0 {
 		historyPtr := make([]*genai.Content, len(geminiMessages))
 		for i := 0; i < len(geminiMessages); i++ {
 			historyPtr[i] = &geminiMessages[i]
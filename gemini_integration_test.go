@@ -0,0 +1,59 @@
+//go:build integration
+
+package llm
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGeminiCachedContentIntegration creates cached content with the Gemini
+// API and references it from a request. Run it with
+//
+//	GEMINI_API_KEY=... go test -tags integration -run Integration
+func TestGeminiCachedContentIntegration(t *testing.T) {
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		t.Skip("GEMINI_API_KEY is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	g, err := NewGeminiLLM(apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Gemini only caches content above a minimum token count
+	document := strings.Repeat("The lighthouse keeper logs the weather every hour. ", 4000) +
+		"The secret word is marmalade."
+	ref, err := g.CreateCachedContent(ctx, ModelGemini2Flash, "Answer questions about the document.",
+		[]ContentPart{{Type: ContentTypeText, Text: document}}, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := g.DeleteCachedContent(context.Background(), ref); err != nil {
+			t.Errorf("failed to delete the cached content: %v", err)
+		}
+	})
+	if ref.Name == "" || ref.Model != ModelGemini2Flash || !ref.ExpireTime.After(time.Now()) {
+		t.Fatalf("cache ref = %+v", ref)
+	}
+
+	req := testRequest(ModelGemini2Flash, "What is the secret word? Answer with the word only.")
+	req.CachedContent = ref.Name
+	resp, err := g.CreateChatCompletion(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Choices[0].Message.Content; !strings.Contains(strings.ToLower(got), "marmalade") {
+		t.Errorf("answer = %q, want the secret word from the cached document", got)
+	}
+	if resp.Usage.CachedPromptTokens == 0 {
+		t.Errorf("usage = %+v, want cached prompt tokens", resp.Usage)
+	}
+}
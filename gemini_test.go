@@ -0,0 +1,653 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// functionResponses returns the function responses among the parts
+func functionResponses(parts []genai.Part) []genai.FunctionResponse {
+	var responses []genai.FunctionResponse
+	for _, part := range parts {
+		if fr, ok := part.(genai.FunctionResponse); ok {
+			responses = append(responses, fr)
+		}
+	}
+	return responses
+}
+
+func TestGeminiToolRoundTrip(t *testing.T) {
+	// Gemini calls two functions in parallel, the calls get synthetic IDs
+	calls := convertFromGeminiToolCalls([]genai.Part{
+		genai.FunctionCall{Name: "get_weather", Args: map[string]any{"city": "Paris"}},
+		genai.FunctionCall{Name: "get_time", Args: map[string]any{"zone": "CET"}},
+	})
+	if len(calls) != 2 || calls[0].ID == "" || calls[0].ID == calls[1].ID {
+		t.Fatalf("tool calls = %+v, want two calls with distinct IDs", calls)
+	}
+
+	messages := []InputMessage{
+		{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "weather and time in Paris?"}}},
+		{Role: RoleAssistant, ToolCalls: calls},
+		{Role: RoleTool, ToolResults: []ToolResult{
+			{ToolCallID: calls[0].ID, Result: "sunny"},
+			{ToolCallID: calls[1].ID, Result: "12:00", ResultParts: []ContentPart{{Type: ContentTypeImage, Data: "aGk=", MediaType: "image/png"}}},
+		}},
+	}
+	contents := convertToGeminiMessages(messages)
+	if len(contents) != 3 {
+		t.Fatalf("got %d contents, want 3", len(contents))
+	}
+
+	var sentCalls []string
+	for _, part := range contents[1].Parts {
+		if fc, ok := part.(genai.FunctionCall); ok {
+			sentCalls = append(sentCalls, fc.Name)
+		}
+	}
+	if want := []string{"get_weather", "get_time"}; !reflect.DeepEqual(sentCalls, want) {
+		t.Errorf("function calls = %v, want %v", sentCalls, want)
+	}
+
+	responses := functionResponses(contents[2].Parts)
+	if len(responses) != 2 {
+		t.Fatalf("got %d function responses, want one per call: %+v", len(responses), contents[2].Parts)
+	}
+	for i, want := range []string{"get_weather", "get_time"} {
+		if responses[i].Name != want {
+			t.Errorf("response %d is named %q, want %q", i, responses[i].Name, want)
+		}
+	}
+	if _, ok := contents[2].Parts[len(contents[2].Parts)-1].(genai.Blob); !ok {
+		t.Errorf("media of a tool result does not follow the function responses: %+v", contents[2].Parts)
+	}
+}
+
+func TestGeminiFunctionResponseName(t *testing.T) {
+	call := ToolCall{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "get_weather", Arguments: `{}`}}
+
+	tests := []struct {
+		name   string
+		result ToolResult
+		want   string
+	}{
+		{"function name of the result", ToolResult{ToolCallID: "call_1", FunctionName: "get_weather", Result: "sunny"}, "get_weather"},
+		{"function name of the call", ToolResult{ToolCallID: "call_1", Result: "sunny"}, "get_weather"},
+		{"explicit name wins", ToolResult{ToolCallID: "call_1", FunctionName: "lookup", Result: "sunny"}, "lookup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents := convertToGeminiMessages([]InputMessage{
+				{Role: RoleAssistant, ToolCalls: []ToolCall{call}},
+				{Role: RoleTool, ToolResults: []ToolResult{tt.result}},
+			})
+			responses := functionResponses(contents[1].Parts)
+			if len(responses) != 1 {
+				t.Fatalf("got %d function responses, want 1", len(responses))
+			}
+			if responses[0].Name != tt.want {
+				t.Errorf("Name = %q, want %q; the tool call ID must not be used", responses[0].Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertFromGeminiFinishReason(t *testing.T) {
+	tests := []struct {
+		reason       genai.FinishReason
+		hasToolCalls bool
+		want         FinishReason
+	}{
+		{genai.FinishReasonStop, false, FinishReasonStop},
+		{genai.FinishReasonStop, true, FinishReasonToolCalls},
+		{genai.FinishReasonSafety, false, FinishReasonContentFilter},
+		{genai.FinishReasonMaxTokens, false, FinishReasonMaxTokens},
+		{genai.FinishReasonUnspecified, false, FinishReasonNull},
+		{genai.FinishReasonRecitation, false, FinishReasonOther},
+	}
+	for _, tt := range tests {
+		if got := convertFromGeminiFinishReason(tt.reason, tt.hasToolCalls); got != tt.want {
+			t.Errorf("convertFromGeminiFinishReason(%v, %v) = %q, want %q", tt.reason, tt.hasToolCalls, got, tt.want)
+		}
+	}
+}
+
+// newTestGeminiLLM returns a client sending its requests to handler. Gemini
+// answers streams with a JSON array of responses and encodes enums as numbers.
+func newTestGeminiLLM(t *testing.T, handler http.HandlerFunc) *GeminiLLM {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client, err := genai.NewClient(context.Background(),
+		option.WithAPIKey("test"), option.WithEndpoint(srv.URL), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return &GeminiLLM{client: client}
+}
+
+// writeGeminiResponses writes the responses as a streamed JSON array, which
+// the library also reads for blocking chat messages
+func writeGeminiResponses(w http.ResponseWriter, responses ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "[%s]", strings.Join(responses, ","))
+}
+
+func TestGeminiSafetyStop(t *testing.T) {
+	g := newTestGeminiLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		writeGeminiResponses(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"partial"}]},"finishReason":3}]}`)
+	})
+
+	resp, err := g.CreateChatCompletion(context.Background(), testRequest(ModelGemini2Flash, "hi"))
+	if err != nil {
+		t.Fatalf("a filtered output is not an error: %v", err)
+	}
+	if got := resp.Choices[0].FinishReason; got != FinishReasonContentFilter {
+		t.Errorf("finish reason = %q, want %q", got, FinishReasonContentFilter)
+	}
+	if got := resp.Choices[0].Message.Content; got != "partial" {
+		t.Errorf("content = %q, want the output before the filter", got)
+	}
+}
+
+// filterHandler records whether OnContentFilter was called
+type filterHandler struct {
+	recordingHandler
+	filtered bool
+}
+
+func (h *filterHandler) OnContentFilter() { h.filtered = true }
+
+func TestGeminiStreamContentFilter(t *testing.T) {
+	g := newTestGeminiLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		writeGeminiResponses(w,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}]}`,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":3}]}`,
+		)
+	})
+
+	handler := &filterHandler{}
+	if err := StreamChatCompletion(context.Background(), testRequest(ModelGemini2Flash, "hi"), handler, g); err != nil {
+		t.Fatalf("a filtered stream is not an error: %v", err)
+	}
+	if !handler.filtered {
+		t.Error("OnContentFilter was not called")
+	}
+	if handler.complete == nil || handler.complete.Content != "Hello" {
+		t.Errorf("completed with %+v, want the output before the filter", handler.complete)
+	}
+}
+
+func TestGeminiStreamBlockedPrompt(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []string
+		want      string
+	}{
+		{
+			name:      "blocked prompt",
+			responses: []string{`{"promptFeedback":{"blockReason":1}}`},
+			want:      "prompt was blocked by Gemini: BlockReasonSafety",
+		},
+		{
+			name:      "blocked prompt with other reason",
+			responses: []string{`{"promptFeedback":{"blockReason":2}}`},
+			want:      "prompt was blocked by Gemini: BlockReasonOther",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGeminiLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				writeGeminiResponses(w, tt.responses...)
+			})
+
+			handler := &recordingHandler{}
+			err := StreamChatCompletion(context.Background(), testRequest(ModelGemini2Flash, "hi"), handler, g)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got error %v, want %q", err, tt.want)
+			}
+			if handler.complete != nil {
+				t.Errorf("stream completed with %+v", handler.complete)
+			}
+		})
+	}
+}
+
+func TestNewGeminiLLMOptions(t *testing.T) {
+	candidates := int32(2)
+	config := &genai.GenerationConfig{CandidateCount: &candidates}
+
+	tests := []struct {
+		name   string
+		create func() (*GeminiLLM, error)
+	}{
+		{"gemini options", func() (*GeminiLLM, error) {
+			return NewGeminiLLM("test", GeminiOptions{GenerationConfig: config})
+		}},
+		{"client options", func() (*GeminiLLM, error) {
+			return NewGeminiLLMWithOptions("test", WithGeminiOptions(GeminiOptions{GenerationConfig: config}))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := tt.create()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer g.client.Close()
+
+			model := g.client.GenerativeModel(string(ModelGemini2Flash))
+			g.applyOptions(model)
+			if model.CandidateCount == nil || *model.CandidateCount != candidates {
+				t.Errorf("CandidateCount = %v, want %d", model.CandidateCount, candidates)
+			}
+		})
+	}
+}
+
+func TestGeminiSyntheticToolCallIDs(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []genai.Part
+		want  []string
+	}{
+		{
+			name:  "single call",
+			parts: []genai.Part{genai.FunctionCall{Name: "get_weather", Args: map[string]any{"city": "Paris"}}},
+			want:  []string{"get_weather"},
+		},
+		{
+			name: "same function with different arguments",
+			parts: []genai.Part{
+				genai.FunctionCall{Name: "get_weather", Args: map[string]any{"city": "Paris"}},
+				genai.FunctionCall{Name: "get_weather", Args: map[string]any{"city": "Rome"}},
+			},
+			want: []string{"get_weather", "get_weather"},
+		},
+		{
+			name: "identical calls",
+			parts: []genai.Part{
+				genai.Text("checking"),
+				genai.FunctionCall{Name: "get_time", Args: map[string]any{}},
+				genai.FunctionCall{Name: "get_time", Args: map[string]any{}},
+			},
+			want: []string{"get_time", "get_time"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidate := &genai.Candidate{Content: &genai.Content{Role: "model", Parts: tt.parts}, FinishReason: genai.FinishReasonStop}
+
+			calls := convertFromGeminiCandidate(candidate, 0, "").Message.ToolCalls
+			if len(calls) != len(tt.want) {
+				t.Fatalf("got %d tool calls, want %d", len(calls), len(tt.want))
+			}
+			seen := make(map[string]bool)
+			for _, tc := range calls {
+				if tc.ID == "" || seen[tc.ID] {
+					t.Errorf("tool call IDs are empty or not unique: %+v", calls)
+				}
+				seen[tc.ID] = true
+			}
+
+			// the same response always yields the same IDs
+			if again := convertFromGeminiCandidate(candidate, 0, "").Message.ToolCalls; !reflect.DeepEqual(again, calls) {
+				t.Errorf("converting again returned %+v, want %+v", again, calls)
+			}
+			if fromParts := convertFromGeminiToolCalls(tt.parts); !reflect.DeepEqual(fromParts, calls) {
+				t.Errorf("convertFromGeminiToolCalls returned %+v, want %+v", fromParts, calls)
+			}
+
+			// the IDs match the tool results to the calls when the conversation continues
+			var results []ToolResult
+			for _, tc := range calls {
+				results = append(results, ToolResult{ToolCallID: tc.ID, Result: "ok"})
+			}
+			contents := convertToGeminiMessages([]InputMessage{
+				{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "hi"}}},
+				{Role: RoleAssistant, ToolCalls: calls},
+				{Role: RoleTool, ToolResults: results},
+			})
+			var names []string
+			for _, fr := range functionResponses(contents[len(contents)-1].Parts) {
+				names = append(names, fr.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("function responses = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeminiChatHistory(t *testing.T) {
+	user := func(text string) InputMessage {
+		return InputMessage{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: text}}}
+	}
+	assistant := func(text string) InputMessage {
+		return InputMessage{Role: RoleAssistant, MultiContent: []ContentPart{{Type: ContentTypeText, Text: text}}}
+	}
+
+	tests := []struct {
+		name     string
+		messages []InputMessage
+		want     []string
+	}{
+		{"single message", []InputMessage{user("hi")}, []string{"user:hi"}},
+		{"two messages", []InputMessage{assistant("How can I help?"), user("hi")}, []string{"model:How can I help?", "user:hi"}},
+		{"three messages", []InputMessage{user("hi"), assistant("hello"), user("bye")}, []string{"user:hi", "model:hello", "user:bye"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent struct {
+				Contents []struct {
+					Role  string `json:"role"`
+					Parts []struct {
+						Text string `json:"text"`
+					} `json:"parts"`
+				} `json:"contents"`
+			}
+			g := newTestGeminiLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				// a filtered candidate ends the response early, before the closing bracket
+				// of the array, which the library fails to parse under recent Go versions
+				writeGeminiResponses(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":3}]}`)
+			})
+
+			req := ChatCompletionRequest{Model: ModelGemini2Flash, Messages: tt.messages}
+			if _, err := g.CreateChatCompletion(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, c := range sent.Contents {
+				for _, p := range c.Parts {
+					got = append(got, c.Role+":"+p.Text)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent contents %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeminiGenerationConfig(t *testing.T) {
+	maxTokens, topK := int32(256), int32(20)
+	temperature, topP := float32(0.7), float32(0.5)
+	config := &genai.GenerationConfig{
+		TopK:            &topK,
+		MaxOutputTokens: &maxTokens,
+		Temperature:     &temperature,
+		TopP:            &topP,
+	}
+
+	tests := []struct {
+		name        string
+		temperature float32
+		maxTokens   int
+		want        map[string]any
+	}{
+		{
+			name: "config passed through",
+			want: map[string]any{"topK": 20.0, "maxOutputTokens": 256.0, "temperature": 0.7, "topP": 0.5},
+		},
+		{
+			name:        "request fields take precedence",
+			temperature: 0.2,
+			maxTokens:   64,
+			want:        map[string]any{"topK": 20.0, "maxOutputTokens": 64.0, "temperature": 0.2, "topP": 0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent struct {
+				GenerationConfig map[string]any `json:"generationConfig"`
+			}
+			g := newTestGeminiLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				// a filtered candidate ends the response before the closing bracket, see TestGeminiChatHistory
+				writeGeminiResponses(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":3}]}`)
+			})
+			g.options.GenerationConfig = config
+
+			req := testRequest(ModelGemini2Flash, "hi")
+			req.Temperature = tt.temperature
+			req.MaxTokens = tt.maxTokens
+			if _, err := g.CreateChatCompletion(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			for field, want := range tt.want {
+				got, ok := sent.GenerationConfig[field].(float64)
+				if !ok || math.Abs(got-want.(float64)) > 1e-6 {
+					t.Errorf("generationConfig.%s = %v, want %v", field, sent.GenerationConfig[field], want)
+				}
+			}
+			if *config.MaxOutputTokens != maxTokens || *config.Temperature != temperature {
+				t.Error("the request modified the client's generation config")
+			}
+		})
+	}
+}
+
+func TestGeminiResponseSchemaRoundTrip(t *testing.T) {
+	type forecast struct {
+		City  string   `json:"city"`
+		TempC int      `json:"temp_c"`
+		Tags  []string `json:"tags"`
+	}
+	schema := &ResponseSchema{Name: "forecast", Schema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"city":   map[string]any{"type": "string"},
+			"temp_c": map[string]any{"type": "integer"},
+			"tags":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+		"required": []string{"city", "temp_c"},
+	}}
+	want := forecast{City: "Paris", TempC: 21, Tags: []string{"sunny"}}
+
+	var sent struct {
+		GenerationConfig struct {
+			ResponseMIMEType string         `json:"responseMimeType"`
+			ResponseSchema   map[string]any `json:"responseSchema"`
+		} `json:"generationConfig"`
+	}
+	g := newTestGeminiLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		// Gemini streams the JSON in pieces
+		writeGeminiResponses(w,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"{\"city\":\"Paris\","}]}}]}`,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"\"temp_c\":21,\"tags\":[\"sunny\"]}"}]},"finishReason":1}]}`,
+		)
+	})
+
+	// the blocking path reads the whole response array, whose closing bracket
+	// the library fails to parse under recent Go versions, so the stream is used
+	req := testRequest(ModelGemini2Flash, "weather in Paris?")
+	req.ResponseSchema = schema
+	handler := &recordingHandler{}
+	if err := StreamChatCompletion(context.Background(), req, handler, g); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent.GenerationConfig.ResponseMIMEType != "application/json" {
+		t.Errorf("responseMimeType = %q, want application/json", sent.GenerationConfig.ResponseMIMEType)
+	}
+	props, _ := sent.GenerationConfig.ResponseSchema["properties"].(map[string]any)
+	for _, name := range []string{"city", "temp_c", "tags"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("responseSchema lacks property %s: %v", name, sent.GenerationConfig.ResponseSchema)
+		}
+	}
+	if required := fmt.Sprint(sent.GenerationConfig.ResponseSchema["required"]); required != "[city temp_c]" {
+		t.Errorf("responseSchema required = %s, want [city temp_c]", required)
+	}
+
+	var got forecast
+	if err := json.Unmarshal([]byte(handler.complete.Content), &got); err != nil {
+		t.Fatalf("content %q is not the structured output: %v", handler.complete.Content, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+}
+
+func TestConvertFromGeminiCandidateInlineData(t *testing.T) {
+	png := []byte("\x89PNG\r\n")
+	c := &genai.Candidate{
+		Content: &genai.Content{Role: "model", Parts: []genai.Part{
+			genai.Text("Here is the image."),
+			genai.Blob{MIMEType: "image/png", Data: png},
+			genai.Blob{MIMEType: "audio/wav", Data: []byte("RIFF")},
+			// media other than images and audio is ignored
+			genai.Blob{MIMEType: "application/pdf", Data: []byte("%PDF")},
+		}},
+		FinishReason: genai.FinishReasonStop,
+	}
+
+	msg := convertFromGeminiCandidate(c, 0, "").Message
+	want := []ContentPart{
+		{Type: ContentTypeText, Text: "Here is the image."},
+		{Type: ContentTypeImage, MediaType: "image/png", Data: base64.StdEncoding.EncodeToString(png)},
+		{Type: ContentTypeAudio, MediaType: "audio/wav", Data: base64.StdEncoding.EncodeToString([]byte("RIFF"))},
+	}
+	if !reflect.DeepEqual(msg.ContentParts, want) {
+		t.Errorf("content parts = %+v, want %+v", msg.ContentParts, want)
+	}
+	if msg.Content != "Here is the image." {
+		t.Errorf("content = %q, want only the text", msg.Content)
+	}
+}
+
+func TestGeminiStreamUsage(t *testing.T) {
+	g := newTestGeminiLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		writeGeminiResponses(w,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":1,"totalTokenCount":5}}`,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":1}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"totalTokenCount":6}}`,
+		)
+	})
+
+	stream, err := g.CreateChatCompletionStream(context.Background(), testRequest(ModelGemini2Flash, "hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	first, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Usage != (Usage{}) {
+		t.Errorf("first chunk usage = %+v, want usage only on the final chunk", first.Usage)
+	}
+	final, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.Choices[0].FinishReason != FinishReasonStop {
+		t.Fatalf("finish reason = %q, want the final chunk", final.Choices[0].FinishReason)
+	}
+	want := Usage{PromptTokens: 4, CompletionTokens: 2, TotalTokens: 6}
+	if final.Usage != want {
+		t.Errorf("final chunk usage = %+v, want %+v", final.Usage, want)
+	}
+}
+
+// TestGeminiCachedContent covers referencing cached content, creating it
+// goes through gRPC and is covered by the integration test
+func TestGeminiCachedContent(t *testing.T) {
+	var streamed map[string]any
+	g := newTestGeminiLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&streamed); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		writeGeminiResponses(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"marmalade"}]},"finishReason":1}]}`)
+	})
+
+	req := testRequest(ModelGemini2Flash, "What is the secret word?")
+	req.CachedContent = "cachedContents/abc"
+	stream, err := g.CreateChatCompletionStream(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if streamed["cachedContent"] != req.CachedContent {
+		t.Errorf("cachedContent = %v, want %q", streamed["cachedContent"], req.CachedContent)
+	}
+
+	system := "Be brief."
+	req.SystemPrompt = &system
+	if _, err := g.CreateChatCompletionStream(context.Background(), req); err == nil {
+		t.Error("a system prompt was combined with cached content")
+	}
+}
+
+func TestGeminiStreamSystemInstruction(t *testing.T) {
+	var sent struct {
+		SystemInstruction *struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"systemInstruction"`
+		Contents []struct {
+			Role string `json:"role"`
+		} `json:"contents"`
+	}
+	g := newTestGeminiLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		writeGeminiResponses(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"Bonjour"}]},"finishReason":1}]}`)
+	})
+
+	system := "Answer in French."
+	req := testRequest(ModelGemini2Flash, "hi")
+	req.SystemPrompt = &system
+	handler := &recordingHandler{}
+	if err := StreamChatCompletion(context.Background(), req, handler, g); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent.SystemInstruction == nil || len(sent.SystemInstruction.Parts) != 1 || sent.SystemInstruction.Parts[0].Text != system {
+		t.Fatalf("system instruction = %+v, want %q", sent.SystemInstruction, system)
+	}
+	for i, c := range sent.Contents {
+		if c.Role != "user" && c.Role != "model" {
+			t.Errorf("content %d has role %q, the system prompt must not be sent as a message", i, c.Role)
+		}
+	}
+}
+
+func TestConvertFromGeminiCandidateTextPartSeparator(t *testing.T) {
+	c := &genai.Candidate{
+		Content:      &genai.Content{Role: "model", Parts: []genai.Part{genai.Text("Hello"), genai.Text("World")}},
+		FinishReason: genai.FinishReasonStop,
+	}
+	for sep, want := range map[string]string{"": "HelloWorld", "\n": "Hello\nWorld"} {
+		if got := convertFromGeminiCandidate(c, 0, sep).Message.Content; got != want {
+			t.Errorf("content with separator %q = %q, want %q", sep, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// jsonFieldParser incrementally scans a streamed JSON object and reports each
+// top-level field as soon as its value is complete. Text before the opening
+// brace (e.g. a markdown fence) is ignored.
+type jsonFieldParser struct {
+	onField func(path string, value json.RawMessage)
+
+	depth    int
+	inString bool
+	escaped  bool
+	inKey    bool
+	inValue  bool
+	key      []byte
+	value    []byte
+}
+
+func newJSONFieldParser(onField func(path string, value json.RawMessage)) *jsonFieldParser {
+	return &jsonFieldParser{onField: onField}
+}
+
+// Write feeds the next streamed token into the parser
+func (p *jsonFieldParser) Write(token string) {
+	for i := 0; i < len(token); i++ {
+		p.writeByte(token[i])
+	}
+}
+
+func (p *jsonFieldParser) writeByte(c byte) {
+	if p.inString {
+		if p.inKey {
+			p.key = append(p.key, c)
+		} else {
+			p.value = append(p.value, c)
+		}
+
+		switch {
+		case p.escaped:
+			p.escaped = false
+		case c == '\\':
+			p.escaped = true
+		case c == '"':
+			p.inString = false
+			p.inKey = false
+		}
+		return
+	}
+
+	switch {
+	case p.depth == 0:
+		if c == '{' {
+			p.depth = 1
+		}
+	case p.depth == 1 && !p.inValue:
+		switch c {
+		case '"':
+			p.inString = true
+			p.inKey = true
+			p.key = append(p.key[:0], c)
+		case ':':
+			p.inValue = true
+			p.value = p.value[:0]
+		case '}':
+			p.depth = 0
+		}
+	default:
+		p.writeValueByte(c)
+	}
+}
+
+func (p *jsonFieldParser) writeValueByte(c byte) {
+	switch c {
+	case '"':
+		p.inString = true
+	case '{', '[':
+		p.depth++
+	case '}', ']':
+		if p.depth == 1 {
+			// closing brace of the top-level object ends the last field
+			p.emit()
+			p.depth = 0
+			return
+		}
+		p.depth--
+	case ',':
+		if p.depth == 1 {
+			p.emit()
+			return
+		}
+	}
+	p.value = append(p.value, c)
+}
+
+func (p *jsonFieldParser) emit() {
+	p.inValue = false
+
+	var key string
+	if err := json.Unmarshal(p.key, &key); err != nil {
+		return
+	}
+	value := bytes.TrimSpace(p.value)
+	if !json.Valid(value) {
+		return
+	}
+	p.onField(key, append(json.RawMessage(nil), value...))
+}
@@ -0,0 +1,120 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// jsonFieldRecorder is a StreamHandler recording its JSON field events
+type jsonFieldRecorder struct {
+	recordingHandler
+	fields []string
+}
+
+func (h *jsonFieldRecorder) OnJSONField(path string, value json.RawMessage) {
+	h.fields = append(h.fields, path+"="+string(value))
+}
+
+func TestJSONFieldParser(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+		want   []string
+	}{
+		{
+			name:   "whole object in one token",
+			tokens: []string{`{"name":"Ada","age":36}`},
+			want:   []string{`name="Ada"`, `age=36`},
+		},
+		{
+			name:   "keys and values split across tokens",
+			tokens: []string{`{"na`, `me": "A`, `da", "a`, `ge"`, `: 3`, `6}`},
+			want:   []string{`name="Ada"`, `age=36`},
+		},
+		{
+			name:   "nested values",
+			tokens: []string{`{"user":{"name":"Ada","tags":["a","b"]},`, `"ok":true}`},
+			want:   []string{`user={"name":"Ada","tags":["a","b"]}`, `ok=true`},
+		},
+		{
+			name:   "structural characters inside strings",
+			tokens: []string{`{"text":"a, {b} [c] \"d\"","n":null}`},
+			want:   []string{`text="a, {b} [c] \"d\""`, `n=null`},
+		},
+		{
+			name:   "escaped quote in key",
+			tokens: []string{`{"say \"hi\"":1}`},
+			want:   []string{`say "hi"=1`},
+		},
+		{
+			name:   "markdown fence around the object",
+			tokens: []string{"```json\n", `{"a":1,`, "\n  \"b\": [1, 2]\n}", "\n```"},
+			want:   []string{`a=1`, `b=[1, 2]`},
+		},
+		{
+			name:   "empty object",
+			tokens: []string{`{}`},
+			want:   nil,
+		},
+		{
+			name:   "incomplete last field",
+			tokens: []string{`{"a":1,"b":"unfinish`},
+			want:   []string{`a=1`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			p := newJSONFieldParser(func(path string, value json.RawMessage) {
+				got = append(got, path+"="+string(value))
+			})
+			for _, token := range tt.tokens {
+				p.Write(token)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fields = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamChatCompletionJSONFields(t *testing.T) {
+	tokens := []string{`{"title":`, `"Report",`, `"items":[1,`, `2]`, `,"done":true}`}
+
+	tests := []struct {
+		name     string
+		jsonMode bool
+		schema   *ResponseSchema
+		want     []string
+	}{
+		{"json mode", true, nil, []string{`title="Report"`, `items=[1,2]`, `done=true`}},
+		{"response schema", false, &ResponseSchema{Name: "report"}, []string{`title="Report"`, `items=[1,2]`, `done=true`}},
+		{"plain text", false, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunks []ChatCompletionResponse
+			for i, token := range tokens {
+				var finish FinishReason
+				if i == len(tokens)-1 {
+					finish = FinishReasonStop
+				}
+				chunks = append(chunks, textChunk(token, finish))
+			}
+			model := &scriptedLLM{streams: []*scriptedStream{{chunks: chunks}}}
+			handler := &jsonFieldRecorder{}
+
+			req := testRequest(ModelGPT4o, "report")
+			req.JSONMode = tt.jsonMode
+			req.ResponseSchema = tt.schema
+			if err := StreamChatCompletion(context.Background(), req, handler, model); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(handler.fields, tt.want) {
+				t.Errorf("fields = %q, want %q", handler.fields, tt.want)
+			}
+		})
+	}
+}
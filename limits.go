@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"  // registers the GIF header decoder
+	_ "image/jpeg" // registers the JPEG header decoder
+	_ "image/png"  // registers the PNG header decoder
+	"strings"
+)
+
+// ProviderLimits describes the request size limits enforced by a provider.
+type ProviderLimits struct {
+	// MaxImages is the maximum number of images in a single request.
+	MaxImages int
+	// MaxImageBytes is the maximum decoded size of a single image.
+	MaxImageBytes int
+	// MaxImageDimension is the maximum width and height of a single image in
+	// pixels, or 0 if larger images are scaled down by the provider.
+	MaxImageDimension int
+	// MaxRequestBytes is the maximum size of the request payload.
+	MaxRequestBytes int
+}
+
+// providerLimits holds the documented limits of each provider.
+var providerLimits = map[LLMProvider]ProviderLimits{
+	OpenAIProvider: {MaxImages: 500, MaxImageBytes: 20 << 20, MaxRequestBytes: 50 << 20},
+	ClaudeProvider: {MaxImages: 100, MaxImageBytes: 5 << 20, MaxImageDimension: 8000, MaxRequestBytes: 32 << 20},
+	GeminiProvider: {MaxImages: 3600, MaxImageBytes: 20 << 20, MaxRequestBytes: 20 << 20},
+}
+
+// LimitsForProvider returns the request size limits of the given provider.
+func LimitsForProvider(provider LLMProvider) (ProviderLimits, bool) {
+	limits, ok := providerLimits[provider]
+	return limits, ok
+}
+
+// validateRequestSize checks the image count and estimated payload size of the
+// request against the provider's limits before anything is sent
+func validateRequestSize(req ChatCompletionRequest, provider LLMProvider) error {
+	limits, ok := providerLimits[provider]
+	if !ok {
+		return nil
+	}
+
+	var images, size int
+	// addParts counts the images and bytes of content parts, where names them in errors
+	addParts := func(where string, parts []ContentPart) error {
+		for _, part := range parts {
+			switch part.Type {
+			case ContentTypeText:
+				size += len(part.Text)
+			case ContentTypeImage:
+				images++
+				if err := validateImage(where, part.Data, provider, limits); err != nil {
+					return err
+				}
+				// images are sent base64 encoded
+				size += len(part.Data)
+			case ContentTypeImages:
+				for _, data := range part.Images {
+					images++
+					if err := validateImage(where, data, provider, limits); err != nil {
+						return err
+					}
+					size += len(data)
+				}
+			case ContentTypeDocument:
+				size += len(part.Data)
+			}
+		}
+		return nil
+	}
+
+	if req.SystemPrompt != nil {
+		size += len(*req.SystemPrompt)
+	}
+	if err := addParts("system content", req.SystemContent); err != nil {
+		return err
+	}
+
+	for i, msg := range req.Messages {
+		if err := addParts(fmt.Sprintf("message %d", i), msg.MultiContent); err != nil {
+			return err
+		}
+		for _, tc := range msg.ToolCalls {
+			size += len(tc.Function.Arguments)
+		}
+		for _, tr := range msg.ToolResults {
+			size += len(tr.Result)
+			if err := addParts(fmt.Sprintf("the result of tool call %s in message %d", tr.ToolCallID, i), tr.ResultParts); err != nil {
+				return err
+			}
+		}
+	}
+
+	if images > limits.MaxImages {
+		return fmt.Errorf("request contains %d images, %s allows at most %d", images, provider, limits.MaxImages)
+	}
+	if size > limits.MaxRequestBytes {
+		return fmt.Errorf("request is about %d bytes, %s allows at most %d bytes", size, provider, limits.MaxRequestBytes)
+	}
+	return nil
+}
+
+// validateImage checks the size and dimensions of the base64 encoded image in
+// where, e.g. "message 2", against the provider's limits. Only the image
+// header is decoded; images of unknown formats are checked by size only.
+func validateImage(where string, data string, provider LLMProvider, limits ProviderLimits) error {
+	imageBytes := base64.StdEncoding.DecodedLen(len(data))
+	if imageBytes > limits.MaxImageBytes {
+		return fmt.Errorf("image in %s is %d bytes, %s allows at most %d bytes per image",
+			where, imageBytes, provider, limits.MaxImageBytes)
+	}
+	if limits.MaxImageDimension == 0 {
+		return nil
+	}
+
+	config, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)))
+	if err != nil {
+		return nil
+	}
+	if config.Width > limits.MaxImageDimension || config.Height > limits.MaxImageDimension {
+		return fmt.Errorf("image in %s is %dx%d pixels, %s allows at most %d pixels per side",
+			where, config.Width, config.Height, provider, limits.MaxImageDimension)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// testPNG returns a base64 encoded PNG of the given size
+func testPNG(t *testing.T, width, height int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestValidateRequestSize(t *testing.T) {
+	small := testPNG(t, 10, 10)
+	wide := testPNG(t, 8001, 10)
+	// base64 data decoding to more than Claude's 5 MB per image
+	large := strings.Repeat("A", 8<<20)
+
+	images := func(n int) []ContentPart {
+		parts := make([]ContentPart, n)
+		for i := range parts {
+			parts[i] = ContentPart{Type: ContentTypeImage, Data: small, MediaType: "image/png"}
+		}
+		return parts
+	}
+	toolMessage := func(parts []ContentPart) InputMessage {
+		return InputMessage{Role: RoleTool, ToolResults: []ToolResult{{ToolCallID: "call_1", Result: "ok", ResultParts: parts}}}
+	}
+	userMessage := InputMessage{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "hi"}}}
+
+	tests := []struct {
+		name    string
+		req     ChatCompletionRequest
+		wantErr string
+	}{
+		{
+			name: "within limits",
+			req:  ChatCompletionRequest{SystemContent: images(1), Messages: []InputMessage{userMessage, toolMessage(images(1))}},
+		},
+		{
+			name:    "large system image",
+			req:     ChatCompletionRequest{SystemContent: []ContentPart{{Type: ContentTypeImage, Data: large}}, Messages: []InputMessage{userMessage}},
+			wantErr: "image in system content is",
+		},
+		{
+			name:    "large tool result image",
+			req:     ChatCompletionRequest{Messages: []InputMessage{userMessage, toolMessage([]ContentPart{{Type: ContentTypeImages, Images: []string{large}}})}},
+			wantErr: "image in the result of tool call call_1 in message 1 is",
+		},
+		{
+			name:    "wide tool result image",
+			req:     ChatCompletionRequest{Messages: []InputMessage{userMessage, toolMessage([]ContentPart{{Type: ContentTypeImage, Data: wide}})}},
+			wantErr: "is 8001x10 pixels",
+		},
+		{
+			name:    "images counted across system content and tool results",
+			req:     ChatCompletionRequest{SystemContent: images(60), Messages: []InputMessage{userMessage, toolMessage(images(41))}},
+			wantErr: "request contains 101 images",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRequestSize(tt.req, ClaudeProvider)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
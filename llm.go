@@ -1,6 +1,10 @@
 package llm
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
 
 // Role represents the role of a conversation participant.
 type Role string
@@ -18,6 +22,7 @@ const (
 	OpenAIProvider LLMProvider = "openai"
 	GeminiProvider LLMProvider = "gemini"
 	ClaudeProvider LLMProvider = "claude"
+	OllamaProvider LLMProvider = "ollama"
 )
 
 type Model string
@@ -48,25 +53,44 @@ const (
 	ModelClaude3Dot5HaikuLatest    Model = "claude-3-5-haiku-latest"
 	ModelClaude3Dot5Haiku20241022  Model = "claude-3-5-haiku-20241022"
 
-	ModelGemini2Flash                Model = "gemini-2.0-flash"
-	ModelGemini2FlashLite001        Model = "gemini-2.0-flash-lite-001"
-	ModelGemini15Flash               Model = "gemini-1.5-flash"
-	ModelGemini15Flash8B             Model = "gemini-1.5-flash-8b"
-	ModelGemini15Pro                 Model = "gemini-1.5-pro"
+	ModelGemini2Flash        Model = "gemini-2.0-flash"
+	ModelGemini2FlashLite001 Model = "gemini-2.0-flash-lite-001"
+	ModelGemini15Flash       Model = "gemini-1.5-flash"
+	ModelGemini15Flash8B     Model = "gemini-1.5-flash-8b"
+	ModelGemini15Pro         Model = "gemini-1.5-pro"
 )
 
 type ContentPart struct {
-	Type      ContentType
-	Text      string
-	Data      string
-	MediaType string
+	Type      ContentType `json:"type"`
+	Text      string      `json:"text,omitempty"`
+	Data      string      `json:"data,omitempty"`
+	MediaType string      `json:"media_type,omitempty"`
+	// Images holds the base64 data of the images of a ContentTypeImages part,
+	// which all have the part's MediaType.
+	Images []string `json:"images,omitempty"`
+	// CacheControl marks the part as a prompt caching breakpoint (Anthropic only).
+	CacheControl CacheControl `json:"cache_control,omitempty"`
+	// Citations lets Claude cite a ContentTypeDocument part in Choice.Citations.
+	// It is ignored for other content types, by other providers, streams and batches.
+	Citations bool `json:"citations,omitempty"`
 }
 
+// CacheControl selects how a content part is cached by providers supporting prompt caching.
+type CacheControl string
+
+const (
+	CacheControlNone      CacheControl = ""          // CacheControlNone disables caching for a content part.
+	CacheControlEphemeral CacheControl = "ephemeral" // CacheControlEphemeral caches the prompt up to and including the part.
+)
+
 type ContentType string
 
 const (
-	ContentTypeText  ContentType = "text"  // ContentTypeText indicates that a content part is text.
-	ContentTypeImage ContentType = "image" // ContentTypeImage indicates that a content part is an image.
+	ContentTypeText     ContentType = "text"     // ContentTypeText indicates that a content part is text.
+	ContentTypeImage    ContentType = "image"    // ContentTypeImage indicates that a content part is an image.
+	ContentTypeAudio    ContentType = "audio"    // ContentTypeAudio indicates that a content part is audio.
+	ContentTypeDocument ContentType = "document" // ContentTypeDocument indicates that a content part is a document, e.g. a PDF.
+	ContentTypeImages   ContentType = "images"   // ContentTypeImages indicates that a content part is a list of images of the same media type, e.g. the pages of a document.
 )
 
 // Message represents a single message in a conversation.
@@ -81,6 +105,15 @@ type OutputMessage struct {
 	Role      Role       `json:"role"`
 	Content   string     `json:"content"`
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ContentParts preserves the content blocks of the response; Content is their concatenated text.
+	ContentParts []ContentPart `json:"content_parts,omitempty"`
+	// Refusal is the explanation given when the model declines to answer (OpenAI only).
+	Refusal string `json:"refusal,omitempty"`
+	// ReasoningContent holds the model's reasoning, kept apart from the answer in Content.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// ToolCallDeltas is only set on stream chunks, for argument fragments of
+	// tool calls that are not complete yet. Complete calls are in ToolCalls.
+	ToolCallDeltas []ToolCallDelta `json:"tool_call_deltas,omitempty"`
 }
 
 // ChatCompletionRequest represents a request for a chat completion.
@@ -93,6 +126,75 @@ type ChatCompletionRequest struct {
 	TopP         *float32       `json:"top_p,omitempty"`
 	MaxTokens    int            `json:"max_tokens,omitempty"`
 	JSONMode     bool           `json:"json_mode,omitempty"`
+	// ResponseSchema constrains the output to a JSON Schema and takes precedence over JSONMode.
+	ResponseSchema *ResponseSchema `json:"response_schema,omitempty"`
+	// SystemContent holds system prompt blocks that follow SystemPrompt, e.g. to cache only some of them.
+	SystemContent []ContentPart `json:"system_content,omitempty"`
+	// TopK limits sampling to the K most likely tokens (Claude and Gemini only).
+	TopK *int `json:"top_k,omitempty"`
+	// Creativity sets the randomness of the output from 0 to 1 and overrides
+	// Temperature and TopP, which are derived from it for the provider, see Normalize.
+	Creativity *float32 `json:"creativity,omitempty"`
+	// Seed makes sampling deterministic on a best-effort basis (OpenAI only).
+	Seed *int `json:"seed,omitempty"`
+	// ReasoningEffort is "low", "medium" or "high" for OpenAI reasoning models
+	// supporting it. The provider default applies when it is unset.
+	ReasoningEffort *string `json:"reasoning_effort,omitempty"`
+	// Stop ends the output before any of the given sequences.
+	Stop []string `json:"stop,omitempty"`
+	// User identifies the end user, sent as user for OpenAI and metadata.user_id for Claude.
+	User string `json:"user,omitempty"`
+	// Store asks OpenAI to store the completion for its dashboard and evals (OpenAI only).
+	Store *bool `json:"store,omitempty"`
+	// Metadata tags stored completions (OpenAI only).
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// FewShot examples are sent as alternating user and assistant messages before Messages.
+	FewShot []Example `json:"few_shot,omitempty"`
+	// SystemPlacement controls where the system prompt is sent for providers
+	// without a dedicated system prompt field (OpenAI).
+	SystemPlacement SystemPlacement `json:"system_placement,omitempty"`
+	// CachedContent is the name of a CacheRef created with
+	// GeminiLLM.CreateCachedContent, which precedes the conversation (Gemini only).
+	CachedContent string `json:"cached_content,omitempty"`
+	// Extensions holds provider specific parameters by provider, set with
+	// WithOpenAI or WithClaude. Each provider only applies its own.
+	Extensions map[LLMProvider]any `json:"-"`
+}
+
+// SystemPlacement selects where the system prompt is placed in the messages.
+type SystemPlacement string
+
+const (
+	SystemPlacementMessage   SystemPlacement = ""           // SystemPlacementMessage sends the system prompt as a leading system message.
+	SystemPlacementFirstUser SystemPlacement = "first_user" // SystemPlacementFirstUser prepends the system prompt to the first user message, for backends rejecting system messages.
+)
+
+// Example is a few-shot example of an input and the expected output.
+type Example struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// systemPromptText returns the system prompt and the text of all system content
+// blocks joined by newlines, for providers without structured system prompts
+func (r ChatCompletionRequest) systemPromptText() (string, bool) {
+	var parts []string
+	if r.SystemPrompt != nil {
+		parts = append(parts, *r.SystemPrompt)
+	}
+	for _, part := range r.SystemContent {
+		if part.Type == ContentTypeText {
+			parts = append(parts, part.Text)
+		}
+	}
+	return strings.Join(parts, "\n"), len(parts) > 0
+}
+
+// ResponseSchema describes the JSON Schema a structured response must conform to.
+type ResponseSchema struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+	Strict bool                   `json:"strict,omitempty"`
 }
 
 // Tool represents a function that can be called by the LLM
@@ -102,10 +204,12 @@ type Tool struct {
 }
 
 type ToolResult struct {
-	ToolCallID   string
-	FunctionName string
-	Result       string
-	IsError      bool
+	ToolCallID   string `json:"tool_call_id"`
+	FunctionName string `json:"function_name,omitempty"`
+	Result       string `json:"result"`
+	IsError      bool   `json:"is_error,omitempty"`
+	// ResultParts holds multimodal tool output, e.g. a chart image, sent after Result.
+	ResultParts []ContentPart `json:"result_parts,omitempty"`
 }
 
 // Function represents a function definition
@@ -127,11 +231,26 @@ type ToolCallFunction struct {
 	Arguments string `json:"arguments"`
 }
 
+// ToolCallDelta is a fragment of the arguments of a tool call that is still
+// being streamed. Index is the position of the tool call in the message.
+type ToolCallDelta struct {
+	Index     int    `json:"index"`
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
 // ChatCompletionResponse represents the response from a chat completion request.
 type ChatCompletionResponse struct {
 	ID      string   `json:"id"`
 	Choices []Choice `json:"choices"`
 	Usage   Usage    `json:"usage"`
+	// SystemFingerprint identifies the backend configuration that served the
+	// request (OpenAI only). Outputs for a fixed Seed may differ when it changes.
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+	// RawResponse is the provider's unmodified response, set only for clients
+	// created with WithRawResponses.
+	RawResponse json.RawMessage `json:"raw_response,omitempty"`
 }
 
 type FinishReason string
@@ -141,6 +260,13 @@ const (
 	FinishReasonStop      FinishReason = "stop"
 	FinishReasonMaxTokens FinishReason = "max_tokens"
 	FinishReasonNull      FinishReason = "null"
+	// FinishReasonOther is used for provider finish reasons without a generic
+	// equivalent; Choice.RawFinishReason holds the provider's value.
+	FinishReasonOther FinishReason = "other"
+	// FinishReasonRefusal indicates that the model declined to answer, see OutputMessage.Refusal.
+	FinishReasonRefusal FinishReason = "refusal"
+	// FinishReasonContentFilter indicates that the output was stopped by the provider's content filter.
+	FinishReasonContentFilter FinishReason = "content_filter"
 )
 
 // Choice represents a single completion choice.
@@ -148,6 +274,13 @@ type Choice struct {
 	Index        int           `json:"index"`
 	Message      OutputMessage `json:"message"`
 	FinishReason FinishReason  `json:"finish_reason"`
+	// RawFinishReason is the finish reason as reported by the provider.
+	RawFinishReason string `json:"raw_finish_reason,omitempty"`
+	// StopSequence is the sequence of ChatCompletionRequest.Stop that ended
+	// the output (Claude only, other providers do not report it).
+	StopSequence string `json:"stop_sequence,omitempty"`
+	// Citations reference the documents supporting the output, see ContentPart.Citations.
+	Citations []Citation `json:"citations,omitempty"`
 }
 
 // Usage represents token usage information.
@@ -155,6 +288,9 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// CachedPromptTokens is the part of PromptTokens read from the provider's
+	// prompt cache, which is billed at a lower price.
+	CachedPromptTokens int `json:"cached_prompt_tokens,omitempty"`
 }
 
 // LLM defines the interface that all LLM providers must implement.
@@ -163,6 +299,11 @@ type LLM interface {
 	CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error)
 }
 
+// ProviderNamer is implemented by LLMs that report the provider serving them.
+type ProviderNamer interface {
+	ProviderName() LLMProvider
+}
+
 // ChatCompletionStream represents a streaming chat completion.
 type ChatCompletionStream interface {
 	Recv() (ChatCompletionResponse, error)
@@ -0,0 +1,216 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// inputMessageJSON is the JSON representation of an InputMessage
+type inputMessageJSON struct {
+	Role        Role            `json:"role"`
+	Content     json.RawMessage `json:"content,omitempty"`
+	ToolCalls   []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID  string          `json:"tool_call_id,omitempty"`
+	Name        string          `json:"name,omitempty"`
+	IsError     bool            `json:"is_error,omitempty"`
+	ToolResults []ToolResult    `json:"tool_results,omitempty"`
+}
+
+type contentPartJSON struct {
+	Type         string          `json:"type"`
+	Text         string          `json:"text,omitempty"`
+	ImageURL     *imageURLJSON   `json:"image_url,omitempty"`
+	InputAudio   *inputAudioJSON `json:"input_audio,omitempty"`
+	File         *fileJSON       `json:"file,omitempty"`
+	CacheControl CacheControl    `json:"cache_control,omitempty"`
+	Citations    bool            `json:"citations,omitempty"`
+}
+
+type imageURLJSON struct {
+	URL string `json:"url"`
+}
+
+type inputAudioJSON struct {
+	Data   string `json:"data"`
+	Format string `json:"format"`
+}
+
+type fileJSON struct {
+	FileData string `json:"file_data"`
+}
+
+// MarshalJSON encodes the message in the OpenAI chat message format:
+//   - content is an array of OpenAI content parts; images are data URLs in
+//     image_url parts, documents data URLs in file parts and audio is sent in
+//     input_audio parts
+//   - a tool message with a single text result carries tool_call_id, name and
+//     the result as string content
+//
+// Fields OpenAI has no equivalent for are added as extensions: cache_control
+// and citations on content parts, is_error on tool messages and tool_results
+// for tool messages with several or multimodal results.
+func (m InputMessage) MarshalJSON() ([]byte, error) {
+	msg := inputMessageJSON{
+		Role:      m.Role,
+		ToolCalls: m.ToolCalls,
+	}
+
+	if len(m.ToolResults) == 1 && len(m.ToolResults[0].ResultParts) == 0 && len(m.MultiContent) == 0 {
+		result := m.ToolResults[0]
+		content, err := json.Marshal(result.Result)
+		if err != nil {
+			return nil, err
+		}
+		msg.Content = content
+		msg.ToolCallID = result.ToolCallID
+		msg.Name = result.FunctionName
+		msg.IsError = result.IsError
+		return json.Marshal(msg)
+	}
+
+	if m.MultiContent != nil {
+		multiContent := expandImages(m.MultiContent)
+		parts := make([]contentPartJSON, len(multiContent))
+		for i, part := range multiContent {
+			p, err := marshalContentPart(part)
+			if err != nil {
+				return nil, err
+			}
+			parts[i] = p
+		}
+		content, err := json.Marshal(parts)
+		if err != nil {
+			return nil, err
+		}
+		msg.Content = content
+	}
+	msg.ToolResults = m.ToolResults
+	return json.Marshal(msg)
+}
+
+// UnmarshalJSON decodes a message in the OpenAI chat message format as
+// written by MarshalJSON. Plain string content is accepted as a text part,
+// or as the tool result of a tool message with a tool_call_id.
+func (m *InputMessage) UnmarshalJSON(data []byte) error {
+	var msg inputMessageJSON
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	*m = InputMessage{
+		Role:        msg.Role,
+		ToolCalls:   msg.ToolCalls,
+		ToolResults: msg.ToolResults,
+	}
+	if len(msg.Content) == 0 || string(msg.Content) == "null" {
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(msg.Content, &text); err == nil {
+		if msg.ToolCallID != "" {
+			m.ToolResults = append(m.ToolResults, ToolResult{
+				ToolCallID:   msg.ToolCallID,
+				FunctionName: msg.Name,
+				Result:       text,
+				IsError:      msg.IsError,
+			})
+			return nil
+		}
+		m.MultiContent = []ContentPart{{Type: ContentTypeText, Text: text}}
+		return nil
+	}
+
+	var parts []contentPartJSON
+	if err := json.Unmarshal(msg.Content, &parts); err != nil {
+		return fmt.Errorf("invalid message content: %w", err)
+	}
+	m.MultiContent = make([]ContentPart, len(parts))
+	for i, p := range parts {
+		part, err := unmarshalContentPart(p)
+		if err != nil {
+			return err
+		}
+		m.MultiContent[i] = part
+	}
+	return nil
+}
+
+func marshalContentPart(part ContentPart) (contentPartJSON, error) {
+	p := contentPartJSON{CacheControl: part.CacheControl, Citations: part.Citations}
+	switch part.Type {
+	case ContentTypeText:
+		p.Type = "text"
+		p.Text = part.Text
+	case ContentTypeImage:
+		p.Type = "image_url"
+		p.ImageURL = &imageURLJSON{URL: dataURL(part)}
+	case ContentTypeDocument:
+		p.Type = "file"
+		p.File = &fileJSON{FileData: dataURL(part)}
+	case ContentTypeAudio:
+		p.Type = "input_audio"
+		p.InputAudio = &inputAudioJSON{Data: part.Data, Format: audioFormat(part.MediaType)}
+	default:
+		return p, fmt.Errorf("unsupported content type %q", part.Type)
+	}
+	return p, nil
+}
+
+func unmarshalContentPart(p contentPartJSON) (ContentPart, error) {
+	part := ContentPart{CacheControl: p.CacheControl, Citations: p.Citations}
+	switch {
+	case p.Type == "text":
+		part.Type = ContentTypeText
+		part.Text = p.Text
+	case p.Type == "image_url" && p.ImageURL != nil:
+		part.Type = ContentTypeImage
+		part.MediaType, part.Data = parseDataURL(p.ImageURL.URL)
+	case p.Type == "file" && p.File != nil:
+		part.Type = ContentTypeDocument
+		part.MediaType, part.Data = parseDataURL(p.File.FileData)
+	case p.Type == "input_audio" && p.InputAudio != nil:
+		part.Type = ContentTypeAudio
+		part.MediaType = audioMediaType(p.InputAudio.Format)
+		part.Data = p.InputAudio.Data
+	default:
+		return part, fmt.Errorf("unsupported content part type %q", p.Type)
+	}
+	return part, nil
+}
+
+// dataURL returns the base64 data URL of a media content part
+func dataURL(part ContentPart) string {
+	return "data:" + part.MediaType + ";base64," + part.Data
+}
+
+// parseDataURL splits a base64 data URL into media type and data. Other URLs
+// are returned as data without a media type.
+func parseDataURL(url string) (mediaType, data string) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", url
+	}
+	mediaType, data, ok = strings.Cut(rest, ";base64,")
+	if !ok {
+		return "", url
+	}
+	return mediaType, data
+}
+
+// audioFormat returns the OpenAI input_audio format of an audio media type
+func audioFormat(mediaType string) string {
+	if mediaType == "audio/mpeg" {
+		return "mp3"
+	}
+	return strings.TrimPrefix(mediaType, "audio/")
+}
+
+// audioMediaType is the inverse of audioFormat
+func audioMediaType(format string) string {
+	if format == "mp3" {
+		return "audio/mpeg"
+	}
+	return "audio/" + format
+}
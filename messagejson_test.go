@@ -0,0 +1,214 @@
+package llm
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInputMessageJSONRoundTrip(t *testing.T) {
+	text := ContentPart{Type: ContentTypeText, Text: "What is in this picture?"}
+	image := ContentPart{Type: ContentTypeImage, MediaType: "image/png", Data: "iVBORw0KGgo="}
+	call := ToolCall{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "weather", Arguments: `{"city":"Paris"}`}}
+
+	tests := []struct {
+		name string
+		msg  InputMessage
+		// wantJSON is a substring of the encoded message
+		wantJSON string
+	}{
+		{
+			name:     "user text",
+			msg:      InputMessage{Role: RoleUser, MultiContent: []ContentPart{text}},
+			wantJSON: `"content":[{"type":"text","text":"What is in this picture?"}]`,
+		},
+		{
+			name:     "user image",
+			msg:      InputMessage{Role: RoleUser, MultiContent: []ContentPart{text, image}},
+			wantJSON: `{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}}`,
+		},
+		{
+			name: "user document",
+			msg: InputMessage{Role: RoleUser, MultiContent: []ContentPart{
+				{Type: ContentTypeDocument, MediaType: "application/pdf", Data: "JVBERi0="},
+			}},
+			wantJSON: `{"type":"file","file":{"file_data":"data:application/pdf;base64,JVBERi0="}}`,
+		},
+		{
+			name: "cited document",
+			msg: InputMessage{Role: RoleUser, MultiContent: []ContentPart{
+				{Type: ContentTypeDocument, MediaType: "application/pdf", Data: "JVBERi0=", Citations: true},
+			}},
+			wantJSON: `"citations":true`,
+		},
+		{
+			name: "user audio",
+			msg: InputMessage{Role: RoleUser, MultiContent: []ContentPart{
+				{Type: ContentTypeAudio, MediaType: "audio/mpeg", Data: "SUQz"},
+			}},
+			wantJSON: `{"type":"input_audio","input_audio":{"data":"SUQz","format":"mp3"}}`,
+		},
+		{
+			name: "cached part",
+			msg: InputMessage{Role: RoleUser, MultiContent: []ContentPart{
+				{Type: ContentTypeText, Text: "a long document", CacheControl: CacheControlEphemeral},
+			}},
+			wantJSON: `"cache_control":"ephemeral"`,
+		},
+		{
+			name:     "assistant text",
+			msg:      InputMessage{Role: RoleAssistant, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "A cat."}}},
+			wantJSON: `"role":"assistant"`,
+		},
+		{
+			name:     "assistant tool calls",
+			msg:      InputMessage{Role: RoleAssistant, ToolCalls: []ToolCall{call}},
+			wantJSON: `"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}}]`,
+		},
+		{
+			name:     "assistant text and tool calls",
+			msg:      InputMessage{Role: RoleAssistant, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "Checking."}}, ToolCalls: []ToolCall{call}},
+			wantJSON: `"tool_calls":[`,
+		},
+		{
+			name: "tool result",
+			msg: InputMessage{Role: RoleTool, ToolResults: []ToolResult{
+				{ToolCallID: "call_1", FunctionName: "weather", Result: "sunny"},
+			}},
+			wantJSON: `{"role":"tool","content":"sunny","tool_call_id":"call_1","name":"weather"}`,
+		},
+		{
+			name: "failed tool result",
+			msg: InputMessage{Role: RoleTool, ToolResults: []ToolResult{
+				{ToolCallID: "call_1", Result: "timeout", IsError: true},
+			}},
+			wantJSON: `"is_error":true`,
+		},
+		{
+			name: "several tool results",
+			msg: InputMessage{Role: RoleTool, ToolResults: []ToolResult{
+				{ToolCallID: "call_1", Result: "sunny"},
+				{ToolCallID: "call_2", Result: "12:00"},
+			}},
+			wantJSON: `"tool_results":[`,
+		},
+		{
+			name: "image tool result",
+			msg: InputMessage{Role: RoleTool, ToolResults: []ToolResult{
+				{ToolCallID: "call_1", Result: "the chart", ResultParts: []ContentPart{image}},
+			}},
+			wantJSON: `"result_parts":[`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tt.wantJSON) {
+				t.Errorf("encoded %s, want it to contain %s", data, tt.wantJSON)
+			}
+
+			var got InputMessage
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.msg) {
+				t.Errorf("round trip of %s\ngot  %+v\nwant %+v", data, got, tt.msg)
+			}
+		})
+	}
+}
+
+func TestInputMessageJSONImages(t *testing.T) {
+	// an images part is encoded as one image_url part per image
+	msg := InputMessage{Role: RoleUser, MultiContent: []ContentPart{
+		{Type: ContentTypeImages, MediaType: "image/jpeg", Images: []string{"AAAA", "BBBB"}},
+	}}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got InputMessage
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []ContentPart{
+		{Type: ContentTypeImage, MediaType: "image/jpeg", Data: "AAAA"},
+		{Type: ContentTypeImage, MediaType: "image/jpeg", Data: "BBBB"},
+	}
+	if !reflect.DeepEqual(got.MultiContent, want) {
+		t.Errorf("decoded %+v, want %+v", got.MultiContent, want)
+	}
+}
+
+func TestInputMessageJSONPlainContent(t *testing.T) {
+	var msg InputMessage
+	if err := json.Unmarshal([]byte(`{"role":"user","content":"hi"}`), &msg); err != nil {
+		t.Fatal(err)
+	}
+	want := InputMessage{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "hi"}}}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("decoded %+v, want %+v", msg, want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"role":"user","content":[{"type":"video"}]}`), &msg); err == nil {
+		t.Error("an unsupported content part was decoded")
+	}
+}
+
+func TestContentPartJSONTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+		into  any
+	}{
+		{
+			name:  "text part",
+			value: ContentPart{Type: ContentTypeText, Text: "hi", CacheControl: CacheControlEphemeral},
+			want:  `{"type":"text","text":"hi","cache_control":"ephemeral"}`,
+			into:  &ContentPart{},
+		},
+		{
+			name:  "image part",
+			value: ContentPart{Type: ContentTypeImage, MediaType: "image/png", Data: "iVBORw0KGgo="},
+			want:  `{"type":"image","data":"iVBORw0KGgo=","media_type":"image/png"}`,
+			into:  &ContentPart{},
+		},
+		{
+			name:  "tool result",
+			value: ToolResult{ToolCallID: "call_1", FunctionName: "weather", Result: "sunny", IsError: true},
+			want:  `{"tool_call_id":"call_1","function_name":"weather","result":"sunny","is_error":true}`,
+			into:  &ToolResult{},
+		},
+		{
+			name: "multimodal response",
+			value: OutputMessage{Role: RoleAssistant, Content: "A cat.", ContentParts: []ContentPart{
+				{Type: ContentTypeText, Text: "A cat."},
+				{Type: ContentTypeImage, MediaType: "image/png", Data: "iVBORw0KGgo="},
+			}},
+			want: `"content_parts":[{"type":"text","text":"A cat."},{"type":"image","data":"iVBORw0KGgo=","media_type":"image/png"}]`,
+			into: &OutputMessage{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("encoded %s, want %s", data, tt.want)
+			}
+			if err := json.Unmarshal(data, tt.into); err != nil {
+				t.Fatal(err)
+			}
+			if got := reflect.ValueOf(tt.into).Elem().Interface(); !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("round trip of %s\ngot  %+v\nwant %+v", data, got, tt.value)
+			}
+		})
+	}
+}
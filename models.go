@@ -0,0 +1,151 @@
+package llm
+
+// modelProviders maps every declared model to the provider serving it.
+var modelProviders = map[Model]LLMProvider{
+	ModelChatGPT4oLatest:     OpenAIProvider,
+	ModelGPT4o:               OpenAIProvider,
+	ModelGPT4oMini:           OpenAIProvider,
+	ModelGPT4o2024_08_06:     OpenAIProvider,
+	ModelGPT4oMini2024_07_18: OpenAIProvider,
+	ModelO1:                  OpenAIProvider,
+	ModelO1_2024_12_17:       OpenAIProvider,
+	ModelO1Preview2024_09_12: OpenAIProvider,
+	ModelO1Preview:           OpenAIProvider,
+	ModelO1Mini:              OpenAIProvider,
+	ModelO1Mini2024_09_12:    OpenAIProvider,
+	ModelO3Mini:              OpenAIProvider,
+	ModelO3Mini2025_01_31:    OpenAIProvider,
+
+	ModelClaude2Dot0:               ClaudeProvider,
+	ModelClaude2Dot1:               ClaudeProvider,
+	ModelClaude3Opus20240229:       ClaudeProvider,
+	ModelClaude3Sonnet20240229:     ClaudeProvider,
+	ModelClaude3Dot5Sonnet20240620: ClaudeProvider,
+	ModelClaude3Dot5Sonnet20241022: ClaudeProvider,
+	ModelClaude3Dot5SonnetLatest:   ClaudeProvider,
+	ModelClaude3Haiku20240307:      ClaudeProvider,
+	ModelClaude3Dot5HaikuLatest:    ClaudeProvider,
+	ModelClaude3Dot5Haiku20241022:  ClaudeProvider,
+
+	ModelGemini2Flash:        GeminiProvider,
+	ModelGemini2FlashLite001: GeminiProvider,
+	ModelGemini15Flash:       GeminiProvider,
+	ModelGemini15Flash8B:     GeminiProvider,
+	ModelGemini15Pro:         GeminiProvider,
+}
+
+// DefaultModels is the model used for a provider when a request targets a
+// model of another provider, e.g. in FanOut.
+var DefaultModels = map[LLMProvider]Model{
+	OpenAIProvider: ModelGPT4o,
+	ClaudeProvider: ModelClaude3Dot5SonnetLatest,
+	GeminiProvider: ModelGemini2Flash,
+}
+
+// ProviderForModel returns the provider that serves the given model.
+func ProviderForModel(model Model) (LLMProvider, bool) {
+	provider, ok := modelProviders[model]
+	return provider, ok
+}
+
+// contextWindows holds the context window of every declared model in tokens.
+var contextWindows = map[Model]int{
+	ModelChatGPT4oLatest:     128000,
+	ModelGPT4o:               128000,
+	ModelGPT4oMini:           128000,
+	ModelGPT4o2024_08_06:     128000,
+	ModelGPT4oMini2024_07_18: 128000,
+	ModelO1:                  200000,
+	ModelO1_2024_12_17:       200000,
+	ModelO1Preview2024_09_12: 128000,
+	ModelO1Preview:           128000,
+	ModelO1Mini:              128000,
+	ModelO1Mini2024_09_12:    128000,
+	ModelO3Mini:              200000,
+	ModelO3Mini2025_01_31:    200000,
+
+	ModelClaude2Dot0:               100000,
+	ModelClaude2Dot1:               200000,
+	ModelClaude3Opus20240229:       200000,
+	ModelClaude3Sonnet20240229:     200000,
+	ModelClaude3Dot5Sonnet20240620: 200000,
+	ModelClaude3Dot5Sonnet20241022: 200000,
+	ModelClaude3Dot5SonnetLatest:   200000,
+	ModelClaude3Haiku20240307:      200000,
+	ModelClaude3Dot5HaikuLatest:    200000,
+	ModelClaude3Dot5Haiku20241022:  200000,
+
+	ModelGemini2Flash:        1048576,
+	ModelGemini2FlashLite001: 1048576,
+	ModelGemini15Flash:       1048576,
+	ModelGemini15Flash8B:     1048576,
+	ModelGemini15Pro:         2097152,
+}
+
+// ContextWindow returns the context window of the given model in tokens.
+func ContextWindow(model Model) (int, bool) {
+	window, ok := contextWindows[model]
+	return window, ok
+}
+
+// modelsWithoutTools lists the declared models that cannot call tools.
+var modelsWithoutTools = map[Model]bool{
+	ModelO1Preview2024_09_12: true,
+	ModelO1Preview:           true,
+	ModelO1Mini:              true,
+	ModelO1Mini2024_09_12:    true,
+	ModelClaude2Dot0:         true,
+	ModelClaude2Dot1:         true,
+}
+
+// modelsWithoutImages lists the declared models that do not accept image input.
+var modelsWithoutImages = map[Model]bool{
+	ModelO1Preview2024_09_12:      true,
+	ModelO1Preview:                true,
+	ModelO1Mini:                   true,
+	ModelO1Mini2024_09_12:         true,
+	ModelO3Mini:                   true,
+	ModelO3Mini2025_01_31:         true,
+	ModelClaude2Dot0:              true,
+	ModelClaude2Dot1:              true,
+	ModelClaude3Dot5HaikuLatest:   true,
+	ModelClaude3Dot5Haiku20241022: true,
+}
+
+// ModelInfo describes a model's provider, capabilities and limits.
+type ModelInfo struct {
+	Model    Model
+	Provider LLMProvider
+	// ContextWindow is the maximum number of tokens of prompt and output.
+	ContextWindow int
+	// SupportsTools reports whether the model can call tools.
+	SupportsTools bool
+	// SupportsImages reports whether the model accepts image input.
+	SupportsImages bool
+	// Limits are the request size limits of the provider.
+	Limits ProviderLimits
+	// Pricing is the price of the model, if known.
+	Pricing *Pricing
+}
+
+// LookupModel returns everything known about a declared model.
+func LookupModel(model Model) (ModelInfo, bool) {
+	provider, ok := ProviderForModel(model)
+	if !ok {
+		return ModelInfo{}, false
+	}
+	limits, _ := LimitsForProvider(provider)
+	var price *Pricing
+	if p, ok := PricingForModel(model); ok {
+		price = &p
+	}
+	return ModelInfo{
+		Model:          model,
+		Provider:       provider,
+		ContextWindow:  contextWindows[model],
+		SupportsTools:  !modelsWithoutTools[model],
+		SupportsImages: !modelsWithoutImages[model],
+		Limits:         limits,
+		Pricing:        price,
+	}, true
+}
@@ -0,0 +1,57 @@
+package llm
+
+import "testing"
+
+func TestLookupModel(t *testing.T) {
+	tests := []struct {
+		model       Model
+		provider    LLMProvider
+		window      int
+		tools       bool
+		images      bool
+		inputPrice  float64
+		outputPrice float64
+	}{
+		{ModelGPT4o, OpenAIProvider, 128000, true, true, 2.5, 10},
+		{ModelO1Mini, OpenAIProvider, 128000, false, false, 1.1, 4.4},
+		{ModelClaude2Dot1, ClaudeProvider, 200000, false, false, 8, 24},
+		{ModelGemini15Pro, GeminiProvider, 2097152, true, true, 1.25, 5},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.model), func(t *testing.T) {
+			info, ok := LookupModel(tt.model)
+			if !ok {
+				t.Fatal("model not found")
+			}
+			if info.Model != tt.model || info.Provider != tt.provider || info.ContextWindow != tt.window {
+				t.Errorf("got model %q, provider %q, context window %d", info.Model, info.Provider, info.ContextWindow)
+			}
+			if info.SupportsTools != tt.tools || info.SupportsImages != tt.images {
+				t.Errorf("got tools %v, images %v, want %v, %v", info.SupportsTools, info.SupportsImages, tt.tools, tt.images)
+			}
+			if limits, _ := LimitsForProvider(tt.provider); info.Limits != limits {
+				t.Errorf("got limits %+v, want the provider's %+v", info.Limits, limits)
+			}
+			if info.Pricing == nil || info.Pricing.Input != tt.inputPrice || info.Pricing.Output != tt.outputPrice {
+				t.Errorf("got pricing %+v, want %v/%v", info.Pricing, tt.inputPrice, tt.outputPrice)
+			}
+		})
+	}
+
+	if _, ok := LookupModel("unknown"); ok {
+		t.Error("found an undeclared model")
+	}
+}
+
+func TestLookupModelCoversDeclaredModels(t *testing.T) {
+	for _, model := range declaredModels(t) {
+		info, ok := LookupModel(model)
+		if !ok {
+			t.Errorf("model %s is not found", model)
+			continue
+		}
+		if info.ContextWindow == 0 {
+			t.Errorf("model %s has no context window", model)
+		}
+	}
+}
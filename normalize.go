@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxTemperature is the highest temperature accepted by each provider.
+var maxTemperature = map[LLMProvider]float32{
+	OpenAIProvider: 2,
+	ClaudeProvider: 1,
+	GeminiProvider: 2,
+}
+
+// Normalize validates the sampling parameters of the request and returns the
+// effective request that is sent to the given provider:
+//   - a negative temperature, a TopP outside (0, 1], a TopK below 1, a Creativity
+//     outside [0, 1], an unknown ReasoningEffort or negative MaxTokens is an error
+//   - a Creativity c replaces Temperature and TopP: the temperature is c times
+//     the provider's creative temperature (1 for Claude, 1.5 for OpenAI and
+//     Gemini) and TopP is 0.5 + c/2
+//   - the temperature is clamped to the provider's maximum
+//   - a zero temperature becomes the smallest non-zero value for Gemini, whose
+//     default is not 0 and would otherwise be used instead
+//   - FewShot examples are expanded into messages preceding the conversation
+//   - ContentTypeImages parts are expanded into one ContentTypeImage part per image
+//
+// Providers call Normalize internally; callers can use it to preview the request.
+func Normalize(req ChatCompletionRequest, provider LLMProvider) (ChatCompletionRequest, error) {
+	if req.Temperature < 0 {
+		return req, fmt.Errorf("temperature must not be negative, got %v", req.Temperature)
+	}
+	if req.TopP != nil && (*req.TopP <= 0 || *req.TopP > 1) {
+		return req, fmt.Errorf("top_p must be in (0, 1], got %v", *req.TopP)
+	}
+	if req.TopK != nil && *req.TopK < 1 {
+		return req, fmt.Errorf("top_k must be at least 1, got %d", *req.TopK)
+	}
+	if req.ReasoningEffort != nil {
+		switch *req.ReasoningEffort {
+		case "low", "medium", "high":
+		default:
+			return req, fmt.Errorf("reasoning_effort must be low, medium or high, got %q", *req.ReasoningEffort)
+		}
+	}
+	if req.MaxTokens < 0 {
+		return req, fmt.Errorf("max_tokens must not be negative, got %d", req.MaxTokens)
+	}
+	if req.Creativity != nil {
+		if *req.Creativity < 0 || *req.Creativity > 1 {
+			return req, fmt.Errorf("creativity must be in [0, 1], got %v", *req.Creativity)
+		}
+		req.Temperature, req.TopP = creativityParameters(*req.Creativity, provider)
+		req.Creativity = nil
+	}
+
+	req.Messages = expandImageParts(req.Messages)
+
+	if len(req.FewShot) > 0 {
+		req.Messages = append(expandFewShot(req.FewShot), req.Messages...)
+		req.FewShot = nil
+	}
+
+	if maxTemp, ok := maxTemperature[provider]; ok && req.Temperature > maxTemp {
+		req.Temperature = maxTemp
+	}
+
+	// An unset TopP is left unset so that it is omitted and the provider default applies
+	if provider == GeminiProvider {
+		// https://cloud.google.com/vertex-ai/generative-ai/docs/learn/prompts/adjust-parameter-values
+		// It's safer to set the temperature to a small non zero value to avoid the initial value
+		// from being lost when marshalled/unmarshalled when sending over an API
+		if req.Temperature == 0 {
+			req.Temperature = math.SmallestNonzeroFloat32
+		}
+	}
+
+	return req, nil
+}
+
+// creativeTemperature is the temperature a Creativity of 1 maps to. It is
+// below the maximum for OpenAI and Gemini, whose output degrades above it.
+var creativeTemperature = map[LLMProvider]float32{
+	OpenAIProvider: 1.5,
+	ClaudeProvider: 1,
+	GeminiProvider: 1.5,
+}
+
+// creativityParameters returns the temperature and top_p for a Creativity
+func creativityParameters(creativity float32, provider LLMProvider) (float32, *float32) {
+	maxTemp, ok := creativeTemperature[provider]
+	if !ok {
+		maxTemp = 1
+	}
+	topP := 0.5 + creativity/2
+	return creativity * maxTemp, &topP
+}
+
+// expandFewShot turns examples into alternating user and assistant messages
+func expandFewShot(examples []Example) []InputMessage {
+	messages := make([]InputMessage, 0, 2*len(examples))
+	for _, example := range examples {
+		messages = append(messages,
+			InputMessage{
+				Role:         RoleUser,
+				MultiContent: []ContentPart{{Type: ContentTypeText, Text: example.Input}},
+			},
+			InputMessage{
+				Role:         RoleAssistant,
+				MultiContent: []ContentPart{{Type: ContentTypeText, Text: example.Output}},
+			},
+		)
+	}
+	return messages
+}
+
+// expandImageParts returns the messages with their ContentTypeImages parts
+// expanded into one image part per image
+func expandImageParts(messages []InputMessage) []InputMessage {
+	expanded := make([]InputMessage, len(messages))
+	for i, msg := range messages {
+		if hasImagesPart(msg.MultiContent) {
+			msg.MultiContent = expandImages(msg.MultiContent)
+		}
+		expanded[i] = msg
+	}
+	return expanded
+}
+
+func hasImagesPart(parts []ContentPart) bool {
+	for _, part := range parts {
+		if part.Type == ContentTypeImages {
+			return true
+		}
+	}
+	return false
+}
+
+// expandImages returns the parts with ContentTypeImages parts expanded into
+// image parts, the cache control of such a part is kept on its last image
+func expandImages(parts []ContentPart) []ContentPart {
+	expanded := make([]ContentPart, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != ContentTypeImages {
+			expanded = append(expanded, part)
+			continue
+		}
+		for i, data := range part.Images {
+			image := ContentPart{Type: ContentTypeImage, Data: data, MediaType: part.MediaType}
+			if i == len(part.Images)-1 {
+				image.CacheControl = part.CacheControl
+			}
+			expanded = append(expanded, image)
+		}
+	}
+	return expanded
+}
+
+// valueOrZero returns the value of an optional request parameter, or the zero
+// value when it is unset so that omitempty drops it from the provider request
+func valueOrZero[T any](v *T) T {
+	var zero T
+	if v == nil {
+		return zero
+	}
+	return *v
+}
@@ -0,0 +1,373 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	ptr := func(v float32) *float32 { return &v }
+	intPtr := func(v int) *int { return &v }
+	strPtr := func(v string) *string { return &v }
+
+	tests := []struct {
+		name     string
+		provider LLMProvider
+		req      ChatCompletionRequest
+		wantErr  bool
+		wantTemp float32
+		wantTopP *float32
+	}{
+		{name: "negative temperature", provider: OpenAIProvider, req: ChatCompletionRequest{Temperature: -0.1}, wantErr: true},
+		{name: "zero top_p", provider: OpenAIProvider, req: ChatCompletionRequest{TopP: ptr(0)}, wantErr: true},
+		{name: "top_p above 1", provider: ClaudeProvider, req: ChatCompletionRequest{TopP: ptr(1.5)}, wantErr: true},
+		{name: "top_k below 1", provider: ClaudeProvider, req: ChatCompletionRequest{TopK: intPtr(0)}, wantErr: true},
+		{name: "creativity above 1", provider: GeminiProvider, req: ChatCompletionRequest{Creativity: ptr(1.2)}, wantErr: true},
+		{name: "negative creativity", provider: GeminiProvider, req: ChatCompletionRequest{Creativity: ptr(-1)}, wantErr: true},
+		{name: "unknown reasoning effort", provider: OpenAIProvider, req: ChatCompletionRequest{ReasoningEffort: strPtr("max")}, wantErr: true},
+		{name: "negative max tokens", provider: OpenAIProvider, req: ChatCompletionRequest{MaxTokens: -1}, wantErr: true},
+
+		{name: "valid parameters are kept", provider: OpenAIProvider, req: ChatCompletionRequest{Temperature: 0.7, TopP: ptr(0.9)}, wantTemp: 0.7, wantTopP: ptr(0.9)},
+		{name: "unset top_p stays unset", provider: ClaudeProvider, req: ChatCompletionRequest{Temperature: 0.5}, wantTemp: 0.5},
+
+		{name: "creativity for OpenAI", provider: OpenAIProvider, req: ChatCompletionRequest{Creativity: ptr(1), Temperature: 0.1}, wantTemp: 1.5, wantTopP: ptr(1)},
+		{name: "creativity for Claude", provider: ClaudeProvider, req: ChatCompletionRequest{Creativity: ptr(0.5)}, wantTemp: 0.5, wantTopP: ptr(0.75)},
+		{name: "creativity for Gemini", provider: GeminiProvider, req: ChatCompletionRequest{Creativity: ptr(0.5), TopP: ptr(0.1)}, wantTemp: 0.75, wantTopP: ptr(0.75)},
+
+		{name: "temperature clamped for OpenAI", provider: OpenAIProvider, req: ChatCompletionRequest{Temperature: 3}, wantTemp: 2},
+		{name: "temperature clamped for Claude", provider: ClaudeProvider, req: ChatCompletionRequest{Temperature: 1.5}, wantTemp: 1},
+		{name: "temperature clamped for Gemini", provider: GeminiProvider, req: ChatCompletionRequest{Temperature: 2.5}, wantTemp: 2},
+
+		{name: "zero temperature for Gemini", provider: GeminiProvider, req: ChatCompletionRequest{}, wantTemp: math.SmallestNonzeroFloat32},
+		{name: "zero temperature for OpenAI", provider: OpenAIProvider, req: ChatCompletionRequest{}, wantTemp: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.req, tt.provider)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Creativity != nil {
+				t.Errorf("Creativity = %v, want it replaced", *got.Creativity)
+			}
+			if math.Abs(float64(got.Temperature-tt.wantTemp)) > 1e-6 || (tt.wantTemp != 0 && got.Temperature == 0) {
+				t.Errorf("Temperature = %v, want %v", got.Temperature, tt.wantTemp)
+			}
+			switch {
+			case tt.wantTopP == nil && got.TopP != nil:
+				t.Errorf("TopP = %v, want unset", *got.TopP)
+			case tt.wantTopP != nil && (got.TopP == nil || math.Abs(float64(*got.TopP-*tt.wantTopP)) > 1e-6):
+				t.Errorf("TopP = %v, want %v", got.TopP, *tt.wantTopP)
+			}
+		})
+	}
+}
+
+func TestNormalizeDoesNotModifyRequest(t *testing.T) {
+	creativity := float32(0.5)
+	req := ChatCompletionRequest{
+		Creativity: &creativity,
+		Messages:   []InputMessage{{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeImages, MediaType: "image/png", Images: []string{"aGk=", "aGk="}}}}},
+	}
+	if _, err := Normalize(req, OpenAIProvider); err != nil {
+		t.Fatal(err)
+	}
+	if req.Creativity == nil || req.Temperature != 0 || req.Messages[0].MultiContent[0].Type != ContentTypeImages {
+		t.Errorf("Normalize modified the caller's request: %+v", req)
+	}
+}
+
+func TestTopPOmittedWhenUnset(t *testing.T) {
+	topP := float32(0.9)
+
+	tests := []struct {
+		name     string
+		provider LLMProvider
+		topP     *float32
+		wantSent bool
+	}{
+		{"OpenAI unset", OpenAIProvider, nil, false},
+		{"OpenAI set", OpenAIProvider, &topP, true},
+		{"Claude unset", ClaudeProvider, nil, false},
+		{"Claude set", ClaudeProvider, &topP, true},
+		{"Gemini unset", GeminiProvider, nil, false},
+		{"Gemini set", GeminiProvider, &topP, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body string
+			capture := func(r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				body = string(b)
+			}
+
+			var model LLM
+			req := testRequest(DefaultModels[tt.provider], "hi")
+			req.MaxTokens = 100
+			req.TopP = tt.topP
+			field := `"top_p"`
+			switch tt.provider {
+			case OpenAIProvider:
+				model = newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+					capture(r)
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprint(w, `{"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"ok"}}]}`)
+				})
+			case ClaudeProvider:
+				model = newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+					capture(r)
+					writeClaudeMessage(w, "end_turn", `{"type":"text","text":"ok"}`)
+				})
+			case GeminiProvider:
+				field = `"topP"`
+				model = newTestGeminiLLM(t, func(w http.ResponseWriter, r *http.Request) {
+					capture(r)
+					// a filtered candidate ends the response before the closing bracket, see TestGeminiChatHistory
+					writeGeminiResponses(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":3}]}`)
+				})
+			}
+
+			if _, err := model.CreateChatCompletion(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			if sent := strings.Contains(body, field); sent != tt.wantSent {
+				t.Errorf("%s sent = %v, want %v: %s", field, sent, tt.wantSent, body)
+			}
+		})
+	}
+}
+
+func TestFewShotOrder(t *testing.T) {
+	system := "Translate to French."
+	req := testRequest(ModelGPT4o, "cheese")
+	req.SystemPrompt = &system
+	req.FewShot = []Example{{Input: "cat", Output: "chat"}, {Input: "dog", Output: "chien"}}
+
+	got, err := Normalize(req, OpenAIProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FewShot != nil {
+		t.Errorf("few-shot examples = %+v, want them expanded", got.FewShot)
+	}
+	if len(req.Messages) != 1 || len(req.FewShot) != 2 {
+		t.Errorf("the original request was modified: %+v", req)
+	}
+
+	var sent struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"fromage"},"finish_reason":"stop"}]}`)
+	})
+	if _, err := o.CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"system: Translate to French.",
+		"user: cat", "assistant: chat",
+		"user: dog", "assistant: chien",
+		"user: cheese",
+	}
+	var order []string
+	for _, m := range sent.Messages {
+		// content is either a string or a list of text parts
+		var text string
+		if err := json.Unmarshal(m.Content, &text); err != nil {
+			var parts []struct {
+				Text string `json:"text"`
+			}
+			if err := json.Unmarshal(m.Content, &parts); err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range parts {
+				text += p.Text
+			}
+		}
+		order = append(order, m.Role+": "+text)
+	}
+	if strings.Join(order, "|") != strings.Join(want, "|") {
+		t.Errorf("messages = %q, want %q", order, want)
+	}
+}
+
+func TestImagesExpansion(t *testing.T) {
+	pages := []string{"AAAA", "BBBB", "CCCC"}
+	req := testRequest(ModelGPT4o, "Summarize the pages.")
+	req.MaxTokens = 100
+	req.Messages[0].MultiContent = append(req.Messages[0].MultiContent, ContentPart{
+		Type: ContentTypeImages, MediaType: "image/jpeg", Images: pages, CacheControl: CacheControlEphemeral,
+	})
+
+	type block = map[string]any
+	var sent struct {
+		Messages []struct {
+			Content []block `json:"content"`
+		} `json:"messages"`
+	}
+	decode := func(r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		model Model
+		llm   LLM
+		// image returns the base64 data and whether the block is cacheable
+		image func(b block) (string, bool)
+		// wantCached is set if the last image keeps the part's cache control
+		wantCached bool
+	}{
+		{
+			name:  "openai",
+			model: ModelGPT4o,
+			llm: newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+				decode(r)
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`)
+			}),
+			image: func(b block) (string, bool) {
+				url, _ := b["image_url"].(map[string]any)["url"].(string)
+				return strings.TrimPrefix(url, "data:image/jpeg;base64,"), false
+			},
+		},
+		{
+			name:  "claude",
+			model: ModelClaude3Dot5SonnetLatest,
+			llm: newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				decode(r)
+				writeClaudeMessage(w, "end_turn", `{"type":"text","text":"ok"}`)
+			}),
+			image: func(b block) (string, bool) {
+				source, _ := b["source"].(map[string]any)
+				if source["media_type"] != "image/jpeg" {
+					return "", false
+				}
+				data, _ := source["data"].(string)
+				return data, b["cache_control"] != nil
+			},
+			wantCached: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := req
+			req.Model = tt.model
+			if _, err := tt.llm.CreateChatCompletion(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+
+			content := sent.Messages[0].Content
+			if len(content) != 1+len(pages) {
+				t.Fatalf("got %d blocks, want the text and %d images: %v", len(content), len(pages), content)
+			}
+			for i, page := range pages {
+				data, cacheable := tt.image(content[i+1])
+				if data != page {
+					t.Errorf("image %d = %v, want page %q", i, content[i+1], page)
+				}
+				if cacheable != (tt.wantCached && i == len(pages)-1) {
+					t.Errorf("image %d cacheable = %v, want only the last image cached", i, cacheable)
+				}
+			}
+		})
+	}
+}
+
+func TestCreativityParameters(t *testing.T) {
+	tests := []struct {
+		provider   LLMProvider
+		creativity float32
+		wantTemp   float64
+		wantTopP   float64
+	}{
+		{OpenAIProvider, 0.5, 0.75, 0.75},
+		{OpenAIProvider, 1, 1.5, 1},
+		{ClaudeProvider, 0.5, 0.5, 0.75},
+		{ClaudeProvider, 1, 1, 1},
+		{GeminiProvider, 0.5, 0.75, 0.75},
+		{GeminiProvider, 1, 1.5, 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v", tt.provider, tt.creativity), func(t *testing.T) {
+			var body map[string]any
+			capture := func(r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+			}
+
+			var model LLM
+			// params returns the sampling parameters of the captured request
+			params := func() map[string]any { return body }
+			topPField := "top_p"
+			switch tt.provider {
+			case OpenAIProvider:
+				model = newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+					capture(r)
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprint(w, `{"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"ok"}}]}`)
+				})
+			case ClaudeProvider:
+				model = newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+					capture(r)
+					writeClaudeMessage(w, "end_turn", `{"type":"text","text":"ok"}`)
+				})
+			case GeminiProvider:
+				topPField = "topP"
+				params = func() map[string]any {
+					config, _ := body["generationConfig"].(map[string]any)
+					return config
+				}
+				model = newTestGeminiLLM(t, func(w http.ResponseWriter, r *http.Request) {
+					capture(r)
+					// a filtered candidate ends the response before the closing bracket, see TestGeminiChatHistory
+					writeGeminiResponses(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":3}]}`)
+				})
+			}
+
+			// Creativity overrides the sampling parameters of the request
+			topP := float32(0.2)
+			req := testRequest(DefaultModels[tt.provider], "hi")
+			req.MaxTokens = 100
+			req.Temperature = 0.1
+			req.TopP = &topP
+			req.Creativity = &tt.creativity
+			if _, err := model.CreateChatCompletion(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+
+			sent := params()
+			temp, _ := sent["temperature"].(float64)
+			if math.Abs(temp-tt.wantTemp) > 1e-6 {
+				t.Errorf("temperature = %v, want %v", sent["temperature"], tt.wantTemp)
+			}
+			gotTopP, _ := sent[topPField].(float64)
+			if math.Abs(gotTopP-tt.wantTopP) > 1e-6 {
+				t.Errorf("%s = %v, want %v", topPField, sent[topPField], tt.wantTopP)
+			}
+		})
+	}
+}
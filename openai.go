@@ -7,24 +7,36 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 )
 
 // OpenAILLM implements the LLM interface for OpenAI
 type OpenAILLM struct {
-	client *openai.Client
+	client  *openai.Client
+	timeout time.Duration
+	// azure is set for Azure deployments, whose pinned API version does not
+	// accept stream_options
+	azure      bool
+	conversion conversionConfig
 }
 
 type OpenAIModel string
 
 // NewOpenAILLM creates a new OpenAI LLM client
-func NewOpenAILLM(apiKey string) *OpenAILLM {
-	client := openai.NewClient(apiKey)
-	return &OpenAILLM{client: client}
+func NewOpenAILLM(apiKey string, opts ...ClientOption) *OpenAILLM {
+	config := openai.DefaultConfig(apiKey)
+	cfg := newClientConfig(opts)
+	if httpClient := cfg.httpClient(); httpClient != nil {
+		config.HTTPClient = httpClient
+	}
+
+	client := openai.NewClientWithConfig(config)
+	return &OpenAILLM{client: client, timeout: cfg.timeout, conversion: cfg.conversion}
 }
 
-func NewAzureLLM(apiKey string, azureOpenAIEndpoint string) *OpenAILLM {
+func NewAzureLLM(apiKey string, azureOpenAIEndpoint string, opts ...ClientOption) *OpenAILLM {
 	// The latest API versions, including previews, can be found here:
 	// https://learn.microsoft.com/en-us/azure/ai-services/openai/reference#rest-api-versioning
 	config := openai.DefaultAzureConfig(apiKey, azureOpenAIEndpoint)
@@ -38,8 +50,45 @@ func NewAzureLLM(apiKey string, azureOpenAIEndpoint string) *OpenAILLM {
 	//    return azureModelMapping[model]
 	//}
 
+	cfg := newClientConfig(opts)
+	if httpClient := cfg.httpClient(); httpClient != nil {
+		config.HTTPClient = httpClient
+	}
+
 	client := openai.NewClientWithConfig(config)
-	return &OpenAILLM{client: client}
+	return &OpenAILLM{client: client, timeout: cfg.timeout, azure: true, conversion: cfg.conversion}
+}
+
+// convertToOpenAIChatMessages converts the messages of the request and adds
+// the system prompt according to its SystemPlacement
+func convertToOpenAIChatMessages(req ChatCompletionRequest) ([]openai.ChatCompletionMessage, error) {
+	messages := convertToOpenAIMessages(req.Messages)
+	systemPrompt, ok := req.systemPromptText()
+	if !ok {
+		return messages, nil
+	}
+
+	switch req.SystemPlacement {
+	case SystemPlacementMessage:
+		return append([]openai.ChatCompletionMessage{{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: systemPrompt,
+		}}, messages...), nil
+	case SystemPlacementFirstUser:
+		systemPart := openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: systemPrompt}
+		for i, msg := range messages {
+			if msg.Role == openai.ChatMessageRoleUser {
+				messages[i].MultiContent = append([]openai.ChatMessagePart{systemPart}, msg.MultiContent...)
+				return messages, nil
+			}
+		}
+		return append([]openai.ChatCompletionMessage{{
+			Role:         openai.ChatMessageRoleUser,
+			MultiContent: []openai.ChatMessagePart{systemPart},
+		}}, messages...), nil
+	default:
+		return nil, fmt.Errorf("unknown system placement %q", req.SystemPlacement)
+	}
 }
 
 // convertToOpenAIMessages converts our generic Message type to OpenAI's message type
@@ -58,21 +107,43 @@ func convertToOpenAIMessages(messages []InputMessage) []openai.ChatCompletionMes
 			role = openai.ChatMessageRoleTool
 		}
 
-		var openAIMsg openai.ChatCompletionMessage
-		openAIMsg.Role = role
 		if msg.Role == RoleTool {
-			openAIMsg.Content = msg.ToolResults[0].Result
-			openAIMsg.ToolCallID = msg.ToolResults[0].ToolCallID
-		} else {
-			openAIMsg.MultiContent = convertOpenAIMessageContent(msg.MultiContent)
-			openAIMsg.ToolCalls = convertToOpenAIToolsCalls(msg.ToolCalls)
+			// OpenAI expects one tool message per tool call
+			for _, toolResult := range msg.ToolResults {
+				openAIMessages = append(openAIMessages, openai.ChatCompletionMessage{
+					Role:       role,
+					Content:    convertToOpenAIToolResultContent(toolResult),
+					ToolCallID: toolResult.ToolCallID,
+				})
+			}
+			continue
 		}
 
+		var openAIMsg openai.ChatCompletionMessage
+		openAIMsg.Role = role
+		openAIMsg.MultiContent = convertOpenAIMessageContent(msg.MultiContent)
+		openAIMsg.ToolCalls = convertToOpenAIToolsCalls(msg.ToolCalls)
+
 		openAIMessages = append(openAIMessages, openAIMsg)
 	}
 	return openAIMessages
 }
 
+// convertToOpenAIToolResultContent joins the text of a tool result, as OpenAI
+// tool messages only support text
+func convertToOpenAIToolResultContent(toolResult ToolResult) string {
+	var texts []string
+	if toolResult.Result != "" {
+		texts = append(texts, toolResult.Result)
+	}
+	for _, part := range toolResult.ResultParts {
+		if part.Type == ContentTypeText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
 func convertOpenAIMessageContent(content []ContentPart) []openai.ChatMessagePart {
 	multiContent := make([]openai.ChatMessagePart, 0, len(content))
 	for _, part := range content {
@@ -96,28 +167,36 @@ func convertOpenAIMessageContent(content []ContentPart) []openai.ChatMessagePart
 	return multiContent
 }
 
-// convertFromOpenAIMessage converts OpenAI's message type to our generic Message type
-func convertFromOpenAIMessage(msg openai.ChatCompletionMessage) OutputMessage {
+// convertFromOpenAIMessage converts OpenAI's message type to our generic Message type,
+// joining the text parts of multi-content messages with separator
+func convertFromOpenAIMessage(msg openai.ChatCompletionMessage, separator string) OutputMessage {
 
 	var content string
+	var contentParts []ContentPart
 	if len(msg.MultiContent) > 0 {
 		// Handle multi-content messages
 		var textParts []string
 		for _, part := range msg.MultiContent {
 			if part.Type == openai.ChatMessagePartTypeText {
 				textParts = append(textParts, part.Text)
+				contentParts = append(contentParts, ContentPart{Type: ContentTypeText, Text: part.Text})
 			}
 		}
-		content = strings.Join(textParts, "")
+		content = strings.Join(textParts, separator)
 	} else {
 		// Handle regular content
 		content = msg.Content
+		if content != "" {
+			contentParts = []ContentPart{{Type: ContentTypeText, Text: content}}
+		}
 	}
 
 	return OutputMessage{
-		Role:      Role(msg.Role),
-		Content:   content,
-		ToolCalls: convertFromOpenAIToolCalls(msg.ToolCalls),
+		Role:         Role(msg.Role),
+		Content:      content,
+		ToolCalls:    convertFromOpenAIToolCalls(msg.ToolCalls),
+		ContentParts: contentParts,
+		Refusal:      msg.Refusal,
 	}
 }
 
@@ -186,53 +265,73 @@ func convertFromOpenAIToolCalls(toolCalls []openai.ToolCall) []ToolCall {
 	return calls
 }
 
+// ProviderName returns OpenAIProvider
+func (o *OpenAILLM) ProviderName() LLMProvider {
+	return OpenAIProvider
+}
+
 // CreateChatCompletion implements the LLM interface for OpenAI
 func (o *OpenAILLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	ctx, cancel := withRequestTimeout(ctx, o.timeout)
+	defer cancel()
 
 	// check if model is compatible with OpenAI
 	if !o.isSupported(req.Model) {
 		return ChatCompletionResponse{}, fmt.Errorf("model %s is not available", req.Model)
 	}
-
-	topP := float32(1)
-	if req.TopP != nil {
-		topP = *req.TopP
+	if err := validateRequestSize(req, OpenAIProvider); err != nil {
+		return ChatCompletionResponse{}, err
 	}
+	if err := o.conversion.validate(req, OpenAIProvider); err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	o.conversion.reportIgnored(req, OpenAIProvider)
 
-	// Set system prompt if provided
-	var messages []openai.ChatCompletionMessage
-	if req.SystemPrompt != nil {
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: *req.SystemPrompt,
-		})
+	req, err := Normalize(req, OpenAIProvider)
+	if err != nil {
+		return ChatCompletionResponse{}, err
 	}
 
-	inputMessages := convertToOpenAIMessages(req.Messages)
-	messages = append(messages, inputMessages...)
+	messages, err := convertToOpenAIChatMessages(req)
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
 
 	openAIReq := openai.ChatCompletionRequest{
-		Model:               string(req.Model), // TODO: convert model name to OpenAI model name
-		Messages:            messages,
-		Temperature:         req.Temperature,
-		N:                   1,
-		TopP:                topP,
-		Stop:                []string{},
-		Tools:               convertToOpenAITools(req.Tools),
-		Stream:              false,
-		MaxCompletionTokens: req.MaxTokens,
-	}
-
-	if req.JSONMode {
+		Model:       string(req.Model), // TODO: convert model name to OpenAI model name
+		Messages:    messages,
+		Temperature: req.Temperature,
+		N:           1,
+		TopP:        valueOrZero(req.TopP),
+		User:        req.User,
+		Store:       valueOrZero(req.Store),
+		Metadata:    req.Metadata,
+		Seed:        req.Seed,
+		Stop:        req.Stop,
+		Tools:       convertToOpenAITools(req.Tools),
+		Stream:      false,
+	}
+
+	setOpenAIMaxTokens(&openAIReq, req)
+	clearOpenAISamplingParameters(&openAIReq, req)
+
+	if ext, ok := req.Extensions[OpenAIProvider].(OpenAIExtensions); ok {
+		ext.apply(&openAIReq)
+	}
+
+	if req.ResponseSchema != nil {
+		openAIReq.ResponseFormat = convertToOpenAIResponseFormat(req.ResponseSchema)
+	} else if req.JSONMode {
 		openAIReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
 			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
 		}
 	}
 
-	if req.Model == ModelO3Mini {
-		openAIReq.ReasoningEffort = "high"
+	if req.ReasoningEffort != nil && openAIReasoningEffortModels[req.Model] {
+		openAIReq.ReasoningEffort = *req.ReasoningEffort
 	}
 
+	ctx, raw := withRawResponseCapture(ctx)
 	resp, err := o.client.CreateChatCompletion(ctx, openAIReq)
 	if err != nil {
 		return ChatCompletionResponse{}, err
@@ -240,38 +339,112 @@ func (o *OpenAILLM) CreateChatCompletion(ctx context.Context, req ChatCompletion
 
 	choices := make([]Choice, len(resp.Choices))
 	for i, c := range resp.Choices {
-		msg := convertFromOpenAIMessage(c.Message)
+		msg := convertFromOpenAIMessage(c.Message, o.conversion.textPartSeparator)
 		msg.ToolCalls = convertFromOpenAIToolCalls(c.Message.ToolCalls)
-		finishReason, err := convertFromOpenAIFinishReason(c.FinishReason)
-		if err != nil {
-			return ChatCompletionResponse{}, err
+		finishReason := convertFromOpenAIFinishReason(c.FinishReason)
+		if msg.Refusal != "" && finishReason == FinishReasonStop {
+			finishReason = FinishReasonRefusal
 		}
 		choices[i] = Choice{
-			Index:        c.Index,
-			Message:      msg,
-			FinishReason: finishReason,
+			Index:           c.Index,
+			Message:         msg,
+			FinishReason:    finishReason,
+			RawFinishReason: string(c.FinishReason),
 		}
 	}
 
 	return ChatCompletionResponse{
-		ID:      resp.ID,
-		Choices: choices,
+		ID:                resp.ID,
+		SystemFingerprint: resp.SystemFingerprint,
+		Choices:           choices,
 		Usage: Usage{
-			PromptTokens:     resp.Usage.PromptTokens,
-			CompletionTokens: resp.Usage.CompletionTokens,
-			TotalTokens:      resp.Usage.TotalTokens,
+			PromptTokens:       resp.Usage.PromptTokens,
+			CompletionTokens:   resp.Usage.CompletionTokens,
+			TotalTokens:        resp.Usage.TotalTokens,
+			CachedPromptTokens: openAICachedTokens(resp.Usage),
 		},
+		RawResponse: raw.json(),
 	}, nil
 }
 
-func (o *OpenAILLM) isSupported(model Model) bool {
+// openAIReasoningModels are the o-series models, which reject max_tokens.
+var openAIReasoningModels = map[Model]bool{
+	ModelO1:                  true,
+	ModelO1_2024_12_17:       true,
+	ModelO1Preview:           true,
+	ModelO1Preview2024_09_12: true,
+	ModelO1Mini:              true,
+	ModelO1Mini2024_09_12:    true,
+	ModelO3Mini:              true,
+	ModelO3Mini2025_01_31:    true,
+}
+
+// convertToOpenAIResponseFormat returns the json_schema response format for the schema
+func convertToOpenAIResponseFormat(schema *ResponseSchema) *openai.ChatCompletionResponseFormat {
+	name := schema.Name
+	if name == "" {
+		name = "response"
+	}
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   name,
+			Schema: openAISchema(schema.Schema),
+			Strict: schema.Strict,
+		},
+	}
+}
+
+// openAISchema is a JSON Schema as expected by go-openai's response format
+type openAISchema map[string]interface{}
 
+func (s openAISchema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}(s))
+}
+
+// setOpenAIMaxTokens sets the output limit as max_completion_tokens for
+// reasoning models and as max_tokens for other models, as older models and
+// many OpenAI compatible gateways only know max_tokens
+func setOpenAIMaxTokens(openAIReq *openai.ChatCompletionRequest, req ChatCompletionRequest) {
+	if openAIReasoningModels[req.Model] {
+		openAIReq.MaxCompletionTokens = req.MaxTokens
+	} else {
+		openAIReq.MaxTokens = req.MaxTokens
+	}
+}
+
+// clearOpenAISamplingParameters omits temperature and top_p for reasoning
+// models, which reject any value but their default, e.g. one set by Creativity
+func clearOpenAISamplingParameters(openAIReq *openai.ChatCompletionRequest, req ChatCompletionRequest) {
+	if openAIReasoningModels[req.Model] {
+		openAIReq.Temperature = 0
+		openAIReq.TopP = 0
+	}
+}
+
+// openAIReasoningEffortModels are the models accepting a reasoning effort.
+var openAIReasoningEffortModels = map[Model]bool{
+	ModelO1:               true,
+	ModelO1_2024_12_17:    true,
+	ModelO3Mini:           true,
+	ModelO3Mini2025_01_31: true,
+}
+
+func (o *OpenAILLM) isSupported(model Model) bool {
 	switch model {
-	case ModelO3Mini:
-		return true
-	case ModelGPT4o:
-		return true
-	case ModelGPT4oMini:
+	case ModelChatGPT4oLatest,
+		ModelGPT4o,
+		ModelGPT4oMini,
+		ModelGPT4o2024_08_06,
+		ModelGPT4oMini2024_07_18,
+		ModelO1,
+		ModelO1_2024_12_17,
+		ModelO1Preview2024_09_12,
+		ModelO1Preview,
+		ModelO1Mini,
+		ModelO1Mini2024_09_12,
+		ModelO3Mini,
+		ModelO3Mini2025_01_31:
 		return true
 	default:
 		return false
@@ -283,26 +456,41 @@ type openAIStreamWrapper struct {
 	stream          *openai.ChatCompletionStream
 	currentToolCall *ToolCall
 	toolCallBuffer  map[string]*ToolCall
+	// bufferOrder holds the IDs of the buffered tool calls in the order they started
+	bufferOrder []string
+	// toolCallIndex holds the position of every tool call in the message, used for ToolCallDeltas
+	toolCallIndex map[string]int
+	// refused is set once the stream contained a refusal
+	refused bool
+	// content and toolCalls hold the output delivered so far
+	content   strings.Builder
+	toolCalls []ToolCall
+	// pending and pendingErr hold what was read ahead of the final chunk
+	pending    *openai.ChatCompletionStreamResponse
+	pendingErr error
 }
 
 func newOpenAIStreamWrapper(stream *openai.ChatCompletionStream) *openAIStreamWrapper {
 	return &openAIStreamWrapper{
 		stream:         stream,
 		toolCallBuffer: make(map[string]*ToolCall),
+		toolCallIndex:  make(map[string]int),
 	}
 }
 
 func (w *openAIStreamWrapper) Recv() (ChatCompletionResponse, error) {
-	resp, err := w.stream.Recv()
+	resp, err := w.next()
 	if err != nil {
 		if err == io.EOF {
 			return ChatCompletionResponse{}, err
 		}
 		var openAIErr *openai.APIError
 		if errors.As(err, &openAIErr) {
-			return ChatCompletionResponse{}, fmt.Errorf("OpenAI API error: %s - %s", openAIErr.Code, openAIErr.Message)
+			err = fmt.Errorf("OpenAI API error: %w", openAIErr)
+		} else {
+			err = fmt.Errorf("stream receive failed: %w", err)
 		}
-		return ChatCompletionResponse{}, fmt.Errorf("stream receive failed: %w", err)
+		return ChatCompletionResponse{}, newStreamError(err, w.content.String(), w.toolCalls)
 	}
 
 	choices := make([]Choice, len(resp.Choices))
@@ -310,6 +498,7 @@ func (w *openAIStreamWrapper) Recv() (ChatCompletionResponse, error) {
 
 		// Handle tool calls in delta
 		var toolCalls []ToolCall
+		var deltas []ToolCallDelta
 		if len(c.Delta.ToolCalls) > 0 {
 			toolCalls = make([]ToolCall, 0)
 			for _, tc := range c.Delta.ToolCalls {
@@ -320,6 +509,10 @@ func (w *openAIStreamWrapper) Recv() (ChatCompletionResponse, error) {
 						// Skip empty IDs but accumulate arguments if present
 						if tc.Function.Arguments != "" && w.currentToolCall != nil {
 							w.currentToolCall.Function.Arguments += tc.Function.Arguments
+							deltas = append(deltas, ToolCallDelta{
+								Index:     w.toolCallIndex[w.currentToolCall.ID],
+								Arguments: tc.Function.Arguments,
+							})
 
 							// Try to parse the arguments to verify if it's complete JSON
 							if isValidJSON(w.currentToolCall.Function.Arguments) {
@@ -341,8 +534,16 @@ func (w *openAIStreamWrapper) Recv() (ChatCompletionResponse, error) {
 						},
 					}
 					w.toolCallBuffer[tc.ID] = toolCall
+					w.bufferOrder = append(w.bufferOrder, tc.ID)
+					w.toolCallIndex[tc.ID] = len(w.toolCallIndex)
 					w.currentToolCall = toolCall
 				}
+				deltas = append(deltas, ToolCallDelta{
+					Index:     w.toolCallIndex[tc.ID],
+					ID:        tc.ID,
+					Name:      tc.Function.Name,
+					Arguments: tc.Function.Arguments,
+				})
 
 				// Accumulate tool call data
 				if tc.Function.Name != "" {
@@ -363,29 +564,108 @@ func (w *openAIStreamWrapper) Recv() (ChatCompletionResponse, error) {
 			}
 		}
 
+		// The final chunk may carry only the finish reason, so tool calls whose
+		// arguments never became valid JSON, e.g. calls without arguments, are flushed here
+		if c.FinishReason != "" && c.FinishReason != openai.FinishReasonNull {
+			toolCalls = append(toolCalls, w.flushToolCalls()...)
+		}
+
 		// Create the message with accumulated content
 		message := OutputMessage{
-			Role:      Role(c.Delta.Role),
-			Content:   c.Delta.Content,
-			ToolCalls: toolCalls,
+			Role:           Role(c.Delta.Role),
+			Content:        c.Delta.Content,
+			ToolCalls:      toolCalls,
+			Refusal:        c.Delta.Refusal,
+			ToolCallDeltas: deltas,
 		}
 
-		finishReason, err := convertFromOpenAIFinishReason(c.FinishReason)
-		if err != nil {
-			return ChatCompletionResponse{}, err
+		if c.Index == 0 {
+			w.content.WriteString(c.Delta.Content)
+			w.toolCalls = append(w.toolCalls, toolCalls...)
+		}
+		if c.Delta.Refusal != "" {
+			w.refused = true
+		}
+		finishReason := convertFromOpenAIFinishReason(c.FinishReason)
+		if w.refused && finishReason == FinishReasonStop {
+			finishReason = FinishReasonRefusal
 		}
 
 		choices[i] = Choice{
-			Index:        c.Index,
-			Message:      message,
-			FinishReason: finishReason,
+			Index:           c.Index,
+			Message:         message,
+			FinishReason:    finishReason,
+			RawFinishReason: string(c.FinishReason),
 		}
 	}
 
-	return ChatCompletionResponse{
-		ID:      resp.ID,
-		Choices: choices,
-	}, nil
+	response := ChatCompletionResponse{
+		ID:                resp.ID,
+		SystemFingerprint: resp.SystemFingerprint,
+		Choices:           choices,
+	}
+	if resp.Usage != nil {
+		response.Usage = Usage{
+			PromptTokens:       resp.Usage.PromptTokens,
+			CompletionTokens:   resp.Usage.CompletionTokens,
+			TotalTokens:        resp.Usage.TotalTokens,
+			CachedPromptTokens: openAICachedTokens(*resp.Usage),
+		}
+	}
+	return response, nil
+}
+
+// next returns the next chunk of the stream. OpenAI sends the usage in a chunk
+// without choices after the final chunk, so it is read ahead and attached to
+// the final chunk, after which StreamChatCompletion stops reading.
+func (w *openAIStreamWrapper) next() (openai.ChatCompletionStreamResponse, error) {
+	if w.pending != nil {
+		resp := *w.pending
+		w.pending = nil
+		return resp, nil
+	}
+	if w.pendingErr != nil {
+		return openai.ChatCompletionStreamResponse{}, w.pendingErr
+	}
+
+	resp, err := w.stream.Recv()
+	if err != nil || resp.Usage != nil || !hasOpenAIFinishReason(resp) {
+		return resp, err
+	}
+
+	usageChunk, err := w.stream.Recv()
+	switch {
+	case err != nil:
+		w.pendingErr = err
+	case usageChunk.Usage != nil && len(usageChunk.Choices) == 0:
+		resp.Usage = usageChunk.Usage
+	default:
+		w.pending = &usageChunk
+	}
+	return resp, nil
+}
+
+func hasOpenAIFinishReason(resp openai.ChatCompletionStreamResponse) bool {
+	for _, c := range resp.Choices {
+		if c.FinishReason != "" && c.FinishReason != openai.FinishReasonNull {
+			return true
+		}
+	}
+	return false
+}
+
+// flushToolCalls returns the tool calls still buffered, in the order they started
+func (w *openAIStreamWrapper) flushToolCalls() []ToolCall {
+	var toolCalls []ToolCall
+	for _, id := range w.bufferOrder {
+		if toolCall, ok := w.toolCallBuffer[id]; ok {
+			toolCalls = append(toolCalls, *toolCall)
+			delete(w.toolCallBuffer, id)
+		}
+	}
+	w.bufferOrder = nil
+	w.currentToolCall = nil
+	return toolCalls
 }
 
 // Helper function to check if a string is valid JSON
@@ -394,25 +674,22 @@ func isValidJSON(s string) bool {
 	return json.Unmarshal([]byte(s), &js) == nil
 }
 
-func convertFromOpenAIFinishReason(reason openai.FinishReason) (FinishReason, error) {
-
+func convertFromOpenAIFinishReason(reason openai.FinishReason) FinishReason {
 	switch reason {
 	case openai.FinishReasonToolCalls:
-		return FinishReasonToolCalls, nil
+		return FinishReasonToolCalls
 	case openai.FinishReasonStop:
-		return FinishReasonStop, nil
+		return FinishReasonStop
 	case openai.FinishReasonLength:
-		return FinishReasonMaxTokens, nil
+		return FinishReasonMaxTokens
 	case openai.FinishReasonFunctionCall:
-		return FinishReasonToolCalls, nil
+		return FinishReasonToolCalls
 	case openai.FinishReasonContentFilter:
-		return FinishReasonStop, nil
-	case openai.FinishReasonNull:
-		return FinishReasonNull, nil
-	case "":
-		return FinishReasonNull, nil
+		return FinishReasonContentFilter
+	case openai.FinishReasonNull, "":
+		return FinishReasonNull
 	default:
-		return FinishReason(""), fmt.Errorf("default case reason: %s", reason)
+		return FinishReasonOther
 	}
 }
 
@@ -422,41 +699,66 @@ func (w *openAIStreamWrapper) Close() error {
 
 // CreateChatCompletionStream implements the LLM interface for OpenAI streaming
 func (o *OpenAILLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	return withStreamTimeout(ctx, o.timeout, func(ctx context.Context) (ChatCompletionStream, error) {
+		return o.createChatCompletionStream(ctx, req)
+	})
+}
+
+func (o *OpenAILLM) createChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
 
 	// check if model is compatible with OpenAI
 	if !o.isSupported(req.Model) {
 		return nil, fmt.Errorf("model %s is not available", req.Model)
 	}
-	topP := float32(1)
-	if req.TopP != nil {
-		topP = *req.TopP
+	if err := validateRequestSize(req, OpenAIProvider); err != nil {
+		return nil, err
 	}
-
-	// Set system prompt if provided
-	var messages []openai.ChatCompletionMessage
-	if req.SystemPrompt != nil {
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: *req.SystemPrompt,
-		})
+	if err := o.conversion.validate(req, OpenAIProvider); err != nil {
+		return nil, err
+	}
+	o.conversion.reportIgnored(req, OpenAIProvider)
+	req, err := Normalize(req, OpenAIProvider)
+	if err != nil {
+		return nil, err
 	}
 
-	inputMessages := convertToOpenAIMessages(req.Messages)
-	messages = append(messages, inputMessages...)
+	messages, err := convertToOpenAIChatMessages(req)
+	if err != nil {
+		return nil, err
+	}
 
 	openAIReq := openai.ChatCompletionRequest{
-		Model:               string(req.Model), // TODO: convert model name
-		Messages:            messages,
-		Temperature:         req.Temperature,
-		N:                   1,
-		Stop:                []string{},
-		Tools:               convertToOpenAITools(req.Tools),
-		Stream:              true,
-		TopP:                topP,
-		MaxCompletionTokens: req.MaxTokens,
-	}
-
-	if req.JSONMode {
+		Model:       string(req.Model), // TODO: convert model name
+		Messages:    messages,
+		Temperature: req.Temperature,
+		N:           1,
+		Stop:        req.Stop,
+		Tools:       convertToOpenAITools(req.Tools),
+		Stream:      true,
+		TopP:        valueOrZero(req.TopP),
+		User:        req.User,
+		Store:       valueOrZero(req.Store),
+		Metadata:    req.Metadata,
+		Seed:        req.Seed,
+	}
+
+	if !o.azure {
+		openAIReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if req.ReasoningEffort != nil && openAIReasoningEffortModels[req.Model] {
+		openAIReq.ReasoningEffort = *req.ReasoningEffort
+	}
+
+	setOpenAIMaxTokens(&openAIReq, req)
+	clearOpenAISamplingParameters(&openAIReq, req)
+
+	if ext, ok := req.Extensions[OpenAIProvider].(OpenAIExtensions); ok {
+		ext.apply(&openAIReq)
+	}
+
+	if req.ResponseSchema != nil {
+		openAIReq.ResponseFormat = convertToOpenAIResponseFormat(req.ResponseSchema)
+	} else if req.JSONMode {
 		openAIReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
 			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
 		}
@@ -466,10 +768,69 @@ func (o *OpenAILLM) CreateChatCompletionStream(ctx context.Context, req ChatComp
 	if err != nil {
 		var openAIErr *openai.APIError
 		if errors.As(err, &openAIErr) {
-			return nil, fmt.Errorf("OpenAI API error: %s - %s", openAIErr.Code, openAIErr.Message)
+			return nil, fmt.Errorf("OpenAI API error: %w", openAIErr)
 		}
 		return nil, fmt.Errorf("stream creation failed: %w", err)
 	}
 
 	return newOpenAIStreamWrapper(stream), nil
 }
+
+// ListBatches returns all batches of the OpenAI account
+func (o *OpenAILLM) ListBatches(ctx context.Context) ([]Batch, error) {
+	var batches []Batch
+	var after *string
+	for {
+		resp, err := o.client.ListBatch(ctx, after, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list batches: %w", err)
+		}
+		for _, b := range resp.Data {
+			batches = append(batches, convertFromOpenAIBatch(b))
+		}
+		if !resp.HasMore || resp.LastID == "" {
+			return batches, nil
+		}
+		lastID := resp.LastID
+		after = &lastID
+	}
+}
+
+// CancelBatch cancels the batch with the given id
+func (o *OpenAILLM) CancelBatch(ctx context.Context, id string) (Batch, error) {
+	resp, err := o.client.CancelBatch(ctx, id)
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to cancel batch %s: %w", id, err)
+	}
+	return convertFromOpenAIBatch(resp.Batch), nil
+}
+
+func convertFromOpenAIBatch(b openai.Batch) Batch {
+	return Batch{
+		ID:        b.ID,
+		Status:    convertFromOpenAIBatchStatus(b.Status),
+		CreatedAt: time.Unix(int64(b.CreatedAt), 0),
+	}
+}
+
+func convertFromOpenAIBatchStatus(status string) BatchStatus {
+	switch status {
+	case "completed":
+		return BatchStatusCompleted
+	case "failed", "expired":
+		return BatchStatusFailed
+	case "cancelling", "cancelled":
+		return BatchStatusCancelled
+	default:
+		// validating, in_progress and finalizing
+		return BatchStatusInProgress
+	}
+}
+
+// openAICachedTokens returns the number of prompt tokens read from the cache
+func openAICachedTokens(usage openai.Usage) int {
+	if usage.PromptTokensDetails == nil {
+		return 0
+	}
+	return usage.PromptTokensDetails.CachedTokens
+}
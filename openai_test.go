@@ -0,0 +1,630 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newTestOpenAILLM returns a client sending its requests to handler
+func newTestOpenAILLM(t *testing.T, handler http.HandlerFunc, opts ...ClientOption) *OpenAILLM {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	config := openai.DefaultConfig("test")
+	config.BaseURL = srv.URL + "/v1"
+	cfg := newClientConfig(opts)
+	if httpClient := cfg.httpClient(); httpClient != nil {
+		config.HTTPClient = httpClient
+	}
+	return &OpenAILLM{client: openai.NewClientWithConfig(config), conversion: cfg.conversion}
+}
+
+// writeOpenAIStream writes the chunks as a server-sent event stream
+func writeOpenAIStream(w http.ResponseWriter, chunks ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, chunk := range chunks {
+		fmt.Fprintf(w, "data: %s\n\n", chunk)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// writeOpenAIRateLimit answers with a rate limit error
+func writeOpenAIRateLimit(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	fmt.Fprint(w, `{"error":{"message":"rate limited","type":"rate_limit_error"}}`)
+}
+
+func testRequest(model Model, text string) ChatCompletionRequest {
+	return ChatCompletionRequest{
+		Model:    model,
+		Messages: []InputMessage{{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: text}}}},
+	}
+}
+
+func TestOpenAIStreamErrorKeepsAPIError(t *testing.T) {
+	o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+		writeOpenAIRateLimit(w)
+	})
+
+	_, err := o.CreateChatCompletionStream(context.Background(), testRequest(ModelGPT4o, "hi"))
+	var apiErr *openai.APIError
+	if !strings.Contains(fmt.Sprint(err), "rate limited") || !errors.As(err, &apiErr) {
+		t.Fatalf("got %v, want a wrapped *openai.APIError", err)
+	}
+	if apiErr.HTTPStatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", apiErr.HTTPStatusCode)
+	}
+	if !isRetryableError(context.Background(), err) {
+		t.Error("a rate limit of the OpenAI stream is not retryable")
+	}
+}
+
+func TestOpenAIStreamRateLimitIsRetried(t *testing.T) {
+	var attempts int
+	o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			writeOpenAIRateLimit(w)
+			return
+		}
+		writeOpenAIStream(w, `{"id":"1","choices":[{"index":0,"delta":{"content":"hello"},"finish_reason":"stop"}]}`)
+	})
+
+	stream, err := WithStreamRetry(o, StreamRetryConfig{MaxRetries: 2}).
+		CreateChatCompletionStream(context.Background(), testRequest(ModelGPT4o, "hi"))
+	if err != nil {
+		t.Fatalf("stream was not retried: %v", err)
+	}
+	defer stream.Close()
+
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "hello" {
+		t.Errorf("content = %q, want %q", got, "hello")
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+}
+
+func TestOpenAIStreamOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		azure bool
+		want  bool
+	}{
+		{"openai requests usage", false, true},
+		{"azure omits stream_options", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent bool
+			o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				sent = strings.Contains(string(body), `"stream_options"`)
+				writeOpenAIStream(w, `{"id":"1","choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":"stop"}]}`)
+			})
+			o.azure = tt.azure
+
+			stream, err := o.CreateChatCompletionStream(context.Background(), testRequest(ModelGPT4o, "hi"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			stream.Close()
+			if sent != tt.want {
+				t.Errorf("stream_options sent = %v, want %v", sent, tt.want)
+			}
+		})
+	}
+}
+
+// accumulatingHandler assembles tool call deltas during StreamChatCompletion
+type accumulatingHandler struct {
+	recordingHandler
+	ToolCallAccumulator
+	toolCalls []ToolCall
+}
+
+func (h *accumulatingHandler) OnToolCall(toolCall ToolCall) {
+	h.toolCalls = append(h.toolCalls, toolCall)
+}
+
+func TestOpenAIStreamToolCallDeltas(t *testing.T) {
+	o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+		writeOpenAIStream(w,
+			`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		)
+	})
+
+	handler := &accumulatingHandler{}
+	if err := StreamChatCompletion(context.Background(), testRequest(ModelGPT4o, "weather?"), handler, o); err != nil {
+		t.Fatal(err)
+	}
+
+	want := ToolCall{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "get_weather", Arguments: `{"city":"Paris"}`}}
+	assembled := handler.ToolCalls()
+	if len(assembled) != 1 || assembled[0] != want {
+		t.Errorf("assembled tool calls = %+v, want %+v", assembled, want)
+	}
+	if len(handler.toolCalls) != 1 || handler.toolCalls[0] != want {
+		t.Errorf("completed tool calls = %+v, want %+v", handler.toolCalls, want)
+	}
+}
+
+func TestOpenAIReasoningModelSamplingParameters(t *testing.T) {
+	creativity := float32(0.8)
+	tests := []struct {
+		name     string
+		model    Model
+		wantSent bool
+	}{
+		{"chat model", ModelGPT4o, true},
+		{"o1", ModelO1, false},
+		{"o3-mini", ModelO3Mini, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body string
+			o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				body = string(b)
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+			})
+
+			req := testRequest(tt.model, "hi")
+			req.Creativity = &creativity
+			if _, err := o.CreateChatCompletion(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			for _, param := range []string{`"temperature"`, `"top_p"`} {
+				if sent := strings.Contains(body, param); sent != tt.wantSent {
+					t.Errorf("%s sent = %v, want %v", param, sent, tt.wantSent)
+				}
+			}
+		})
+	}
+}
+
+// completionCounter counts the completion events of a stream
+type completionCounter struct {
+	recordingHandler
+	completions int
+	toolCalls   []ToolCall
+}
+
+func (h *completionCounter) OnComplete(m OutputMessage) {
+	h.completions++
+	h.recordingHandler.OnComplete(m)
+}
+
+func (h *completionCounter) OnToolCall(tc ToolCall) { h.toolCalls = append(h.toolCalls, tc) }
+
+func TestOpenAIStreamFinalChunk(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []string
+		wantContent   string
+		wantToolCalls []string
+	}{
+		{
+			name: "finish reason in a separate chunk",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"content":" world"}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+				`{"id":"1","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			},
+			wantContent: "Hello world",
+		},
+		{
+			name: "finish reason with the last content",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":"stop"}]}`,
+			},
+			wantContent: "Hello world",
+		},
+		{
+			name: "no finish reason",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}`,
+			},
+			wantContent: "Hello",
+		},
+		{
+			name: "tool call without arguments flushed by the final chunk",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_time","arguments":""}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			},
+			wantToolCalls: []string{"get_time"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+				writeOpenAIStream(w, tt.chunks...)
+			})
+
+			handler := &completionCounter{}
+			if err := StreamChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"), handler, o); err != nil {
+				t.Fatal(err)
+			}
+			if handler.completions != 1 {
+				t.Fatalf("OnComplete called %d times, want 1", handler.completions)
+			}
+			if handler.complete.Content != tt.wantContent {
+				t.Errorf("content = %q, want %q", handler.complete.Content, tt.wantContent)
+			}
+			var names []string
+			for _, tc := range handler.toolCalls {
+				names = append(names, tc.Function.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantToolCalls, ",") {
+				t.Errorf("tool calls = %v, want %v", names, tt.wantToolCalls)
+			}
+			if len(handler.complete.ToolCalls) != len(tt.wantToolCalls) {
+				t.Errorf("completed message has %d tool calls, want %d", len(handler.complete.ToolCalls), len(tt.wantToolCalls))
+			}
+		})
+	}
+}
+
+// declaredModels returns every Model constant declared in llm.go
+func declaredModels(t *testing.T) []Model {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "llm.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var models []Model
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if ident, ok := vs.Type.(*ast.Ident); !ok || ident.Name != "Model" {
+				continue
+			}
+			for _, value := range vs.Values {
+				lit, ok := value.(*ast.BasicLit)
+				if !ok {
+					continue
+				}
+				name, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				models = append(models, Model(name))
+			}
+		}
+	}
+	if len(models) == 0 {
+		t.Fatal("no Model constants found in llm.go")
+	}
+	return models
+}
+
+func TestOpenAIIsSupportedCoversDeclaredModels(t *testing.T) {
+	o := &OpenAILLM{}
+	for _, model := range declaredModels(t) {
+		provider, ok := ProviderForModel(model)
+		if !ok {
+			t.Errorf("model %s is not registered with a provider", model)
+			continue
+		}
+		if supported := o.isSupported(model); supported != (provider == OpenAIProvider) {
+			t.Errorf("isSupported(%s) = %v for a %s model", model, supported, provider)
+		}
+	}
+}
+
+func TestConvertToOpenAIToolMessages(t *testing.T) {
+	type sent struct{ toolCallID, content string }
+
+	tests := []struct {
+		name    string
+		results []ToolResult
+		want    []sent
+	}{
+		{
+			name: "no results",
+			want: nil,
+		},
+		{
+			name:    "one result",
+			results: []ToolResult{{ToolCallID: "call_1", Result: "sunny"}},
+			want:    []sent{{"call_1", "sunny"}},
+		},
+		{
+			name: "parallel results",
+			results: []ToolResult{
+				{ToolCallID: "call_1", Result: "sunny"},
+				{ToolCallID: "call_2", ResultParts: []ContentPart{{Type: ContentTypeText, Text: "12:00"}}},
+			},
+			want: []sent{{"call_1", "sunny"}, {"call_2", "12:00"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := convertToOpenAIMessages([]InputMessage{
+				{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "weather and time?"}}},
+				{Role: RoleTool, ToolResults: tt.results},
+			})
+
+			var got []sent
+			for _, msg := range messages[1:] {
+				if msg.Role != openai.ChatMessageRoleTool {
+					t.Errorf("message role = %q, want %q", msg.Role, openai.ChatMessageRoleTool)
+				}
+				got = append(got, sent{msg.ToolCallID, msg.Content})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tool messages = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertToOpenAISystemPlacement(t *testing.T) {
+	system := "Be brief."
+	user := InputMessage{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "hi"}}}
+	assistant := InputMessage{Role: RoleAssistant, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "hello"}}}
+
+	// summary lists each message as role:text|text
+	summary := func(messages []openai.ChatCompletionMessage) []string {
+		var out []string
+		for _, msg := range messages {
+			texts := []string{}
+			if msg.Content != "" {
+				texts = append(texts, msg.Content)
+			}
+			for _, part := range msg.MultiContent {
+				texts = append(texts, part.Text)
+			}
+			out = append(out, msg.Role+":"+strings.Join(texts, "|"))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		placement SystemPlacement
+		system    *string
+		messages  []InputMessage
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:     "leading system message",
+			system:   &system,
+			messages: []InputMessage{user},
+			want:     []string{"system:Be brief.", "user:hi"},
+		},
+		{
+			name:      "first user message",
+			placement: SystemPlacementFirstUser,
+			system:    &system,
+			messages:  []InputMessage{assistant, user},
+			want:      []string{"assistant:hello", "user:Be brief.|hi"},
+		},
+		{
+			name:      "first user message without user messages",
+			placement: SystemPlacementFirstUser,
+			system:    &system,
+			messages:  []InputMessage{assistant},
+			want:      []string{"user:Be brief.", "assistant:hello"},
+		},
+		{
+			name:      "no system prompt",
+			placement: SystemPlacementFirstUser,
+			messages:  []InputMessage{user},
+			want:      []string{"user:hi"},
+		},
+		{
+			name:      "unknown placement",
+			placement: "last",
+			system:    &system,
+			messages:  []InputMessage{user},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := convertToOpenAIChatMessages(ChatCompletionRequest{
+				Model:           ModelGPT4o,
+				SystemPrompt:    tt.system,
+				SystemPlacement: tt.placement,
+				Messages:        tt.messages,
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summary(messages); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("messages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAIRefusal(t *testing.T) {
+	o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"chatcmpl-1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":null,"refusal":"I can't help with that."},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":6,"total_tokens":11}}`)
+	})
+
+	resp, err := o.CreateChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice := resp.Choices[0]
+	if choice.Message.Refusal != "I can't help with that." {
+		t.Errorf("refusal = %q", choice.Message.Refusal)
+	}
+	if choice.Message.Content != "" {
+		t.Errorf("content = %q, want none", choice.Message.Content)
+	}
+	if choice.FinishReason != FinishReasonRefusal {
+		t.Errorf("finish reason = %q, want %q", choice.FinishReason, FinishReasonRefusal)
+	}
+}
+
+// refusalRecorder records refusals and content filter stops of a stream
+type refusalRecorder struct {
+	filterHandler
+	refusal strings.Builder
+}
+
+func (h *refusalRecorder) OnRefusal(refusal string) { h.refusal.WriteString(refusal) }
+
+func TestOpenAIStreamRefusal(t *testing.T) {
+	tests := []struct {
+		name         string
+		chunks       []string
+		wantRefusal  string
+		wantFiltered bool
+	}{
+		{
+			name: "refusal",
+			chunks: []string{
+				`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"role":"assistant","refusal":"I can't "}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"refusal":"help with that."}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			},
+			wantRefusal: "I can't help with that.",
+		},
+		{
+			name: "content filter",
+			chunks: []string{
+				`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"role":"assistant","content":"Once"}}]}`,
+				`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"content_filter"}]}`,
+			},
+			wantFiltered: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+				writeOpenAIStream(w, tt.chunks...)
+			})
+			handler := &refusalRecorder{}
+			if err := StreamChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"), handler, o); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := handler.refusal.String(); got != tt.wantRefusal {
+				t.Errorf("refusal = %q, want %q", got, tt.wantRefusal)
+			}
+			if handler.filtered != tt.wantFiltered {
+				t.Errorf("content filtered = %v, want %v", handler.filtered, tt.wantFiltered)
+			}
+			if tt.wantRefusal != "" {
+				if got := handler.tokens.String(); got != "" {
+					t.Errorf("the refusal was streamed as content %q", got)
+				}
+				if handler.complete == nil || handler.complete.Refusal != tt.wantRefusal {
+					t.Errorf("completed with %+v, want the refusal", handler.complete)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAIRawResponse(t *testing.T) {
+	body := `{"id":"chatcmpl-1","object":"chat.completion","system_fingerprint":"fp_1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}
+
+	resp, err := newTestOpenAILLM(t, handler).CreateChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.RawResponse != nil {
+		t.Errorf("raw response = %s, want none by default", resp.RawResponse)
+	}
+
+	resp, err = newTestOpenAILLM(t, handler, WithRawResponses()).CreateChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.RawResponse) != body {
+		t.Errorf("raw response = %s, want the unmodified body", resp.RawResponse)
+	}
+	if resp.Choices[0].Message.Content != "hi" {
+		t.Errorf("content = %q, the response was not parsed from the captured body", resp.Choices[0].Message.Content)
+	}
+}
+
+func TestOpenAIStoreAndMetadata(t *testing.T) {
+	store := true
+	tests := []struct {
+		name      string
+		store     *bool
+		metadata  map[string]string
+		wantStore bool
+	}{
+		{"unset", nil, nil, false},
+		{"set", &store, map[string]string{"run": "eval-1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+				captureBody(t, r, &body)
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+			})
+
+			req := testRequest(ModelGPT4o, "hi")
+			req.Store = tt.store
+			req.Metadata = tt.metadata
+			if _, err := o.CreateChatCompletion(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, _ := body["store"].(bool); got != tt.wantStore {
+				t.Errorf("store = %v, want %v", body["store"], tt.wantStore)
+			}
+			metadata, _ := body["metadata"].(map[string]any)
+			if len(metadata) != len(tt.metadata) {
+				t.Fatalf("metadata = %v, want %v", body["metadata"], tt.metadata)
+			}
+			for k, v := range tt.metadata {
+				if metadata[k] != v {
+					t.Errorf("metadata[%q] = %v, want %q", k, metadata[k], v)
+				}
+			}
+		})
+	}
+}
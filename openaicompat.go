@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"github.com/sashabaranov/go-openai"
+)
+
+// ToOpenAIStreamChunk converts a generic stream chunk to an OpenAI chat
+// completion chunk, e.g. to re-serialize a stream as OpenAI server-sent events.
+// Tool calls are emitted complete, indexed by their position in the chunk.
+func ToOpenAIStreamChunk(resp ChatCompletionResponse) openai.ChatCompletionStreamResponse {
+	chunk := openai.ChatCompletionStreamResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion.chunk",
+		Choices: make([]openai.ChatCompletionStreamChoice, 0, len(resp.Choices)),
+	}
+
+	for _, c := range resp.Choices {
+		delta := openai.ChatCompletionStreamChoiceDelta{
+			Role:    string(c.Message.Role),
+			Content: c.Message.Content,
+			Refusal: c.Message.Refusal,
+		}
+		for i, tc := range c.Message.ToolCalls {
+			index := i
+			delta.ToolCalls = append(delta.ToolCalls, openai.ToolCall{
+				Index: &index,
+				ID:    tc.ID,
+				Type:  openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      tc.Function.Name,
+					Arguments: tc.Function.Arguments,
+				},
+			})
+		}
+		chunk.Choices = append(chunk.Choices, openai.ChatCompletionStreamChoice{
+			Index:        c.Index,
+			Delta:        delta,
+			FinishReason: convertToOpenAIFinishReason(c.FinishReason),
+		})
+	}
+
+	if resp.Usage != (Usage{}) {
+		chunk.Usage = &openai.Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		}
+		if resp.Usage.CachedPromptTokens > 0 {
+			chunk.Usage.PromptTokensDetails = &openai.PromptTokensDetails{CachedTokens: resp.Usage.CachedPromptTokens}
+		}
+	}
+	return chunk
+}
+
+func convertToOpenAIFinishReason(reason FinishReason) openai.FinishReason {
+	switch reason {
+	case FinishReasonToolCalls:
+		return openai.FinishReasonToolCalls
+	case FinishReasonStop, FinishReasonRefusal:
+		return openai.FinishReasonStop
+	case FinishReasonMaxTokens:
+		return openai.FinishReasonLength
+	case FinishReasonContentFilter:
+		return openai.FinishReasonContentFilter
+	default:
+		return openai.FinishReasonNull
+	}
+}
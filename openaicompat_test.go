@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestToOpenAIStreamChunk(t *testing.T) {
+	t.Run("text delta", func(t *testing.T) {
+		chunk := ToOpenAIStreamChunk(ChatCompletionResponse{ID: "chatcmpl-1", Choices: []Choice{{
+			Message:      OutputMessage{Role: RoleAssistant, Content: "Hel"},
+			FinishReason: FinishReasonNull,
+		}}})
+
+		if chunk.ID != "chatcmpl-1" || chunk.Object != "chat.completion.chunk" {
+			t.Errorf("chunk = %+v", chunk)
+		}
+		delta := chunk.Choices[0].Delta
+		if delta.Role != openai.ChatMessageRoleAssistant || delta.Content != "Hel" || len(delta.ToolCalls) != 0 {
+			t.Errorf("delta = %+v", delta)
+		}
+		if chunk.Usage != nil {
+			t.Errorf("usage = %+v, want none on a chunk without usage", chunk.Usage)
+		}
+
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `"finish_reason":null`) {
+			t.Errorf("chunk %s does not end with a null finish reason", data)
+		}
+	})
+
+	t.Run("tool call deltas", func(t *testing.T) {
+		chunk := ToOpenAIStreamChunk(ChatCompletionResponse{
+			ID: "chatcmpl-1",
+			Choices: []Choice{{
+				Message: OutputMessage{Role: RoleAssistant, ToolCalls: []ToolCall{
+					{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "weather", Arguments: `{"city":"Paris"}`}},
+					{ID: "call_2", Type: "function", Function: ToolCallFunction{Name: "time", Arguments: `{}`}},
+				}},
+				FinishReason: FinishReasonToolCalls,
+			}},
+			Usage: Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		})
+
+		// decode the serialized chunk the way an OpenAI client would
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got openai.ChatCompletionStreamResponse
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		choice := got.Choices[0]
+		if choice.FinishReason != openai.FinishReasonToolCalls {
+			t.Errorf("finish reason = %q, want %q", choice.FinishReason, openai.FinishReasonToolCalls)
+		}
+		if len(choice.Delta.ToolCalls) != 2 {
+			t.Fatalf("got %d tool calls, want 2", len(choice.Delta.ToolCalls))
+		}
+		for i, tc := range choice.Delta.ToolCalls {
+			if tc.Index == nil || *tc.Index != i {
+				t.Errorf("tool call %d has index %v", i, tc.Index)
+			}
+			if tc.Type != openai.ToolTypeFunction {
+				t.Errorf("tool call %d has type %q", i, tc.Type)
+			}
+		}
+		if tc := choice.Delta.ToolCalls[0]; tc.ID != "call_1" || tc.Function.Name != "weather" || tc.Function.Arguments != `{"city":"Paris"}` {
+			t.Errorf("tool call 0 = %+v", tc)
+		}
+		if got.Usage == nil || got.Usage.TotalTokens != 15 {
+			t.Errorf("usage = %+v, want the usage of the response", got.Usage)
+		}
+	})
+}
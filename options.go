@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"time"
+)
+
+// ClientOption configures a provider client when it is constructed.
+type ClientOption func(*clientConfig)
+
+// clientConfig holds the settings shared by all provider constructors.
+type clientConfig struct {
+	client           *http.Client
+	tlsConfig        *tls.Config
+	geminiOptions    *GeminiOptions
+	betaVersions     []BetaVersion
+	rawResponses     bool
+	coalesceMessages bool
+	retry            *RetryConfig
+	timeout          time.Duration
+	conversion       conversionConfig
+}
+
+// conversionConfig holds the settings for converting requests and responses
+// that every provider client keeps
+type conversionConfig struct {
+	// textPartSeparator is placed between the text blocks of a response
+	textPartSeparator string
+	// strict makes requests with content the converters would drop fail
+	strict bool
+	// onIgnoredField is called for set fields the provider ignores
+	onIgnoredField func(field string, provider LLMProvider)
+}
+
+func newClientConfig(opts []ClientOption) *clientConfig {
+	cfg := &clientConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithTLSConfig sets the TLS configuration used for connections to the
+// provider, e.g. for on-prem gateways. By default the system configuration is used.
+func WithTLSConfig(tlsConfig *tls.Config) ClientOption {
+	return func(c *clientConfig) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// WithRootCAs trusts the given certificate authorities when connecting to the
+// provider, e.g. for gateways using certificates signed by an internal CA.
+func WithRootCAs(pool *x509.CertPool) ClientOption {
+	return func(c *clientConfig) {
+		c.tlsConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+}
+
+// WithHTTPClient sends the provider's requests with client, e.g. to route them
+// through a proxy or a debugging transport. The client is copied, not
+// modified. WithTLSConfig and WithRootCAs are ignored because the client's
+// transport brings its own TLS configuration.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *clientConfig) {
+		c.client = client
+	}
+}
+
+// WithTextPartSeparator places sep between the text blocks of a response when
+// they are joined into OutputMessage.Content. By default there is no separator.
+func WithTextPartSeparator(sep string) ClientOption {
+	return func(c *clientConfig) {
+		c.conversion.textPartSeparator = sep
+	}
+}
+
+// httpClient returns the HTTP client to use for the provider or nil if the
+// provider's default client can be used
+func (c *clientConfig) httpClient() *http.Client {
+	if c.client == nil && c.tlsConfig == nil && !c.rawResponses && c.retry == nil {
+		return nil
+	}
+
+	client := &http.Client{}
+	if c.client != nil {
+		*client = *c.client
+	} else {
+		base := http.DefaultTransport.(*http.Transport).Clone()
+		if c.tlsConfig != nil {
+			base.TLSClientConfig = c.tlsConfig
+		}
+		client.Transport = base
+	}
+	if client.Transport == nil {
+		client.Transport = http.DefaultTransport
+	}
+
+	if c.retry != nil {
+		client.Transport = &retryTransport{cfg: *c.retry, base: client.Transport}
+	}
+	if c.rawResponses {
+		client.Transport = &rawResponseTransport{base: client.Transport}
+	}
+	return client
+}
@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestConversionOptions(t *testing.T) {
+	topK := 5
+	document := ChatCompletionRequest{
+		Model: ModelGPT4o,
+		Messages: []InputMessage{{Role: RoleUser, MultiContent: []ContentPart{
+			{Type: ContentTypeDocument, MediaType: "application/pdf", Data: "JVBERi0="},
+		}}},
+	}
+	withTopK := testRequest(ModelGPT4o, "hi")
+	withTopK.TopK = &topK
+
+	tests := []struct {
+		name        string
+		opts        func(ignored *[]string) []ClientOption
+		req         ChatCompletionRequest
+		wantContent string
+		wantErr     bool
+		wantIgnored []string
+	}{
+		{
+			name:        "defaults",
+			opts:        func(*[]string) []ClientOption { return nil },
+			req:         withTopK,
+			wantContent: "HelloWorld",
+		},
+		{
+			name:        "text part separator",
+			opts:        func(*[]string) []ClientOption { return []ClientOption{WithTextPartSeparator("\n")} },
+			req:         testRequest(ModelGPT4o, "hi"),
+			wantContent: "Hello\nWorld",
+		},
+		{
+			name:        "dropped content without strict conversion",
+			opts:        func(*[]string) []ClientOption { return nil },
+			req:         document,
+			wantContent: "HelloWorld",
+		},
+		{
+			name:    "strict conversion",
+			opts:    func(*[]string) []ClientOption { return []ClientOption{WithStrictConversion()} },
+			req:     document,
+			wantErr: true,
+		},
+		{
+			name: "ignored field handler",
+			opts: func(ignored *[]string) []ClientOption {
+				return []ClientOption{WithIgnoredFieldHandler(func(field string, provider LLMProvider) {
+					*ignored = append(*ignored, fmt.Sprintf("%s/%s", provider, field))
+				})}
+			},
+			req:         withTopK,
+			wantContent: "HelloWorld",
+			wantIgnored: []string{fmt.Sprintf("%s/TopK", OpenAIProvider)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ignored []string
+			var requests int
+			o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `{"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":[{"type":"text","text":"Hello"},{"type":"text","text":"World"}]}}]}`)
+			}, tt.opts(&ignored)...)
+
+			resp, err := o.CreateChatCompletion(context.Background(), tt.req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if requests != 0 {
+					t.Errorf("sent %d requests, want none", requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.Choices[0].Message.Content; got != tt.wantContent {
+				t.Errorf("content = %q, want %q", got, tt.wantContent)
+			}
+			if !reflect.DeepEqual(ignored, tt.wantIgnored) {
+				t.Errorf("ignored fields = %v, want %v", ignored, tt.wantIgnored)
+			}
+		})
+	}
+}
+
+// Settings of one client must not leak into another
+func TestConversionOptionsPerClient(t *testing.T) {
+	strict := NewOpenAILLM("test", WithStrictConversion(), WithTextPartSeparator(" "))
+	lenient := NewOpenAILLM("test")
+
+	if !strict.conversion.strict || strict.conversion.textPartSeparator != " " {
+		t.Errorf("strict client has conversion settings %+v", strict.conversion)
+	}
+	if lenient.conversion.strict || lenient.conversion.textPartSeparator != "" {
+		t.Errorf("lenient client has conversion settings %+v", lenient.conversion)
+	}
+}
@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Pricing is the price of a model in US dollars per million tokens.
+type Pricing struct {
+	Input  float64
+	Output float64
+	// CachedInput is the price of prompt tokens read from the prompt cache.
+	// If 0, cached tokens are billed at the Input price.
+	CachedInput float64
+}
+
+// UnknownPricingError is returned by EstimateCost for models without pricing.
+type UnknownPricingError struct {
+	Model Model
+}
+
+func (e *UnknownPricingError) Error() string {
+	return fmt.Sprintf("no pricing for model %s", e.Model)
+}
+
+var (
+	pricingMu sync.RWMutex
+	// pricing holds the list prices of the declared models
+	pricing = map[Model]Pricing{
+		ModelChatGPT4oLatest:     {Input: 5, Output: 15},
+		ModelGPT4o:               {Input: 2.5, Output: 10, CachedInput: 1.25},
+		ModelGPT4oMini:           {Input: 0.15, Output: 0.6, CachedInput: 0.075},
+		ModelGPT4o2024_08_06:     {Input: 2.5, Output: 10, CachedInput: 1.25},
+		ModelGPT4oMini2024_07_18: {Input: 0.15, Output: 0.6, CachedInput: 0.075},
+		ModelO1:                  {Input: 15, Output: 60, CachedInput: 7.5},
+		ModelO1_2024_12_17:       {Input: 15, Output: 60, CachedInput: 7.5},
+		ModelO1Preview2024_09_12: {Input: 15, Output: 60, CachedInput: 7.5},
+		ModelO1Preview:           {Input: 15, Output: 60, CachedInput: 7.5},
+		ModelO1Mini:              {Input: 1.1, Output: 4.4, CachedInput: 0.55},
+		ModelO1Mini2024_09_12:    {Input: 1.1, Output: 4.4, CachedInput: 0.55},
+		ModelO3Mini:              {Input: 1.1, Output: 4.4, CachedInput: 0.55},
+		ModelO3Mini2025_01_31:    {Input: 1.1, Output: 4.4, CachedInput: 0.55},
+
+		ModelClaude2Dot0:               {Input: 8, Output: 24},
+		ModelClaude2Dot1:               {Input: 8, Output: 24},
+		ModelClaude3Opus20240229:       {Input: 15, Output: 75, CachedInput: 1.5},
+		ModelClaude3Sonnet20240229:     {Input: 3, Output: 15},
+		ModelClaude3Dot5Sonnet20240620: {Input: 3, Output: 15, CachedInput: 0.3},
+		ModelClaude3Dot5Sonnet20241022: {Input: 3, Output: 15, CachedInput: 0.3},
+		ModelClaude3Dot5SonnetLatest:   {Input: 3, Output: 15, CachedInput: 0.3},
+		ModelClaude3Haiku20240307:      {Input: 0.25, Output: 1.25, CachedInput: 0.03},
+		ModelClaude3Dot5HaikuLatest:    {Input: 0.8, Output: 4, CachedInput: 0.08},
+		ModelClaude3Dot5Haiku20241022:  {Input: 0.8, Output: 4, CachedInput: 0.08},
+
+		ModelGemini2Flash:        {Input: 0.1, Output: 0.4, CachedInput: 0.025},
+		ModelGemini2FlashLite001: {Input: 0.075, Output: 0.3},
+		ModelGemini15Flash:       {Input: 0.075, Output: 0.3, CachedInput: 0.01875},
+		ModelGemini15Flash8B:     {Input: 0.0375, Output: 0.15, CachedInput: 0.01},
+		ModelGemini15Pro:         {Input: 1.25, Output: 5, CachedInput: 0.3125},
+	}
+)
+
+// RegisterPricing sets the pricing of model, replacing the built-in list
+// price, e.g. for negotiated prices or models not declared by this package.
+func RegisterPricing(model Model, p Pricing) {
+	pricingMu.Lock()
+	defer pricingMu.Unlock()
+	pricing[model] = p
+}
+
+// PricingForModel returns the pricing of the given model.
+func PricingForModel(model Model) (Pricing, bool) {
+	pricingMu.RLock()
+	defer pricingMu.RUnlock()
+	p, ok := pricing[model]
+	return p, ok
+}
+
+// EstimateCost returns the cost in US dollars of a completion of model with
+// the given usage. Prices of the built-in models are list prices and do not
+// account for tiered or batch pricing.
+func EstimateCost(model Model, usage Usage) (float64, error) {
+	p, ok := PricingForModel(model)
+	if !ok {
+		return 0, &UnknownPricingError{Model: model}
+	}
+
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	uncached := usage.PromptTokens - usage.CachedPromptTokens
+	cost := float64(uncached)*p.Input + float64(usage.CachedPromptTokens)*cachedPrice + float64(usage.CompletionTokens)*p.Output
+	return cost / 1e6, nil
+}
@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// WithRawResponses makes a client fill ChatCompletionResponse.RawResponse of
+// blocking completions with the provider's unmodified response body, e.g. to
+// debug conversions. Responses are buffered in memory, so it is off by default.
+func WithRawResponses() ClientOption {
+	return func(c *clientConfig) {
+		c.rawResponses = true
+	}
+}
+
+type rawResponseKey struct{}
+
+// rawResponseSlot receives the body of the response to a request made with its context
+type rawResponseSlot struct {
+	body []byte
+}
+
+// withRawResponseCapture returns a context whose HTTP responses are captured
+// in the returned slot by a rawResponseTransport
+func withRawResponseCapture(ctx context.Context) (context.Context, *rawResponseSlot) {
+	slot := &rawResponseSlot{}
+	return context.WithValue(ctx, rawResponseKey{}, slot), slot
+}
+
+// json returns the captured body, or nil if nothing valid was captured
+func (s *rawResponseSlot) json() json.RawMessage {
+	if !json.Valid(s.body) {
+		return nil
+	}
+	return json.RawMessage(s.body)
+}
+
+// rawResponseTransport stores response bodies in the rawResponseSlot of the request's context
+type rawResponseTransport struct {
+	base http.RoundTripper
+}
+
+func (t *rawResponseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	slot, ok := req.Context().Value(rawResponseKey{}).(*rawResponseSlot)
+	if err != nil || !ok {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	slot.body = body
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
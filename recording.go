@@ -0,0 +1,209 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// RecordMode selects whether WithRecording records or replays interactions.
+type RecordMode string
+
+const (
+	// RecordModeRecord calls the wrapped LLM and saves every interaction.
+	RecordModeRecord RecordMode = "record"
+	// RecordModeReplay serves interactions from the recording without calling the LLM.
+	RecordModeReplay RecordMode = "replay"
+)
+
+// recordedInteraction is a single recorded response or stream of a request
+type recordedInteraction struct {
+	Response     *ChatCompletionResponse  `json:"response,omitempty"`
+	StreamChunks []ChatCompletionResponse `json:"stream_chunks,omitempty"`
+}
+
+// recordingLLM records interactions with an LLM to disk and replays them
+type recordingLLM struct {
+	llm  LLM
+	path string
+	mode RecordMode
+
+	mu           sync.Mutex
+	interactions map[string]recordedInteraction
+}
+
+// WithRecording wraps llm so that request/response pairs are recorded to the
+// JSON file at path (RecordModeRecord) or replayed from it (RecordModeReplay).
+// Interactions are keyed by the request's Fingerprint, so replaying requires
+// the exact same requests. In replay mode an unknown request is an error.
+func WithRecording(llm LLM, path string, mode RecordMode) (LLM, error) {
+	r := &recordingLLM{
+		llm:          llm,
+		path:         path,
+		mode:         mode,
+		interactions: make(map[string]recordedInteraction),
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &r.interactions); err != nil {
+			return nil, fmt.Errorf("failed to parse recording %s: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && mode == RecordModeRecord:
+		// a new recording is created on the first interaction
+	default:
+		return nil, fmt.Errorf("failed to read recording %s: %w", path, err)
+	}
+
+	return r, nil
+}
+
+// CreateChatCompletion records or replays a blocking completion
+func (r *recordingLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	key, err := req.Fingerprint()
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
+
+	if r.mode == RecordModeReplay {
+		interaction, ok := r.lookup(key)
+		if !ok || interaction.Response == nil {
+			return ChatCompletionResponse{}, fmt.Errorf("no recorded response for request %s", key)
+		}
+		return *interaction.Response, nil
+	}
+
+	resp, err := r.llm.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	return resp, r.save(key, func(interaction *recordedInteraction) {
+		interaction.Response = &resp
+	})
+}
+
+// CreateChatCompletionStream records or replays a streaming completion
+func (r *recordingLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	key, err := req.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode == RecordModeReplay {
+		interaction, ok := r.lookup(key)
+		if !ok || interaction.StreamChunks == nil {
+			return nil, fmt.Errorf("no recorded stream for request %s", key)
+		}
+		return &replayStream{chunks: interaction.StreamChunks}, nil
+	}
+
+	stream, err := r.llm.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingStream{stream: stream, recorder: r, key: key}, nil
+}
+
+func (r *recordingLLM) lookup(key string) (recordedInteraction, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	interaction, ok := r.interactions[key]
+	return interaction, ok
+}
+
+// save updates the interaction stored under key and writes the recording to disk
+func (r *recordingLLM) save(key string, update func(*recordedInteraction)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	interaction := r.interactions[key]
+	update(&interaction)
+	r.interactions[key] = interaction
+
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode recording: %w", err)
+	}
+	if err := os.WriteFile(r.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write recording %s: %w", r.path, err)
+	}
+	return nil
+}
+
+// recordingStream collects the chunks of a stream and saves them once it is
+// complete, i.e. on io.EOF or when it is closed after a final chunk
+type recordingStream struct {
+	stream   ChatCompletionStream
+	recorder *recordingLLM
+	key      string
+	chunks   []ChatCompletionResponse
+	finished bool
+	saved    bool
+}
+
+func (s *recordingStream) Recv() (ChatCompletionResponse, error) {
+	resp, err := s.stream.Recv()
+	if errors.Is(err, io.EOF) {
+		s.finished = true
+		if saveErr := s.save(); saveErr != nil {
+			return ChatCompletionResponse{}, saveErr
+		}
+		return resp, err
+	}
+	if err != nil {
+		return resp, err
+	}
+
+	s.chunks = append(s.chunks, resp)
+	for _, c := range resp.Choices {
+		if c.FinishReason != FinishReasonNull && c.FinishReason != "" {
+			s.finished = true
+		}
+	}
+	return resp, nil
+}
+
+func (s *recordingStream) Close() error {
+	err := s.stream.Close()
+	if saveErr := s.save(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+// save records the stream once, and only if it completed
+func (s *recordingStream) save() error {
+	if s.saved || !s.finished {
+		return nil
+	}
+	s.saved = true
+
+	chunks := append([]ChatCompletionResponse{}, s.chunks...)
+	return s.recorder.save(s.key, func(interaction *recordedInteraction) {
+		interaction.StreamChunks = chunks
+	})
+}
+
+// replayStream returns recorded chunks in order
+type replayStream struct {
+	chunks []ChatCompletionResponse
+	next   int
+}
+
+func (s *replayStream) Recv() (ChatCompletionResponse, error) {
+	if s.next >= len(s.chunks) {
+		return ChatCompletionResponse{}, io.EOF
+	}
+	chunk := s.chunks[s.next]
+	s.next++
+	return chunk, nil
+}
+
+func (s *replayStream) Close() error {
+	return nil
+}
@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// cannedLLM answers every request with the same response or stream
+type cannedLLM struct {
+	resp      ChatCompletionResponse
+	chunks    []ChatCompletionResponse
+	streamErr error
+	calls     int
+}
+
+func (l *cannedLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	l.calls++
+	return l.resp, nil
+}
+
+func (l *cannedLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	l.calls++
+	return &scriptedStream{chunks: append([]ChatCompletionResponse(nil), l.chunks...), err: l.streamErr}, nil
+}
+
+// collectStream reads all chunks of a stream until io.EOF and closes it
+func collectStream(t *testing.T, stream ChatCompletionStream) ([]ChatCompletionResponse, error) {
+	t.Helper()
+	defer stream.Close()
+	var chunks []ChatCompletionResponse
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return chunks, nil
+		}
+		if err != nil {
+			return chunks, err
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+func TestRecordingReplay(t *testing.T) {
+	resp := ChatCompletionResponse{
+		ID:      "resp-1",
+		Choices: []Choice{{Message: OutputMessage{Role: RoleAssistant, Content: "Hello"}, FinishReason: FinishReasonStop}},
+		Usage:   Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4},
+	}
+	chunks := []ChatCompletionResponse{textChunk("Hel", ""), textChunk("lo", FinishReasonStop)}
+
+	tests := []struct {
+		name      string
+		stream    bool
+		streamErr error
+		// wantReplayErr is set if the interaction must not have been recorded
+		wantReplayErr bool
+	}{
+		{name: "blocking"},
+		{name: "stream", stream: true},
+		{name: "failed stream", stream: true, streamErr: errors.New("connection reset"), wantReplayErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "recording.json")
+			req := testRequest(ModelGPT4o, "hi")
+
+			live := &cannedLLM{resp: resp, chunks: chunks, streamErr: tt.streamErr}
+			if tt.streamErr != nil {
+				// the stream fails before its final chunk
+				live.chunks = chunks[:1]
+			}
+			recorder, err := WithRecording(live, path, RecordModeRecord)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var recorded any
+			if tt.stream {
+				stream, err := recorder.CreateChatCompletionStream(context.Background(), req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				recorded, err = collectStream(t, stream)
+				if !errors.Is(err, tt.streamErr) {
+					t.Fatalf("stream error = %v, want %v", err, tt.streamErr)
+				}
+			} else {
+				recorded, err = recorder.CreateChatCompletion(context.Background(), req)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			offline := &cannedLLM{}
+			replayer, err := WithRecording(offline, path, RecordModeReplay)
+			if tt.wantReplayErr {
+				// nothing was recorded, so there is no file to replay
+				if err == nil {
+					t.Fatal("expected an error for a missing recording")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var replayed any
+			if tt.stream {
+				stream, err := replayer.CreateChatCompletionStream(context.Background(), req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if replayed, err = collectStream(t, stream); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				if replayed, err = replayer.CreateChatCompletion(context.Background(), req); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if !reflect.DeepEqual(replayed, recorded) {
+				t.Errorf("replayed %+v, recorded %+v", replayed, recorded)
+			}
+			if offline.calls != 0 {
+				t.Errorf("replay called the LLM %d times", offline.calls)
+			}
+			if _, err := replayer.CreateChatCompletion(context.Background(), testRequest(ModelGPT4o, "other")); err == nil {
+				t.Error("expected an error for a request that was not recorded")
+			}
+		})
+	}
+}
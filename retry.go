@@ -0,0 +1,315 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/liushuangls/go-anthropic/v2"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/googleapi"
+)
+
+// isRetryableError reports whether err is a transient failure, such as a
+// dropped connection, a rate limit or a server error, after which the request
+// can be repeated
+func isRetryableError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var openAIErr *openai.APIError
+	if errors.As(err, &openAIErr) {
+		return isRetryableStatus(openAIErr.HTTPStatusCode)
+	}
+	var openAIReqErr *openai.RequestError
+	if errors.As(err, &openAIReqErr) {
+		return isRetryableStatus(openAIReqErr.HTTPStatusCode)
+	}
+	var claudeErr *anthropic.APIError
+	if errors.As(err, &claudeErr) {
+		return claudeErr.IsRateLimitErr() || claudeErr.IsApiErr() || claudeErr.IsOverloadedErr()
+	}
+	var claudeReqErr *anthropic.RequestError
+	if errors.As(err, &claudeReqErr) {
+		return isRetryableStatus(claudeReqErr.StatusCode)
+	}
+	var geminiErr *googleapi.Error
+	if errors.As(err, &geminiErr) {
+		return isRetryableStatus(geminiErr.Code)
+	}
+	return false
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// StreamRetryConfig configures how WithStreamRetry retries streams.
+type StreamRetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// Backoff is the delay before the first retry, doubled for every further retry.
+	Backoff time.Duration
+	// ShouldRetry decides which errors are retried. By default network errors,
+	// rate limits and server errors are, see isRetryableError.
+	ShouldRetry func(err error) bool
+	// OnRetry is called before every retry with its number, starting at 1, and
+	// the error of the failed attempt. It may modify the request for the next
+	// attempt, e.g. trim the history after a context length error.
+	OnRetry func(attempt int, err error, req *ChatCompletionRequest)
+}
+
+// shouldRetry reports whether err is retried
+func (c StreamRetryConfig) shouldRetry(ctx context.Context, err error) bool {
+	if c.ShouldRetry == nil {
+		return isRetryableError(ctx, err)
+	}
+	return ctx.Err() == nil && c.ShouldRetry(err)
+}
+
+// streamRetryLLM wraps an LLM and retries streams that fail before delivering any chunk.
+type streamRetryLLM struct {
+	llm LLM
+	cfg StreamRetryConfig
+}
+
+// WithStreamRetry wraps llm so that a stream failing with a retryable error,
+// either when it is created or before its first chunk arrives, is restarted
+// according to cfg. Once a chunk was delivered errors are returned as is; use
+// WithStreamResume to continue such streams. Blocking calls are passed through.
+func WithStreamRetry(llm LLM, cfg StreamRetryConfig) LLM {
+	return &streamRetryLLM{llm: llm, cfg: cfg}
+}
+
+func (r *streamRetryLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	return r.llm.CreateChatCompletion(ctx, req)
+}
+
+func (r *streamRetryLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	s := &retryStream{retrier: r, ctx: ctx, req: req}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// retryStream restarts its stream on retryable errors until a chunk is received
+type retryStream struct {
+	retrier  *streamRetryLLM
+	ctx      context.Context
+	req      ChatCompletionRequest
+	stream   ChatCompletionStream
+	attempts int
+	received bool
+}
+
+// open creates the stream, retrying retryable errors
+func (s *retryStream) open() error {
+	for {
+		stream, err := s.retrier.llm.CreateChatCompletionStream(s.ctx, s.req)
+		if err == nil {
+			s.stream = stream
+			return nil
+		}
+		if waitErr := s.wait(err); waitErr != nil {
+			return waitErr
+		}
+	}
+}
+
+// wait sleeps before the next attempt, or returns err if no attempt is left
+func (s *retryStream) wait(err error) error {
+	cfg := s.retrier.cfg
+	if s.attempts >= cfg.MaxRetries || !cfg.shouldRetry(s.ctx, err) {
+		return err
+	}
+	delay := cfg.Backoff << s.attempts
+	s.attempts++
+	if cfg.OnRetry != nil {
+		// the hook gets its own copy so the caller's request is never modified
+		if s.attempts == 1 {
+			s.req = s.req.Clone()
+		}
+		cfg.OnRetry(s.attempts, err, &s.req)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-s.ctx.Done():
+		return err
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (s *retryStream) Recv() (ChatCompletionResponse, error) {
+	for {
+		resp, err := s.stream.Recv()
+		if err == nil || s.received || errors.Is(err, io.EOF) {
+			s.received = true
+			return resp, err
+		}
+		if waitErr := s.wait(err); waitErr != nil {
+			return resp, waitErr
+		}
+		_ = s.stream.Close()
+		if err := s.open(); err != nil {
+			return ChatCompletionResponse{}, err
+		}
+	}
+}
+
+func (s *retryStream) Close() error {
+	return s.stream.Close()
+}
+
+// RetryConfig configures how WithRetry retries the HTTP requests of a client.
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled for every further
+	// retry. Defaults to 500ms.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts, including delays requested by
+	// a Retry-After header. Defaults to 30s.
+	MaxDelay time.Duration
+	// Jitter randomizes delays by up to this fraction, between 0 and 1, so
+	// that clients failing together do not retry together.
+	Jitter float64
+	// RetryableStatus decides which HTTP status codes are retried. By default
+	// rate limits and server errors are.
+	RetryableStatus func(code int) bool
+}
+
+// WithRetry makes a client retry requests failing with a connection error or
+// a retryable status, waiting as long as the provider's Retry-After header
+// asks for if it sends one. Streams are only retried before their response
+// arrives. Waiting stops as soon as the request's context is done.
+func WithRetry(cfg RetryConfig) ClientOption {
+	return func(c *clientConfig) {
+		c.retry = &cfg
+	}
+}
+
+// delay returns how long to wait before the given retry, starting at 1
+func (c RetryConfig) delay(retry int, resp *http.Response) time.Duration {
+	maxDelay := c.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+	if d, ok := retryAfter(resp); ok {
+		return min(d, maxDelay)
+	}
+
+	base := c.BaseDelay
+	if base <= 0 {
+		base = 500 * time.Millisecond
+	}
+	d := maxDelay
+	if shift := retry - 1; shift < 32 && base<<shift > 0 {
+		d = min(base<<shift, maxDelay)
+	}
+	if c.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * min(c.Jitter, 1) * float64(d))
+	}
+	return d
+}
+
+// retryAfter returns the delay requested by the Retry-After header of resp.
+// OpenAI also sends it in milliseconds as retry-after-ms.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	if ms, err := strconv.ParseFloat(resp.Header.Get("retry-after-ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// retryTransport repeats requests according to a RetryConfig
+type retryTransport struct {
+	cfg  RetryConfig
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.GetBody == nil {
+		// the body is buffered so that it can be sent again
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	retryableStatus := t.cfg.RetryableStatus
+	if retryableStatus == nil {
+		retryableStatus = isRetryableStatus
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.cfg.MaxAttempts {
+			return resp, err
+		}
+		if err != nil && !isRetryableError(ctx, err) {
+			return resp, err
+		}
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		delay := t.cfg.delay(attempt, resp)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
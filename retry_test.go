@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStreamRetryOnRetryModifiesRequest(t *testing.T) {
+	var prompts []string
+	o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request: %v", err)
+		}
+		switch {
+		case strings.Contains(string(body), `"second"`):
+			prompts = append(prompts, "second")
+		case strings.Contains(string(body), `"first"`):
+			prompts = append(prompts, "first")
+		default:
+			prompts = append(prompts, string(body))
+		}
+		if len(prompts) == 1 {
+			writeOpenAIRateLimit(w)
+			return
+		}
+		writeOpenAIStream(w, `{"id":"1","choices":[{"index":0,"delta":{"content":"ok"},"finish_reason":"stop"}]}`)
+	})
+
+	var hookCalls []int
+	req := testRequest(ModelGPT4o, "first")
+	cfg := StreamRetryConfig{
+		MaxRetries: 1,
+		OnRetry: func(attempt int, err error, req *ChatCompletionRequest) {
+			hookCalls = append(hookCalls, attempt)
+			req.Messages[0].MultiContent[0].Text = "second"
+		},
+	}
+	stream, err := WithStreamRetry(o, cfg).CreateChatCompletionStream(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"hook attempts", len(hookCalls) == 1 && hookCalls[0] == 1, true},
+		{"provider attempts", len(prompts), 2},
+		{"first prompt", prompts[0], "first"},
+		{"second prompt", prompts[1], "second"},
+		{"caller request", req.Messages[0].MultiContent[0].Text, "first"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
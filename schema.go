@@ -0,0 +1,42 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Property is a named JSON Schema property.
+type Property struct {
+	Name   string
+	Schema map[string]interface{}
+}
+
+// OrderedProperties is a JSON Schema "properties" object that keeps its
+// properties in the given order when serialized, where a map would sort them
+// by name. Use it as the "properties" value of Function.Parameters or a
+// nested object schema when the order matters to the model.
+type OrderedProperties []Property
+
+// MarshalJSON encodes the properties as a JSON object in order.
+func (p OrderedProperties) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, prop := range p {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(prop.Name)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := json.Marshal(prop.Schema)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(schema)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
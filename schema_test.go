@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOrderedPropertiesSerialization(t *testing.T) {
+	params := func() map[string]interface{} {
+		return map[string]interface{}{
+			"type": "object",
+			"properties": OrderedProperties{
+				{Name: "zip", Schema: map[string]interface{}{"type": "string"}},
+				{Name: "city", Schema: map[string]interface{}{"type": "string", "description": "the city"}},
+				{Name: "address", Schema: map[string]interface{}{
+					"type": "object",
+					"properties": OrderedProperties{
+						{Name: "street", Schema: map[string]interface{}{"type": "string"}},
+						{Name: "number", Schema: map[string]interface{}{"type": "integer"}},
+					},
+				}},
+			},
+			"required": []string{"zip", "city"},
+		}
+	}
+	want := `{"properties":{"zip":{"type":"string"},"city":{"description":"the city","type":"string"},` +
+		`"address":{"properties":{"street":{"type":"string"},"number":{"type":"integer"}},"type":"object"}},` +
+		`"required":["zip","city"],"type":"object"}`
+
+	// maps are iterated in random order, a stable encoding must not depend on it
+	for i := 0; i < 50; i++ {
+		got, err := json.Marshal(params())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("run %d encoded\n%s\nwant\n%s", i, got, want)
+		}
+	}
+
+	var sent []byte
+	o := newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+		sent, _ = io.ReadAll(r.Body)
+		writeOpenAIStream(w, `{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"ok"},"finish_reason":"stop"}]}`)
+	})
+	req := testRequest(ModelGPT4o, "hi")
+	req.Tools = []Tool{{Type: "function", Function: &Function{Name: "lookup", Parameters: params()}}}
+	stream, err := o.CreateChatCompletionStream(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, sent); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(compact.String(), `"parameters":`+want) {
+		t.Errorf("request %s does not contain the parameters in order", compact.String())
+	}
+}
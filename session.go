@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"context"
+	"sync"
+)
+
+// Session is an LLM that adds a set of tools to every request, so that an
+// agent loop defines its tools once instead of on every turn. Tools can be
+// added and removed between turns. A Session is safe for concurrent use.
+type Session struct {
+	llm LLM
+
+	mu    sync.Mutex
+	tools []Tool
+}
+
+// NewSession returns a Session sending requests to llm with the given tools.
+func NewSession(llm LLM, tools ...Tool) *Session {
+	s := &Session{llm: llm}
+	s.AddTools(tools...)
+	return s
+}
+
+// AddTools adds tools to the session, replacing tools with the same function name.
+func (s *Session) AddTools(tools ...Tool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tool := range tools {
+		s.tools = removeTool(s.tools, toolName(tool))
+		s.tools = append(s.tools, tool)
+	}
+}
+
+// RemoveTool removes the tool with the given function name from the session.
+func (s *Session) RemoveTool(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tools = removeTool(s.tools, name)
+}
+
+// Tools returns the tools currently included in every request.
+func (s *Session) Tools() []Tool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Tool(nil), s.tools...)
+}
+
+// CreateChatCompletion sends the request with the session's tools
+func (s *Session) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	req.Tools = s.requestTools(req.Tools)
+	return s.llm.CreateChatCompletion(ctx, req)
+}
+
+// CreateChatCompletionStream streams the request with the session's tools
+func (s *Session) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	req.Tools = s.requestTools(req.Tools)
+	return s.llm.CreateChatCompletionStream(ctx, req)
+}
+
+// requestTools merges the session's tools with the tools of a request, which
+// take precedence over session tools with the same name
+func (s *Session) requestTools(reqTools []Tool) []Tool {
+	tools := s.Tools()
+	for _, tool := range reqTools {
+		tools = removeTool(tools, toolName(tool))
+	}
+	return append(tools, reqTools...)
+}
+
+func toolName(tool Tool) string {
+	if tool.Function == nil {
+		return ""
+	}
+	return tool.Function.Name
+}
+
+// removeTool removes the tools with the given name in place
+func removeTool(tools []Tool, name string) []Tool {
+	kept := tools[:0]
+	for _, tool := range tools {
+		if toolName(tool) != name {
+			kept = append(kept, tool)
+		}
+	}
+	return kept
+}
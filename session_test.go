@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func sessionTool(name, description string) Tool {
+	return Tool{Type: "function", Function: &Function{Name: name, Description: description}}
+}
+
+// toolNames records the tool names of the requests sent to it
+type toolNames struct {
+	stubLLM
+	turns [][]string
+}
+
+func newToolNames() *toolNames {
+	n := &toolNames{}
+	n.complete = func(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+		var names []string
+		for _, tool := range req.Tools {
+			names = append(names, tool.Function.Name+":"+tool.Function.Description)
+		}
+		n.turns = append(n.turns, names)
+		return ChatCompletionResponse{}, nil
+	}
+	return n
+}
+
+func TestSession(t *testing.T) {
+	inner := newToolNames()
+	s := NewSession(inner, sessionTool("search", "web"), sessionTool("calc", ""))
+	turn := func(tools ...Tool) {
+		t.Helper()
+		req := testRequest(ModelGPT4o, "hi")
+		req.Tools = tools
+		if _, err := s.CreateChatCompletion(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	turn()
+	turn()
+	s.AddTools(sessionTool("clock", ""), sessionTool("search", "news"))
+	turn()
+	s.RemoveTool("calc")
+	turn()
+	turn(sessionTool("clock", "utc"))
+
+	want := [][]string{
+		{"search:web", "calc:"},
+		{"search:web", "calc:"},
+		{"calc:", "clock:", "search:news"},
+		{"clock:", "search:news"},
+		// tools of a request take precedence over session tools
+		{"search:news", "clock:utc"},
+	}
+	if !reflect.DeepEqual(inner.turns, want) {
+		t.Errorf("got tools %v, want %v", inner.turns, want)
+	}
+	if got := len(s.Tools()); got != 2 {
+		t.Errorf("session has %d tools after the turns, want 2", got)
+	}
+}
+
+func TestSessionStream(t *testing.T) {
+	inner := &scriptedLLM{streams: []*scriptedStream{{}}}
+	s := NewSession(inner, sessionTool("search", ""))
+
+	stream, err := s.CreateChatCompletionStream(context.Background(), testRequest(ModelGPT4o, "hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	if tools := inner.requests[0].Tools; len(tools) != 1 || tools[0].Function.Name != "search" {
+		t.Errorf("stream was sent tools %v", tools)
+	}
+}
@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// CallStats describes a single call made through WithStats.
+type CallStats struct {
+	Model    Model
+	Provider LLMProvider
+	// Stream is true for streaming calls.
+	Stream bool
+	// Latency is the time until the response was received, or until the
+	// stream ended or was closed.
+	Latency time.Duration
+	// Usage is the token usage reported by the provider, if any.
+	Usage Usage
+	// Err is the error the call failed with, if any.
+	Err error
+}
+
+// StatsSink receives the stats of every call made through WithStats.
+// Record may be called concurrently.
+type StatsSink interface {
+	Record(stats CallStats)
+}
+
+// statsLLM wraps an LLM and reports call stats to a sink.
+type statsLLM struct {
+	llm  LLM
+	sink StatsSink
+}
+
+// WithStats wraps llm so that the latency, token usage, model, provider and
+// error of every call are reported to sink. Stats of a stream are reported
+// once, when it ends or is closed.
+func WithStats(llm LLM, sink StatsSink) LLM {
+	return &statsLLM{llm: llm, sink: sink}
+}
+
+func (s *statsLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	start := time.Now()
+	resp, err := s.llm.CreateChatCompletion(ctx, req)
+	stats := s.newCallStats(req)
+	stats.Latency = time.Since(start)
+	stats.Usage = resp.Usage
+	stats.Err = err
+	s.sink.Record(stats)
+	return resp, err
+}
+
+func (s *statsLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	start := time.Now()
+	stream, err := s.llm.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		stats := s.newCallStats(req)
+		stats.Stream = true
+		stats.Latency = time.Since(start)
+		stats.Err = err
+		s.sink.Record(stats)
+		return nil, err
+	}
+	stats := s.newCallStats(req)
+	stats.Stream = true
+	return &statsStream{stream: stream, sink: s.sink, start: start, stats: stats}, nil
+}
+
+func (s *statsLLM) newCallStats(req ChatCompletionRequest) CallStats {
+	provider, _ := ProviderForModel(req.Model)
+	if namer, ok := s.llm.(ProviderNamer); ok {
+		provider = namer.ProviderName()
+	}
+	return CallStats{Model: req.Model, Provider: provider}
+}
+
+// statsStream records the usage of a stream and reports it once it ends
+type statsStream struct {
+	stream   ChatCompletionStream
+	sink     StatsSink
+	start    time.Time
+	stats    CallStats
+	reported bool
+}
+
+func (s *statsStream) Recv() (ChatCompletionResponse, error) {
+	resp, err := s.stream.Recv()
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			s.stats.Err = err
+		}
+		s.report()
+		return resp, err
+	}
+	if resp.Usage != (Usage{}) {
+		s.stats.Usage = resp.Usage
+	}
+	return resp, nil
+}
+
+func (s *statsStream) Close() error {
+	err := s.stream.Close()
+	s.report()
+	return err
+}
+
+func (s *statsStream) report() {
+	if s.reported {
+		return
+	}
+	s.reported = true
+	s.stats.Latency = time.Since(s.start)
+	s.sink.Record(s.stats)
+}
@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// statsRecorder collects the stats passed to it
+type statsRecorder struct {
+	mu    sync.Mutex
+	stats []CallStats
+}
+
+func (r *statsRecorder) Record(stats CallStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats = append(r.stats, stats)
+}
+
+func TestWithStats(t *testing.T) {
+	usage := Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	failure := errors.New("overloaded")
+
+	tests := []struct {
+		name     string
+		complete func(context.Context, ChatCompletionRequest) (ChatCompletionResponse, error)
+		wantErr  error
+	}{
+		{
+			name: "success",
+			complete: func(context.Context, ChatCompletionRequest) (ChatCompletionResponse, error) {
+				return ChatCompletionResponse{Usage: usage}, nil
+			},
+		},
+		{
+			name: "failure",
+			complete: func(context.Context, ChatCompletionRequest) (ChatCompletionResponse, error) {
+				return ChatCompletionResponse{}, failure
+			},
+			wantErr: failure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &statsRecorder{}
+			l := WithStats(&stubLLM{complete: tt.complete}, sink)
+
+			_, err := l.CreateChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if len(sink.stats) != 1 {
+				t.Fatalf("got %d stats, want 1", len(sink.stats))
+			}
+			stats := sink.stats[0]
+			if stats.Model != ModelGPT4o || stats.Provider != OpenAIProvider || stats.Stream {
+				t.Errorf("got model %q, provider %q, stream %v", stats.Model, stats.Provider, stats.Stream)
+			}
+			if tt.wantErr == nil && stats.Usage != usage {
+				t.Errorf("got usage %+v, want %+v", stats.Usage, usage)
+			}
+			if !errors.Is(stats.Err, tt.wantErr) {
+				t.Errorf("got recorded error %v, want %v", stats.Err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithStatsStream(t *testing.T) {
+	usage := Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	last := textChunk("", FinishReasonStop)
+	last.Usage = usage
+	sink := &statsRecorder{}
+	l := WithStats(&scriptedLLM{streams: []*scriptedStream{
+		{chunks: []ChatCompletionResponse{textChunk("Hello", ""), last}},
+	}}, sink)
+
+	stream, err := l.CreateChatCompletionStream(context.Background(), testRequest(ModelClaude3Dot5HaikuLatest, "hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.stats) != 1 {
+		t.Fatalf("got %d stats, want 1 for the stream", len(sink.stats))
+	}
+	stats := sink.stats[0]
+	if !stats.Stream || stats.Provider != ClaudeProvider || stats.Usage != usage || stats.Err != nil {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+// namedLLM is a stubLLM served by provider
+type namedLLM struct {
+	stubLLM
+	provider LLMProvider
+}
+
+func (n *namedLLM) ProviderName() LLMProvider { return n.provider }
+
+func TestProviderName(t *testing.T) {
+	tests := []struct {
+		llm  ProviderNamer
+		want LLMProvider
+	}{
+		{&OpenAILLM{}, OpenAIProvider},
+		{&ClaudeLLM{}, ClaudeProvider},
+		{&GeminiLLM{}, GeminiProvider},
+	}
+	for _, tt := range tests {
+		if got := tt.llm.ProviderName(); got != tt.want {
+			t.Errorf("%T.ProviderName() = %q, want %q", tt.llm, got, tt.want)
+		}
+	}
+
+	// the provider serving the LLM takes precedence over the model's provider
+	sink := &statsRecorder{}
+	l := WithStats(&namedLLM{stubLLM: *answerLLM("hi"), provider: "proxy"}, sink)
+	if _, err := l.CreateChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi")); err != nil {
+		t.Fatal(err)
+	}
+	if got := sink.stats[0].Provider; got != "proxy" {
+		t.Errorf("stats provider = %q, want the provider named by the LLM", got)
+	}
+}
@@ -2,8 +2,11 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"strings"
+	"unicode"
 )
 
 // StreamHandler defines how to handle streaming tokens, tool calls,
@@ -25,12 +28,117 @@ type StreamHandler interface {
 	OnError(err error)
 }
 
+// JSONFieldHandler can optionally be implemented by a StreamHandler. For
+// requests in JSON mode or with a ResponseSchema, OnJSONField is called with
+// the key and raw value of every top-level field as soon as it is complete.
+type JSONFieldHandler interface {
+	OnJSONField(path string, value json.RawMessage)
+}
+
+// RefusalHandler can optionally be implemented by a StreamHandler to receive
+// refusal deltas, which are not passed to OnToken.
+type RefusalHandler interface {
+	OnRefusal(refusal string)
+}
+
+// ContentFilterHandler can optionally be implemented by a StreamHandler to be
+// notified, before OnComplete, when the provider's content filter stopped the output.
+type ContentFilterHandler interface {
+	OnContentFilter()
+}
+
+// ReasoningHandler can optionally be implemented by a StreamHandler to receive
+// reasoning deltas, e.g. for a "thinking" indicator. They are not passed to
+// OnToken and end up in OutputMessage.ReasoningContent rather than Content.
+type ReasoningHandler interface {
+	OnReasoningToken(token string)
+}
+
+// ToolCallDeltaHandler can optionally be implemented by a StreamHandler to
+// receive the arguments of tool calls while they are streamed, e.g. to render
+// them live. OnToolCall is still called with the complete tool call.
+type ToolCallDeltaHandler interface {
+	OnToolCallDelta(delta ToolCallDelta)
+}
+
+// StreamError is returned by a stream that fails after it delivered output,
+// e.g. when the provider sends an error event because it is overloaded.
+type StreamError struct {
+	// Err is the error that ended the stream.
+	Err error
+	// Partial holds the content and tool calls delivered before the error.
+	Partial OutputMessage
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("stream failed after partial output: %v", e.Err)
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// newStreamError wraps err in a StreamError if content or tool calls were
+// already delivered, otherwise it returns err as is
+func newStreamError(err error, content string, toolCalls []ToolCall) error {
+	if content == "" && len(toolCalls) == 0 {
+		return err
+	}
+	return &StreamError{
+		Err: err,
+		Partial: OutputMessage{
+			Role:      RoleAssistant,
+			Content:   content,
+			ToolCalls: append([]ToolCall(nil), toolCalls...),
+		},
+	}
+}
+
+// StreamOption configures StreamChatCompletion.
+type StreamOption func(*streamConfig)
+
+type streamConfig struct {
+	resumeAttempts    int
+	earlyToolDispatch bool
+	stopOnToolCall    bool
+}
+
+// WithStreamResume lets StreamChatCompletion resume a stream that fails with
+// a retryable error, e.g. a dropped connection, up to maxAttempts times.
+// Claude continues from the output received so far, passed as an assistant
+// prefill. Streams of other providers are only resumed before any output was
+// delivered, since a repeated request generates different output; later
+// failures are returned to the handler. Streams that already produced tool
+// calls are not resumed.
+func WithStreamResume(maxAttempts int) StreamOption {
+	return func(c *streamConfig) {
+		c.resumeAttempts = maxAttempts
+	}
+}
+
+// WithEarlyToolDispatch passes every tool call to OnToolCall as soon as it is
+// complete instead of when the stream finishes, so that tools can start
+// running while the model is still generating. With stop set the stream ends
+// after the first tool call: OnComplete receives the output up to that point.
+func WithEarlyToolDispatch(stop bool) StreamOption {
+	return func(c *streamConfig) {
+		c.earlyToolDispatch = true
+		c.stopOnToolCall = stop
+	}
+}
+
 func StreamChatCompletion(
 	ctx context.Context,
 	req ChatCompletionRequest,
 	handler StreamHandler,
 	model LLM,
+	opts ...StreamOption,
 ) error {
+	var cfg streamConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	stream, err := model.CreateChatCompletionStream(ctx, req)
 	if err != nil {
 		handler.OnError(err)
@@ -39,19 +147,52 @@ func StreamChatCompletion(
 
 	handler.OnStart()
 
-	var fullContent strings.Builder
+	var fullContent, refusal, reasoning strings.Builder
 	var toolCalls []ToolCall
+
+	// skip is the number of bytes of whitespace that were already delivered but
+	// trimmed from the prefill of a resumed stream, and may be repeated by it
+	var skip, attempts int
+	// dispatched is the number of tool calls already passed to OnToolCall
+	var dispatched int
+
+	var jsonParser *jsonFieldParser
+	if jsonHandler, ok := handler.(JSONFieldHandler); ok && (req.JSONMode || req.ResponseSchema != nil) {
+		jsonParser = newJSONFieldParser(jsonHandler.OnJSONField)
+	}
 	defer func() {
 		// In case you need to close the stream
 		_ = stream.Close()
 	}()
 
+	complete := func() {
+		handler.OnComplete(OutputMessage{
+			Role:             RoleAssistant,
+			Content:          fullContent.String(),
+			ToolCalls:        toolCalls,
+			Refusal:          refusal.String(),
+			ReasoningContent: reasoning.String(),
+		})
+	}
+
 	for {
 		chunk, err := stream.Recv() // however you read from your streaming LLM
 		if err != nil {
 			if isEOF(err) {
-				// Done reading
-				break
+				// The stream ended without a final chunk, complete with what was received
+				complete()
+				return nil
+			}
+			if attempts < cfg.resumeAttempts && len(toolCalls) == 0 && reasoning.Len() == 0 && isRetryableError(ctx, err) {
+				if resumeReq, resumeSkip, ok := resumeRequest(req, fullContent.String()); ok {
+					attempts++
+					_ = stream.Close()
+					skip = resumeSkip
+					stream, err = model.CreateChatCompletionStream(ctx, resumeReq)
+					if err == nil {
+						continue
+					}
+				}
 			}
 			handler.OnError(err)
 			return err
@@ -59,38 +200,108 @@ func StreamChatCompletion(
 
 		// 	// Usually the chunk includes tokens. For example:
 		for _, c := range chunk.Choices {
+			content := c.Message.Content
+			if skip > 0 {
+				// only whitespace is skipped, the stream may continue without repeating it
+				n := min(skip, len(content)-len(strings.TrimLeftFunc(content, unicode.IsSpace)))
+				content = content[n:]
+				skip -= n
+				if content != "" {
+					skip = 0
+				}
+			}
 
 			// If there's a partial delta (like with OpenAI's usage of .Delta)
-			if len(c.Message.Content) > 0 {
-				handler.OnToken(c.Message.Content)
-				fullContent.WriteString(c.Message.Content)
+			if len(content) > 0 {
+				handler.OnToken(content)
+				fullContent.WriteString(content)
+				if jsonParser != nil {
+					jsonParser.Write(content)
+				}
+			}
+
+			if c.Message.ReasoningContent != "" {
+				reasoning.WriteString(c.Message.ReasoningContent)
+				if reasoningHandler, ok := handler.(ReasoningHandler); ok {
+					reasoningHandler.OnReasoningToken(c.Message.ReasoningContent)
+				}
 			}
 
-			if len(c.Message.ToolCalls) > 0 {
-				toolCalls = append(toolCalls, c.Message.ToolCalls...)
+			if c.Message.Refusal != "" {
+				refusal.WriteString(c.Message.Refusal)
+				if refusalHandler, ok := handler.(RefusalHandler); ok {
+					refusalHandler.OnRefusal(c.Message.Refusal)
+				}
 			}
 
-			// If there's a tool call signaled
+			if deltaHandler, ok := handler.(ToolCallDeltaHandler); ok {
+				for _, delta := range c.Message.ToolCallDeltas {
+					deltaHandler.OnToolCallDelta(delta)
+				}
+			}
+
+			for _, toolCall := range c.Message.ToolCalls {
+				arguments, err := SanitizeToolArguments(toolCall.Function.Arguments)
+				if err != nil {
+					err = fmt.Errorf("invalid arguments for tool call %s: %w", toolCall.Function.Name, err)
+					handler.OnError(err)
+					return err
+				}
+				toolCall.Function.Arguments = arguments
+				toolCalls = append(toolCalls, toolCall)
+
+				if cfg.earlyToolDispatch {
+					handler.OnToolCall(toolCall)
+					dispatched++
+					if cfg.stopOnToolCall {
+						complete()
+						return nil
+					}
+				}
+			}
+
+			// If there's a tool call signaled, pass on every tool call of the response
 			if c.FinishReason == FinishReasonToolCalls {
-				// pass in your llm.ToolCall
-				lastToolCall := toolCalls[len(toolCalls)-1]
-				handler.OnToolCall(lastToolCall)
+				for _, toolCall := range toolCalls[dispatched:] {
+					handler.OnToolCall(toolCall)
+				}
+			}
+			if c.FinishReason == FinishReasonContentFilter {
+				if filterHandler, ok := handler.(ContentFilterHandler); ok {
+					filterHandler.OnContentFilter()
+				}
 			}
 			// If there's a final completion event
-			if c.FinishReason != FinishReasonNull {
+			if c.FinishReason != FinishReasonNull && c.FinishReason != "" {
 				// We got the final message, call OnComplete with the final message
-				msg := OutputMessage{
-					Role:      "assistant",
-					Content:   fullContent.String(),
-					ToolCalls: toolCalls,
-				}
-				handler.OnComplete(msg)
+				complete()
 				return nil
 			}
 		}
 	}
+}
+
+// resumeRequest returns the request that continues a stream which failed after
+// content was delivered, and the length of the whitespace trimmed from the
+// prefill, which the continuation may repeat. Only Claude can continue the
+// output, so other streams can only be resumed if nothing was delivered yet.
+func resumeRequest(req ChatCompletionRequest, content string) (ChatCompletionRequest, int, bool) {
+	if content == "" {
+		return req, 0, true
+	}
+	provider, _ := ProviderForModel(req.Model)
+	// Claude rejects a prefill ending with whitespace
+	prefill := strings.TrimRightFunc(content, unicode.IsSpace)
+	if provider != ClaudeProvider || prefill == "" {
+		return req, 0, false
+	}
 
-	return nil
+	resumeReq := req.Clone()
+	resumeReq.Messages = append(resumeReq.Messages, InputMessage{
+		Role:         RoleAssistant,
+		MultiContent: []ContentPart{{Type: ContentTypeText, Text: prefill}},
+	})
+	return resumeReq, len(content) - len(prefill), true
 }
 
 func isEOF(err error) bool {
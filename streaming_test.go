@@ -0,0 +1,382 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// scriptedStream returns its chunks and then err, io.EOF if nil
+type scriptedStream struct {
+	chunks []ChatCompletionResponse
+	err    error
+}
+
+func (s *scriptedStream) Recv() (ChatCompletionResponse, error) {
+	if len(s.chunks) == 0 {
+		if s.err != nil {
+			return ChatCompletionResponse{}, s.err
+		}
+		return ChatCompletionResponse{}, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *scriptedStream) Close() error { return nil }
+
+// scriptedLLM returns its streams in order and records the requests
+type scriptedLLM struct {
+	streams  []*scriptedStream
+	requests []ChatCompletionRequest
+}
+
+func (l *scriptedLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	return ChatCompletionResponse{}, errors.New("not implemented")
+}
+
+func (l *scriptedLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	l.requests = append(l.requests, req)
+	if len(l.streams) == 0 {
+		return nil, errors.New("no stream left")
+	}
+	stream := l.streams[0]
+	l.streams = l.streams[1:]
+	return stream, nil
+}
+
+// textChunk returns a stream chunk with content and an optional finish reason
+func textChunk(content string, finish FinishReason) ChatCompletionResponse {
+	if finish == "" {
+		finish = FinishReasonNull
+	}
+	return ChatCompletionResponse{Choices: []Choice{{
+		Message:      OutputMessage{Role: RoleAssistant, Content: content},
+		FinishReason: finish,
+	}}}
+}
+
+// recordingHandler records everything passed to a StreamHandler
+type recordingHandler struct {
+	tokens   strings.Builder
+	complete *OutputMessage
+	err      error
+}
+
+func (h *recordingHandler) OnStart()                   {}
+func (h *recordingHandler) OnToken(token string)       { h.tokens.WriteString(token) }
+func (h *recordingHandler) OnToolCall(ToolCall)        {}
+func (h *recordingHandler) OnError(err error)          { h.err = err }
+func (h *recordingHandler) OnComplete(m OutputMessage) { h.complete = &m }
+
+func TestStreamResume(t *testing.T) {
+	dropped := io.ErrUnexpectedEOF
+
+	tests := []struct {
+		name        string
+		model       Model
+		streams     []*scriptedStream
+		wantContent string
+		wantErr     bool
+		wantPrefill string
+	}{
+		{
+			name:  "claude continues from a prefill",
+			model: ModelClaude3Dot5SonnetLatest,
+			streams: []*scriptedStream{
+				{chunks: []ChatCompletionResponse{textChunk("Hello ", "")}, err: dropped},
+				{chunks: []ChatCompletionResponse{textChunk(" world", FinishReasonStop)}},
+			},
+			wantContent: "Hello world",
+			wantPrefill: "Hello",
+		},
+		{
+			name:  "claude continues without repeating the trimmed whitespace",
+			model: ModelClaude3Dot5SonnetLatest,
+			streams: []*scriptedStream{
+				{chunks: []ChatCompletionResponse{textChunk("Hello \n", "")}, err: dropped},
+				{chunks: []ChatCompletionResponse{textChunk("world", FinishReasonStop)}},
+			},
+			wantContent: "Hello \nworld",
+			wantPrefill: "Hello",
+		},
+		{
+			name:  "claude repeats part of the trimmed whitespace",
+			model: ModelClaude3Dot5SonnetLatest,
+			streams: []*scriptedStream{
+				{chunks: []ChatCompletionResponse{textChunk("Hello  ", "")}, err: dropped},
+				{chunks: []ChatCompletionResponse{textChunk(" ", ""), textChunk("world", FinishReasonStop)}},
+			},
+			wantContent: "Hello  world",
+			wantPrefill: "Hello",
+		},
+		{
+			name:  "openai is not resumed after output",
+			model: ModelGPT4o,
+			streams: []*scriptedStream{
+				{chunks: []ChatCompletionResponse{textChunk("Hello ", "")}, err: dropped},
+				{chunks: []ChatCompletionResponse{textChunk("Goodbye world", FinishReasonStop)}},
+			},
+			wantErr: true,
+		},
+		{
+			name:  "openai is restarted before any output",
+			model: ModelGPT4o,
+			streams: []*scriptedStream{
+				{err: dropped},
+				{chunks: []ChatCompletionResponse{textChunk("Hello", FinishReasonStop)}},
+			},
+			wantContent: "Hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &scriptedLLM{streams: tt.streams}
+			handler := &recordingHandler{}
+			err := StreamChatCompletion(context.Background(), testRequest(tt.model, "hi"), handler, model, WithStreamResume(1))
+
+			if tt.wantErr {
+				if !errors.Is(err, dropped) || handler.err == nil {
+					t.Fatalf("got error %v, want the stream's error", err)
+				}
+				if len(model.requests) != 1 {
+					t.Errorf("stream was resumed %d times", len(model.requests)-1)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if handler.complete == nil || handler.complete.Content != tt.wantContent {
+				t.Fatalf("completed with %+v, want content %q", handler.complete, tt.wantContent)
+			}
+			if got := handler.tokens.String(); got != tt.wantContent {
+				t.Errorf("tokens = %q, want %q", got, tt.wantContent)
+			}
+			if tt.wantPrefill != "" {
+				messages := model.requests[1].Messages
+				last := messages[len(messages)-1]
+				if last.Role != RoleAssistant || last.MultiContent[0].Text != tt.wantPrefill {
+					t.Errorf("resumed with %+v, want prefill %q", last, tt.wantPrefill)
+				}
+			}
+		})
+	}
+}
+
+// eventLog records the order of the events passed to a StreamHandler
+type eventLog struct {
+	recordingHandler
+	events []string
+}
+
+func (h *eventLog) OnToken(token string) {
+	h.recordingHandler.OnToken(token)
+	h.events = append(h.events, "token "+token)
+}
+
+func (h *eventLog) OnToolCall(toolCall ToolCall) {
+	h.events = append(h.events, "tool "+toolCall.Function.Name)
+}
+
+func (h *eventLog) OnComplete(m OutputMessage) {
+	h.recordingHandler.OnComplete(m)
+	h.events = append(h.events, "complete")
+}
+
+func TestStreamEarlyToolDispatch(t *testing.T) {
+	toolChunk := func(name string) ChatCompletionResponse {
+		chunk := textChunk("", "")
+		chunk.Choices[0].Message.ToolCalls = []ToolCall{{
+			ID: "call_" + name, Type: "function", Function: ToolCallFunction{Name: name, Arguments: "{}"},
+		}}
+		return chunk
+	}
+	chunks := func() []ChatCompletionResponse {
+		return []ChatCompletionResponse{
+			textChunk("Checking", ""),
+			toolChunk("weather"),
+			textChunk(" more", ""),
+			toolChunk("time"),
+			textChunk("", FinishReasonToolCalls),
+		}
+	}
+
+	tests := []struct {
+		name       string
+		opts       []StreamOption
+		wantEvents []string
+		wantCalls  int
+		wantUnread int
+	}{
+		{
+			name:       "dispatched at the end by default",
+			wantEvents: []string{"token Checking", "token  more", "tool weather", "tool time", "complete"},
+			wantCalls:  2,
+		},
+		{
+			name:       "dispatched as soon as complete",
+			opts:       []StreamOption{WithEarlyToolDispatch(false)},
+			wantEvents: []string{"token Checking", "tool weather", "token  more", "tool time", "complete"},
+			wantCalls:  2,
+		},
+		{
+			name:       "stopped at the first tool call",
+			opts:       []StreamOption{WithEarlyToolDispatch(true)},
+			wantEvents: []string{"token Checking", "tool weather", "complete"},
+			wantCalls:  1,
+			wantUnread: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &scriptedStream{chunks: chunks()}
+			handler := &eventLog{}
+			err := StreamChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"), handler,
+				&scriptedLLM{streams: []*scriptedStream{stream}}, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Join(handler.events, "|") != strings.Join(tt.wantEvents, "|") {
+				t.Errorf("events = %q, want %q", handler.events, tt.wantEvents)
+			}
+			if len(handler.complete.ToolCalls) != tt.wantCalls {
+				t.Errorf("completed with %d tool calls, want %d", len(handler.complete.ToolCalls), tt.wantCalls)
+			}
+			if len(stream.chunks) != tt.wantUnread {
+				t.Errorf("%d chunks were not read, want %d", len(stream.chunks), tt.wantUnread)
+			}
+		})
+	}
+}
+
+func TestStreamErrorAfterContent(t *testing.T) {
+	tests := []struct {
+		name  string
+		model Model
+		llm   func(t *testing.T) LLM
+	}{
+		{
+			name:  "openai",
+			model: ModelGPT4o,
+			llm: func(t *testing.T) LLM {
+				return newTestOpenAILLM(t, func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "text/event-stream")
+					fmt.Fprint(w, "data: {\"id\":\"chatcmpl-1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hello\"}}]}\n\n")
+					fmt.Fprint(w, "data: {\"error\":{\"message\":\"Overloaded\",\"type\":\"server_error\"}}\n\n")
+				})
+			},
+		},
+		{
+			name:  "claude",
+			model: ModelClaude3Dot5SonnetLatest,
+			llm: func(t *testing.T) LLM {
+				return newTestClaudeLLM(t, func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "text/event-stream")
+					for _, event := range []string{
+						`message_start`, `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude-3-5-sonnet-latest","usage":{"input_tokens":3,"output_tokens":1}}}`,
+						`content_block_start`, `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+						`content_block_delta`, `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+						`error`, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+					} {
+						if strings.HasPrefix(event, "{") {
+							fmt.Fprintf(w, "data: %s\n\n", event)
+						} else {
+							fmt.Fprintf(w, "event: %s\n", event)
+						}
+					}
+				})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := testRequest(tt.model, "hi")
+			req.MaxTokens = 100
+			handler := &recordingHandler{}
+			err := StreamChatCompletion(context.Background(), req, handler, tt.llm(t))
+
+			var streamErr *StreamError
+			if !errors.As(err, &streamErr) {
+				t.Fatalf("got error %v, want a StreamError", err)
+			}
+			if streamErr.Partial.Content != "Hello" {
+				t.Errorf("partial content = %q, want the content delivered before the error", streamErr.Partial.Content)
+			}
+			if !strings.Contains(err.Error(), "Overloaded") {
+				t.Errorf("error %q does not contain the provider's error", err)
+			}
+			if got := handler.tokens.String(); got != "Hello" {
+				t.Errorf("tokens = %q, want the content before the error", got)
+			}
+			if handler.err == nil || handler.complete != nil {
+				t.Errorf("handler got error %v and completion %+v, want only the error", handler.err, handler.complete)
+			}
+		})
+	}
+}
+
+func (h *eventLog) OnReasoningToken(token string) {
+	h.events = append(h.events, "reasoning "+token)
+}
+
+func TestStreamReasoning(t *testing.T) {
+	reasoningChunk := func(reasoning string) ChatCompletionResponse {
+		chunk := textChunk("", "")
+		chunk.Choices[0].Message.ReasoningContent = reasoning
+		return chunk
+	}
+	chunks := func() []ChatCompletionResponse {
+		return []ChatCompletionResponse{
+			reasoningChunk("Paris is "),
+			reasoningChunk("the capital."),
+			textChunk("It is ", ""),
+			reasoningChunk(" Double-check."),
+			textChunk("Paris.", FinishReasonStop),
+		}
+	}
+
+	t.Run("reasoning handler", func(t *testing.T) {
+		handler := &eventLog{}
+		model := &scriptedLLM{streams: []*scriptedStream{{chunks: chunks()}}}
+		if err := StreamChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"), handler, model); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{
+			"reasoning Paris is ", "reasoning the capital.", "token It is ",
+			"reasoning  Double-check.", "token Paris.", "complete",
+		}
+		if !reflect.DeepEqual(handler.events, want) {
+			t.Errorf("events = %q, want %q", handler.events, want)
+		}
+		if got := handler.complete.Content; got != "It is Paris." {
+			t.Errorf("content = %q, want the answer only", got)
+		}
+		if got := handler.complete.ReasoningContent; got != "Paris is the capital. Double-check." {
+			t.Errorf("reasoning content = %q", got)
+		}
+	})
+
+	t.Run("plain handler", func(t *testing.T) {
+		handler := &recordingHandler{}
+		model := &scriptedLLM{streams: []*scriptedStream{{chunks: chunks()}}}
+		if err := StreamChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"), handler, model); err != nil {
+			t.Fatal(err)
+		}
+		if got := handler.tokens.String(); got != "It is Paris." {
+			t.Errorf("tokens = %q, reasoning must not be passed to OnToken", got)
+		}
+		if got := handler.complete.ReasoningContent; got != "Paris is the capital. Double-check." {
+			t.Errorf("reasoning content = %q, want it collected without a ReasoningHandler", got)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// WithMaxOutputLength wraps handler so that at most maxChars characters of
+// streamed output are delivered. Once the cap is reached the collected output
+// is passed to OnComplete and cancel is called to abort the stream; events
+// after that, including the resulting context error, are not forwarded.
+// cancel must cancel the context passed to StreamChatCompletion. The optional
+// handler interfaces such as ReasoningHandler are forwarded if handler
+// implements them.
+func WithMaxOutputLength(handler StreamHandler, maxChars int, cancel context.CancelFunc) StreamHandler {
+	return &maxLengthHandler{
+		handler:  handler,
+		maxChars: maxChars,
+		cancel:   cancel,
+	}
+}
+
+type maxLengthHandler struct {
+	handler  StreamHandler
+	maxChars int
+	cancel   context.CancelFunc
+
+	content strings.Builder
+	chars   int
+	done    bool
+}
+
+func (h *maxLengthHandler) OnStart() {
+	h.handler.OnStart()
+}
+
+func (h *maxLengthHandler) OnToken(token string) {
+	if h.done {
+		return
+	}
+
+	remaining := h.maxChars - h.chars
+	if n := utf8.RuneCountInString(token); n < remaining {
+		h.chars += n
+		h.content.WriteString(token)
+		h.handler.OnToken(token)
+		return
+	}
+
+	// cut the token at the cap, counting characters rather than bytes
+	end := len(token)
+	for i := range token {
+		if remaining == 0 {
+			end = i
+			break
+		}
+		remaining--
+	}
+	token = token[:end]
+	if token != "" {
+		h.content.WriteString(token)
+		h.handler.OnToken(token)
+	}
+
+	h.done = true
+	h.handler.OnComplete(OutputMessage{
+		Role:    RoleAssistant,
+		Content: h.content.String(),
+	})
+	h.cancel()
+}
+
+func (h *maxLengthHandler) OnToolCall(toolCall ToolCall) {
+	if h.done {
+		return
+	}
+	h.handler.OnToolCall(toolCall)
+}
+
+func (h *maxLengthHandler) OnComplete(message OutputMessage) {
+	if h.done {
+		return
+	}
+	h.done = true
+	h.handler.OnComplete(message)
+}
+
+func (h *maxLengthHandler) OnError(err error) {
+	if h.done {
+		return
+	}
+	h.handler.OnError(err)
+}
+
+func (h *maxLengthHandler) OnReasoningToken(token string) {
+	if reasoningHandler, ok := h.handler.(ReasoningHandler); ok && !h.done {
+		reasoningHandler.OnReasoningToken(token)
+	}
+}
+
+func (h *maxLengthHandler) OnRefusal(refusal string) {
+	if refusalHandler, ok := h.handler.(RefusalHandler); ok && !h.done {
+		refusalHandler.OnRefusal(refusal)
+	}
+}
+
+func (h *maxLengthHandler) OnToolCallDelta(delta ToolCallDelta) {
+	if deltaHandler, ok := h.handler.(ToolCallDeltaHandler); ok && !h.done {
+		deltaHandler.OnToolCallDelta(delta)
+	}
+}
+
+func (h *maxLengthHandler) OnJSONField(path string, value json.RawMessage) {
+	if jsonHandler, ok := h.handler.(JSONFieldHandler); ok && !h.done {
+		jsonHandler.OnJSONField(path, value)
+	}
+}
+
+func (h *maxLengthHandler) OnContentFilter() {
+	if filterHandler, ok := h.handler.(ContentFilterHandler); ok && !h.done {
+		filterHandler.OnContentFilter()
+	}
+}
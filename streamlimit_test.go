@@ -0,0 +1,99 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// endlessLLM streams chunks until the context of the stream is cancelled
+type endlessLLM struct {
+	chunk ChatCompletionResponse
+	recvs atomic.Int32
+}
+
+func (l *endlessLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	return ChatCompletionResponse{}, errors.New("not implemented")
+}
+
+func (l *endlessLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	return &endlessStream{ctx: ctx, llm: l}, nil
+}
+
+type endlessStream struct {
+	ctx context.Context
+	llm *endlessLLM
+}
+
+func (s *endlessStream) Recv() (ChatCompletionResponse, error) {
+	if err := s.ctx.Err(); err != nil {
+		return ChatCompletionResponse{}, err
+	}
+	s.llm.recvs.Add(1)
+	return s.llm.chunk, nil
+}
+
+func (s *endlessStream) Close() error { return nil }
+
+// reasoningRecorder records reasoning tokens in addition to the stream
+type reasoningRecorder struct {
+	recordingHandler
+	reasoning strings.Builder
+}
+
+func (h *reasoningRecorder) OnReasoningToken(token string) { h.reasoning.WriteString(token) }
+
+func TestMaxOutputLengthCancelsStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chunk := textChunk("héllo ", "")
+	chunk.Choices[0].Message.ReasoningContent = "."
+	model := &endlessLLM{chunk: chunk}
+	handler := &reasoningRecorder{}
+
+	err := StreamChatCompletion(ctx, testRequest(ModelGPT4o, "hi"), WithMaxOutputLength(handler, 15, cancel), model)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want the stream to be cancelled", err)
+	}
+	if handler.err != nil {
+		t.Errorf("the cancellation was passed to OnError: %v", handler.err)
+	}
+
+	want := "héllo héllo hél"
+	if got := handler.tokens.String(); got != want {
+		t.Errorf("tokens = %q, want %q", got, want)
+	}
+	if handler.complete == nil || handler.complete.Content != want {
+		t.Fatalf("completed with %+v, want content %q", handler.complete, want)
+	}
+	if recvs := model.recvs.Load(); recvs != 3 {
+		t.Errorf("received %d chunks, want the stream to stop at the cap after 3", recvs)
+	}
+	// the reasoning of the chunk that reached the cap follows its content and is dropped
+	if got := handler.reasoning.String(); got != ".." {
+		t.Errorf("reasoning = %q, want it forwarded until the cap", got)
+	}
+}
+
+func TestMaxOutputLengthUnderCap(t *testing.T) {
+	model := &scriptedLLM{streams: []*scriptedStream{{chunks: []ChatCompletionResponse{
+		textChunk("short", ""), textChunk(" answer", FinishReasonStop),
+	}}}}
+	handler := &recordingHandler{}
+	cancelled := false
+
+	err := StreamChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"),
+		WithMaxOutputLength(handler, 100, func() { cancelled = true }), model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled {
+		t.Error("a stream under the cap was cancelled")
+	}
+	if handler.complete == nil || handler.complete.Content != "short answer" {
+		t.Errorf("completed with %+v", handler.complete)
+	}
+}
@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// NewStreamReader streams a completion of req and returns a reader of its
+// content, for io.Reader based pipelines. Reading blocks until the next tokens
+// arrive and returns io.EOF once the completion is finished, or the stream's
+// error if it fails. Tool calls are not part of the content and are dropped.
+func NewStreamReader(ctx context.Context, req ChatCompletionRequest, model LLM) (io.ReadCloser, error) {
+	stream, err := model.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{stream: stream}, nil
+}
+
+// streamReader reads the content of a stream chunk by chunk
+type streamReader struct {
+	stream ChatCompletionStream
+	// pending is the content of the last chunk not read yet
+	pending []byte
+	// err is returned once pending is read, io.EOF after the final chunk
+	err error
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.next()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// next receives the next chunk into pending and records the end of the stream
+func (r *streamReader) next() {
+	chunk, err := r.stream.Recv()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.EOF
+		}
+		r.err = err
+		return
+	}
+	for _, c := range chunk.Choices {
+		if c.Index != 0 {
+			continue
+		}
+		r.pending = append(r.pending, c.Message.Content...)
+		if c.FinishReason != FinishReasonNull && c.FinishReason != "" {
+			r.err = io.EOF
+		}
+	}
+}
+
+func (r *streamReader) Close() error {
+	return r.stream.Close()
+}
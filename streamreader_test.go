@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStreamReader(t *testing.T) {
+	dropped := errors.New("connection reset")
+	other := textChunk("ignored", "")
+	other.Choices[0].Index = 1
+
+	tests := []struct {
+		name    string
+		stream  *scriptedStream
+		want    string
+		wantErr error
+	}{
+		{
+			name: "finished stream",
+			stream: &scriptedStream{chunks: []ChatCompletionResponse{
+				textChunk("Hello", ""), other, textChunk(", ", ""), textChunk("world!", FinishReasonStop),
+				// chunks after the final one are not read
+				textChunk(" more", ""),
+			}},
+			want: "Hello, world!",
+		},
+		{
+			name:   "stream ending without a final chunk",
+			stream: &scriptedStream{chunks: []ChatCompletionResponse{textChunk("Hello", ""), textChunk("", ""), textChunk(" world", "")}},
+			want:   "Hello world",
+		},
+		{
+			name:    "failed stream",
+			stream:  &scriptedStream{chunks: []ChatCompletionResponse{textChunk("Hello", "")}, err: dropped},
+			want:    "Hello",
+			wantErr: dropped,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewStreamReader(context.Background(), testRequest(ModelGPT4o, "hi"), &scriptedLLM{streams: []*scriptedStream{tt.stream}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			// read byte by byte to cover chunks spanning several reads
+			got, err := io.ReadAll(iotest.OneByteReader(r))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamReaderCreateError(t *testing.T) {
+	if _, err := NewStreamReader(context.Background(), testRequest(ModelGPT4o, "hi"), &scriptedLLM{}); err == nil {
+		t.Error("failing to create the stream is not an error")
+	}
+}
@@ -0,0 +1,98 @@
+package llm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// WithStrictConversion makes the client return an error instead of silently
+// dropping content that cannot be converted to the provider's format.
+func WithStrictConversion() ClientOption {
+	return func(c *clientConfig) {
+		c.conversion.strict = true
+	}
+}
+
+// validate checks req with validateConversion if strict conversion is enabled
+func (c conversionConfig) validate(req ChatCompletionRequest, provider LLMProvider) error {
+	if !c.strict {
+		return nil
+	}
+	return validateConversion(req, provider)
+}
+
+// validateConversion reports the first piece of content the provider's
+// converters would drop.
+func validateConversion(req ChatCompletionRequest, provider LLMProvider) error {
+	if req.CachedContent != "" && provider != GeminiProvider {
+		return fmt.Errorf("cached content %s is dropped by %s: only Gemini supports it", req.CachedContent, provider)
+	}
+
+	for i, part := range req.SystemContent {
+		if part.Type != ContentTypeText {
+			return fmt.Errorf("system content part %d of type %q is dropped by %s: only text is supported", i, part.Type, provider)
+		}
+	}
+
+	for i, msg := range req.Messages {
+		switch msg.Role {
+		case RoleUser, RoleAssistant, RoleTool:
+		default:
+			return fmt.Errorf("message %d with role %q is dropped by %s: unknown role", i, msg.Role, provider)
+		}
+
+		for j, part := range msg.MultiContent {
+			switch part.Type {
+			case ContentTypeText:
+			case ContentTypeImage, ContentTypeDocument:
+				if part.Type == ContentTypeDocument && provider == OpenAIProvider {
+					return fmt.Errorf("document part %d of message %d is dropped by %s: documents are not supported", j, i, provider)
+				}
+				if provider != GeminiProvider {
+					continue
+				}
+				if _, err := base64.StdEncoding.DecodeString(part.Data); err != nil {
+					return fmt.Errorf("%s part %d of message %d is dropped by %s: invalid base64 data: %w", part.Type, j, i, provider, err)
+				}
+			case ContentTypeImages:
+				if provider != GeminiProvider {
+					continue
+				}
+				for _, data := range part.Images {
+					if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+						return fmt.Errorf("%s part %d of message %d is dropped by %s: invalid base64 data: %w", part.Type, j, i, provider, err)
+					}
+				}
+			default:
+				return fmt.Errorf("part %d of message %d is dropped by %s: unsupported content type %q", j, i, provider, part.Type)
+			}
+		}
+
+		if msg.Role == RoleTool {
+			if len(msg.ToolResults) == 0 && provider == OpenAIProvider {
+				return fmt.Errorf("tool message %d is dropped by %s: it has no tool results", i, provider)
+			}
+			for _, tr := range msg.ToolResults {
+				for j, part := range tr.ResultParts {
+					if part.Type != ContentTypeText && (provider == OpenAIProvider || part.Type == ContentTypeAudio) {
+						return fmt.Errorf("%s part %d of the result of tool call %s is dropped by %s", part.Type, j, tr.ToolCallID, provider)
+					}
+				}
+			}
+			if len(msg.ToolResults) > 0 && len(msg.MultiContent) > 0 && provider == OpenAIProvider {
+				return fmt.Errorf("content of tool message %d is dropped by %s: only the tool result is sent", i, provider)
+			}
+		}
+
+		if msg.Role == RoleAssistant && provider == GeminiProvider {
+			for j, tc := range msg.ToolCalls {
+				var args map[string]any
+				if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+					return fmt.Errorf("arguments of tool call %d in message %d are dropped by %s: %w", j, i, provider, err)
+				}
+			}
+		}
+	}
+	return nil
+}
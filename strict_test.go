@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConversion(t *testing.T) {
+	text := func(s string) ContentPart { return ContentPart{Type: ContentTypeText, Text: s} }
+	user := func(parts ...ContentPart) InputMessage { return InputMessage{Role: RoleUser, MultiContent: parts} }
+	image := ContentPart{Type: ContentTypeImage, MediaType: "image/png", Data: "aGk="}
+	badImage := ContentPart{Type: ContentTypeImage, MediaType: "image/png", Data: "not base64!"}
+	document := ContentPart{Type: ContentTypeDocument, MediaType: "application/pdf", Data: "JVBERi0="}
+	call := ToolCall{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "f", Arguments: `{"a":1}`}}
+
+	tests := []struct {
+		name     string
+		provider LLMProvider
+		req      ChatCompletionRequest
+		// wantErr is a substring of the expected error, empty if nothing is dropped
+		wantErr string
+	}{
+		{
+			name:     "nothing dropped",
+			provider: OpenAIProvider,
+			req:      ChatCompletionRequest{Messages: []InputMessage{user(text("hi"), image)}},
+		},
+		{
+			name:     "cached content",
+			provider: ClaudeProvider,
+			req:      ChatCompletionRequest{CachedContent: "cachedContents/1", Messages: []InputMessage{user(text("hi"))}},
+			wantErr:  "cached content",
+		},
+		{
+			name:     "cached content for Gemini",
+			provider: GeminiProvider,
+			req:      ChatCompletionRequest{CachedContent: "cachedContents/1", Messages: []InputMessage{user(text("hi"))}},
+		},
+		{
+			name:     "non-text system content",
+			provider: OpenAIProvider,
+			req:      ChatCompletionRequest{SystemContent: []ContentPart{image}, Messages: []InputMessage{user(text("hi"))}},
+			wantErr:  "system content part 0",
+		},
+		{
+			name:     "unknown role",
+			provider: ClaudeProvider,
+			req:      ChatCompletionRequest{Messages: []InputMessage{{Role: "system", MultiContent: []ContentPart{text("hi")}}}},
+			wantErr:  "unknown role",
+		},
+		{
+			name:     "document for OpenAI",
+			provider: OpenAIProvider,
+			req:      ChatCompletionRequest{Messages: []InputMessage{user(document)}},
+			wantErr:  "documents are not supported",
+		},
+		{
+			name:     "document for Claude",
+			provider: ClaudeProvider,
+			req:      ChatCompletionRequest{Messages: []InputMessage{user(document)}},
+		},
+		{
+			name:     "invalid base64 for Gemini",
+			provider: GeminiProvider,
+			req:      ChatCompletionRequest{Messages: []InputMessage{user(badImage)}},
+			wantErr:  "invalid base64 data",
+		},
+		{
+			name:     "invalid base64 in images for Gemini",
+			provider: GeminiProvider,
+			req: ChatCompletionRequest{Messages: []InputMessage{user(ContentPart{
+				Type: ContentTypeImages, MediaType: "image/png", Images: []string{"aGk=", "not base64!"},
+			})}},
+			wantErr: "invalid base64 data",
+		},
+		{
+			name:     "unsupported content type",
+			provider: ClaudeProvider,
+			req:      ChatCompletionRequest{Messages: []InputMessage{user(ContentPart{Type: "video"})}},
+			wantErr:  `unsupported content type "video"`,
+		},
+		{
+			name:     "tool message without results",
+			provider: OpenAIProvider,
+			req:      ChatCompletionRequest{Messages: []InputMessage{user(text("hi")), {Role: RoleTool}}},
+			wantErr:  "has no tool results",
+		},
+		{
+			name:     "image tool result for OpenAI",
+			provider: OpenAIProvider,
+			req: ChatCompletionRequest{Messages: []InputMessage{user(text("hi")), {Role: RoleTool, ToolResults: []ToolResult{
+				{ToolCallID: "call_1", ResultParts: []ContentPart{image}},
+			}}}},
+			wantErr: "result of tool call call_1",
+		},
+		{
+			name:     "audio tool result for Claude",
+			provider: ClaudeProvider,
+			req: ChatCompletionRequest{Messages: []InputMessage{user(text("hi")), {Role: RoleTool, ToolResults: []ToolResult{
+				{ToolCallID: "call_1", ResultParts: []ContentPart{{Type: ContentTypeAudio, MediaType: "audio/wav", Data: "aGk="}}},
+			}}}},
+			wantErr: "result of tool call call_1",
+		},
+		{
+			name:     "content of a tool message for OpenAI",
+			provider: OpenAIProvider,
+			req: ChatCompletionRequest{Messages: []InputMessage{user(text("hi")), {
+				Role: RoleTool, MultiContent: []ContentPart{text("note")}, ToolResults: []ToolResult{{ToolCallID: "call_1", Result: "ok"}},
+			}}},
+			wantErr: "content of tool message 1",
+		},
+		{
+			name:     "invalid tool call arguments for Gemini",
+			provider: GeminiProvider,
+			req: ChatCompletionRequest{Messages: []InputMessage{user(text("hi")), {
+				Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Function: ToolCallFunction{Name: "f", Arguments: "{"}}},
+			}}},
+			wantErr: "arguments of tool call 0",
+		},
+		{
+			name:     "valid tool call arguments for Gemini",
+			provider: GeminiProvider,
+			req:      ChatCompletionRequest{Messages: []InputMessage{user(text("hi")), {Role: RoleAssistant, ToolCalls: []ToolCall{call}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConversion(tt.req, tt.provider)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to mention %q", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), string(tt.provider)) {
+				t.Errorf("error %q does not name the provider", err)
+			}
+		})
+	}
+}
+
+func TestStrictConversionDisabled(t *testing.T) {
+	req := ChatCompletionRequest{Messages: []InputMessage{{Role: "system"}}}
+	if err := (conversionConfig{}).validate(req, OpenAIProvider); err != nil {
+		t.Errorf("dropped content is an error without strict conversion: %v", err)
+	}
+	if err := (conversionConfig{strict: true}).validate(req, OpenAIProvider); err == nil {
+		t.Error("dropped content is not an error with strict conversion")
+	}
+}
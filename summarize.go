@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SummaryPrompt is the system prompt used by SummarizeHistory.
+var SummaryPrompt = "Summarize the following conversation in a few sentences. " +
+	"Keep facts, decisions, open questions and the results of tool calls that later turns may rely on. " +
+	"Reply with the summary only."
+
+// SummaryPrefix starts the message returned by SummarizeHistory.
+var SummaryPrefix = "Summary of the earlier conversation: "
+
+// SummarizeHistory asks llm to summarize messages and returns a single message
+// that can replace them, keeping long conversations within the context window.
+// The summary is a user message so that the shortened conversation can still
+// start with it, which Claude requires.
+func SummarizeHistory(ctx context.Context, llm LLM, messages []InputMessage, model Model) (InputMessage, error) {
+	if len(messages) == 0 {
+		return InputMessage{}, errors.New("no messages to summarize")
+	}
+
+	systemPrompt := SummaryPrompt
+	resp, err := llm.CreateChatCompletion(ctx, ChatCompletionRequest{
+		Model:        model,
+		SystemPrompt: &systemPrompt,
+		Messages: []InputMessage{{
+			Role:         RoleUser,
+			MultiContent: []ContentPart{{Type: ContentTypeText, Text: transcript(messages)}},
+		}},
+	})
+	if err != nil {
+		return InputMessage{}, fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		return InputMessage{}, errors.New("failed to summarize conversation: empty response")
+	}
+
+	return InputMessage{
+		Role:         RoleUser,
+		MultiContent: []ContentPart{{Type: ContentTypeText, Text: SummaryPrefix + resp.Choices[0].Message.Content}},
+	}, nil
+}
+
+// transcript renders messages as plain text, one line per content part,
+// tool call and tool result
+func transcript(messages []InputMessage) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		for _, part := range msg.MultiContent {
+			switch part.Type {
+			case ContentTypeText:
+				fmt.Fprintf(&b, "%s: %s\n", msg.Role, part.Text)
+			default:
+				fmt.Fprintf(&b, "%s: [%s]\n", msg.Role, part.Type)
+			}
+		}
+		for _, tc := range msg.ToolCalls {
+			fmt.Fprintf(&b, "%s: called %s(%s)\n", msg.Role, tc.Function.Name, tc.Function.Arguments)
+		}
+		for _, tr := range msg.ToolResults {
+			fmt.Fprintf(&b, "%s: %s returned %s\n", msg.Role, tr.FunctionName, tr.Result)
+		}
+	}
+	return b.String()
+}
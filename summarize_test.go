@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeHistory(t *testing.T) {
+	messages := []InputMessage{
+		{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "What's the weather in Paris?"}}},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "weather", Arguments: `{"city":"Paris"}`}}}},
+		{Role: RoleTool, ToolResults: []ToolResult{{ToolCallID: "call_1", FunctionName: "weather", Result: "sunny"}}},
+		{Role: RoleAssistant, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "It is sunny."}}},
+	}
+
+	var sent ChatCompletionRequest
+	mock := &stubLLM{complete: func(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+		sent = req
+		return ChatCompletionResponse{Choices: []Choice{{Message: OutputMessage{Role: RoleAssistant, Content: "The user asked about Paris, it is sunny."}}}}, nil
+	}}
+
+	summary, err := SummarizeHistory(context.Background(), mock, messages, ModelGPT4oMini)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent.Model != ModelGPT4oMini || sent.SystemPrompt == nil || *sent.SystemPrompt != SummaryPrompt {
+		t.Errorf("sent model %q with system prompt %v", sent.Model, sent.SystemPrompt)
+	}
+	if len(sent.Messages) != 1 {
+		t.Fatalf("sent %d messages, want the transcript only", len(sent.Messages))
+	}
+	got := sent.Messages[0].MultiContent[0].Text
+	for _, line := range []string{
+		"user: What's the weather in Paris?",
+		`assistant: called weather({"city":"Paris"})`,
+		"tool: weather returned sunny",
+		"assistant: It is sunny.",
+	} {
+		if !strings.Contains(got, line) {
+			t.Errorf("transcript %q does not contain %q", got, line)
+		}
+	}
+
+	want := SummaryPrefix + "The user asked about Paris, it is sunny."
+	if summary.Role != RoleUser || len(summary.MultiContent) != 1 || summary.MultiContent[0].Text != want {
+		t.Errorf("got summary %+v, want a user message with %q", summary, want)
+	}
+}
+
+func TestSummarizeHistoryErrors(t *testing.T) {
+	failure := errors.New("overloaded")
+	messages := []InputMessage{{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "hi"}}}}
+
+	tests := []struct {
+		name     string
+		messages []InputMessage
+		llm      LLM
+		wantIs   error
+	}{
+		{"no messages", nil, answerLLM("unused"), nil},
+		{"empty summary", messages, answerLLM(""), nil},
+		{"failed call", messages, &stubLLM{complete: func(context.Context, ChatCompletionRequest) (ChatCompletionResponse, error) {
+			return ChatCompletionResponse{}, failure
+		}}, failure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SummarizeHistory(context.Background(), tt.llm, tt.messages, ModelGPT4oMini)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("error %v does not wrap %v", err, tt.wantIs)
+			}
+		})
+	}
+}
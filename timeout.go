@@ -0,0 +1,103 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// WithTimeout sets a default timeout for the requests of a client, so that
+// call sites do not need their own context deadline. Blocking calls must
+// complete within d. Streams must be established within d and then deliver
+// each chunk within d of the previous one, however long the stream runs in
+// total. A deadline set on the caller's context always wins: if it has one,
+// the timeout is not applied.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.timeout = d
+	}
+}
+
+// withRequestTimeout applies the client timeout d to a blocking call
+func withRequestTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// withStreamTimeout creates a stream with create, applying the client timeout
+// d to establishing the stream and to every wait for a chunk
+func withStreamTimeout(ctx context.Context, d time.Duration, create func(context.Context) (ChatCompletionStream, error)) (ChatCompletionStream, error) {
+	if _, ok := ctx.Deadline(); ok || d <= 0 {
+		return create(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &timeoutStream{timeout: d, cancel: cancel}
+	s.start()
+	stream, err := create(ctx)
+	if expired := s.stop(); err != nil {
+		cancel()
+		return nil, s.wrap(err, expired)
+	}
+	s.ChatCompletionStream = stream
+	return s, nil
+}
+
+// timeoutStream cancels its stream when a chunk takes longer than timeout to arrive
+type timeoutStream struct {
+	ChatCompletionStream
+	timeout time.Duration
+	cancel  context.CancelFunc
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	expired bool
+}
+
+// start starts waiting for the provider
+func (s *timeoutStream) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timer = time.AfterFunc(s.timeout, func() {
+		s.mu.Lock()
+		s.expired = true
+		s.mu.Unlock()
+		s.cancel()
+	})
+}
+
+// stop stops waiting and reports whether the timeout expired
+func (s *timeoutStream) stop() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timer.Stop()
+	return s.expired
+}
+
+// wrap marks err as caused by the timeout if it expired
+func (s *timeoutStream) wrap(err error, expired bool) error {
+	if !expired || errors.Is(err, io.EOF) {
+		return err
+	}
+	return fmt.Errorf("%w: no response within %v: %w", context.DeadlineExceeded, s.timeout, err)
+}
+
+func (s *timeoutStream) Recv() (ChatCompletionResponse, error) {
+	s.start()
+	resp, err := s.ChatCompletionStream.Recv()
+	if expired := s.stop(); err != nil {
+		return resp, s.wrap(err, expired)
+	}
+	return resp, nil
+}
+
+func (s *timeoutStream) Close() error {
+	err := s.ChatCompletionStream.Close()
+	s.cancel()
+	return err
+}
@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// tokenEstimate holds the parameters of the token heuristic for a provider.
+type tokenEstimate struct {
+	// charsPerToken is the average number of characters per token of the tokenizer.
+	charsPerToken float64
+	// perMessage is the formatting overhead added for every message.
+	perMessage int
+	// perImage is the approximate cost of an image.
+	perImage int
+}
+
+var tokenEstimates = map[LLMProvider]tokenEstimate{
+	OpenAIProvider: {charsPerToken: 4, perMessage: 4, perImage: 765},
+	ClaudeProvider: {charsPerToken: 3.5, perMessage: 3, perImage: 1600},
+	GeminiProvider: {charsPerToken: 4, perMessage: 2, perImage: 258},
+}
+
+// EstimateTokens approximates the number of prompt tokens of messages for the
+// given model without a network call. It is a character based estimate and
+// can be off by a few percent from the provider's own count, so leave some
+// headroom when budgeting against a context window.
+func EstimateTokens(messages []InputMessage, model Model) int {
+	estimate := tokenEstimateForModel(model)
+	tokens := 0
+	for _, msg := range messages {
+		tokens += estimate.messageTokens(msg)
+	}
+	return tokens
+}
+
+// CountMessageTokens returns the token count of every message for the given
+// model, e.g. to decide which messages to drop when trimming a conversation.
+// None of the providers offer per-message counts, so the counts are local
+// estimates as returned by EstimateTokens, which equals their sum. The system
+// prompt is not a message and not counted, see EstimateRequestTokens.
+func CountMessageTokens(ctx context.Context, messages []InputMessage, model Model) ([]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := ProviderForModel(model); !ok {
+		return nil, fmt.Errorf("model %s is not available", model)
+	}
+
+	estimate := tokenEstimateForModel(model)
+	counts := make([]int, len(messages))
+	for i, msg := range messages {
+		counts[i] = estimate.messageTokens(msg)
+	}
+	return counts, nil
+}
+
+// tokenEstimateForModel returns the heuristic of the model's provider,
+// falling back to OpenAI's for unknown models
+func tokenEstimateForModel(model Model) tokenEstimate {
+	provider, ok := ProviderForModel(model)
+	if !ok {
+		provider = OpenAIProvider
+	}
+	return tokenEstimates[provider]
+}
+
+// messageTokens estimates the tokens of a single message
+func (e tokenEstimate) messageTokens(msg InputMessage) int {
+	var chars float64
+	tokens := e.perMessage
+	for _, part := range msg.MultiContent {
+		switch part.Type {
+		case ContentTypeText:
+			chars += float64(utf8.RuneCountInString(part.Text))
+		case ContentTypeImage:
+			tokens += e.perImage
+		case ContentTypeImages:
+			tokens += len(part.Images) * e.perImage
+		}
+	}
+	for _, tc := range msg.ToolCalls {
+		chars += float64(utf8.RuneCountInString(tc.Function.Name) + utf8.RuneCountInString(tc.Function.Arguments))
+	}
+	for _, tr := range msg.ToolResults {
+		chars += float64(utf8.RuneCountInString(tr.Result))
+	}
+	return tokens + int(math.Ceil(chars/e.charsPerToken))
+}
+
+// EstimateRequestTokens approximates the prompt tokens of the request for the
+// given model like EstimateTokens, but including the SystemPrompt, the text of
+// SystemContent and the FewShot examples, which are sent alongside the messages.
+// Use it to check a conversation against the context window before trimming
+// its messages; the system prompt itself is never part of Messages.
+func EstimateRequestTokens(req ChatCompletionRequest, model Model) int {
+	messages := append(expandFewShot(req.FewShot), req.Messages...)
+	if systemPrompt, ok := req.systemPromptText(); ok {
+		messages = append(messages, InputMessage{
+			MultiContent: []ContentPart{{Type: ContentTypeText, Text: systemPrompt}},
+		})
+	}
+	return EstimateTokens(messages, model)
+}
@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokensKnownCounts(t *testing.T) {
+	fox := "The quick brown fox jumps over the lazy dog."
+	// token counts of the OpenAI tokenizer
+	tests := []struct {
+		text      string
+		want      int
+		tolerance float64
+	}{
+		{"hello world", 2, 1},
+		{"tiktoken is great!", 6, 1},
+		{"antidisestablishmentarianism", 6, 1},
+		{fox, 10, 1},
+		{strings.TrimSpace(strings.Repeat(fox+" ", 20)), 200, 0.15 * 200},
+	}
+	overhead := tokenEstimates[OpenAIProvider].perMessage
+	for _, tt := range tests {
+		msg := InputMessage{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: tt.text}}}
+		got := EstimateTokens([]InputMessage{msg}, ModelGPT4o) - overhead
+		if math.Abs(float64(got-tt.want)) > tt.tolerance {
+			t.Errorf("%q: estimated %d tokens, want %d ± %v", tt.text, got, tt.want, tt.tolerance)
+		}
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	text := func(s string) InputMessage {
+		return InputMessage{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: s}}}
+	}
+	long := text(strings.Repeat("token ", 100))
+
+	if got := EstimateTokens(nil, ModelGPT4o); got != 0 {
+		t.Errorf("no messages estimated at %d tokens", got)
+	}
+	// Claude's tokenizer produces more tokens for the same text
+	if openai, claude := EstimateTokens([]InputMessage{long}, ModelGPT4o), EstimateTokens([]InputMessage{long}, ModelClaude3Dot5SonnetLatest); claude <= openai {
+		t.Errorf("Claude estimate %d is not above the OpenAI estimate %d", claude, openai)
+	}
+
+	image := InputMessage{Role: RoleUser, MultiContent: []ContentPart{
+		{Type: ContentTypeImage, MediaType: "image/png", Data: "AAAA"},
+		{Type: ContentTypeImages, MediaType: "image/png", Images: []string{"AAAA", "BBBB"}},
+	}}
+	e := tokenEstimates[ClaudeProvider]
+	if got, want := EstimateTokens([]InputMessage{image}, ModelClaude3Dot5SonnetLatest), e.perMessage+3*e.perImage; got != want {
+		t.Errorf("three images estimated at %d tokens, want %d", got, want)
+	}
+
+	tools := []InputMessage{
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{Function: ToolCallFunction{Name: "weather", Arguments: strings.Repeat("x", 93)}}}},
+		{Role: RoleTool, ToolResults: []ToolResult{{ToolCallID: "call_1", Result: strings.Repeat("y", 100)}}},
+	}
+	if got, want := EstimateTokens(tools, ModelGPT4o), 2*4+50; got != want {
+		t.Errorf("tool calls and results estimated at %d tokens, want %d", got, want)
+	}
+
+	messages := []InputMessage{text("hi"), long, image}
+	counts, err := CountMessageTokens(context.Background(), messages, ModelGPT4o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := 0
+	for _, c := range counts {
+		sum += c
+	}
+	if len(counts) != len(messages) || sum != EstimateTokens(messages, ModelGPT4o) {
+		t.Errorf("message counts %v do not add up to the estimate", counts)
+	}
+	if _, err := CountMessageTokens(context.Background(), messages, "unknown-model"); err == nil {
+		t.Error("counting tokens of an unknown model is not an error")
+	}
+}
+
+func TestEstimateRequestTokens(t *testing.T) {
+	req := testRequest(ModelGPT4o, "hi")
+	base := EstimateRequestTokens(req, ModelGPT4o)
+
+	system := strings.Repeat("a", 400)
+	req.SystemPrompt = &system
+	withSystem := EstimateRequestTokens(req, ModelGPT4o)
+	if withSystem != base+4+100 {
+		t.Errorf("system prompt added %d tokens, want %d", withSystem-base, 4+100)
+	}
+
+	req.FewShot = []Example{{Input: "cat", Output: "chat"}}
+	if got := EstimateRequestTokens(req, ModelGPT4o); got != withSystem+2*(4+1) {
+		t.Errorf("few-shot example added %d tokens, want %d", got-withSystem, 2*(4+1))
+	}
+}
+
+func TestCountMessageTokens(t *testing.T) {
+	messages := []InputMessage{
+		{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "What is the capital of France?"}}},
+		{Role: RoleAssistant, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "Paris."}}},
+		{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: strings.Repeat("And of Germany? ", 20)}}},
+	}
+	for _, model := range []Model{ModelGPT4o, ModelClaude3Dot5SonnetLatest, ModelGemini2Flash} {
+		t.Run(string(model), func(t *testing.T) {
+			counts, err := CountMessageTokens(context.Background(), messages, model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(counts) != len(messages) {
+				t.Fatalf("got %d counts for %d messages", len(counts), len(messages))
+			}
+			sum := 0
+			for _, n := range counts {
+				if n <= 0 {
+					t.Errorf("got count %d in %v", n, counts)
+				}
+				sum += n
+			}
+			if total := EstimateTokens(messages, model); sum != total {
+				t.Errorf("counts %v sum to %d, want the overall estimate %d", counts, sum, total)
+			}
+			if counts[2] <= counts[1] {
+				t.Errorf("the long message counts %d tokens, the short one %d", counts[2], counts[1])
+			}
+		})
+	}
+
+	if _, err := CountMessageTokens(context.Background(), messages, "unknown"); err == nil {
+		t.Error("counting for an unknown model succeeded")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := CountMessageTokens(ctx, messages, ModelGPT4o); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v for a canceled context", err)
+	}
+}
+
+func TestEstimateRequestTokensSystemContent(t *testing.T) {
+	req := testRequest(ModelGPT4o, "hi")
+	base := EstimateRequestTokens(req, ModelGPT4o)
+
+	system := strings.Repeat("a", 400)
+	req.SystemContent = []ContentPart{{Type: ContentTypeText, Text: system, CacheControl: CacheControlEphemeral}}
+	if got := EstimateRequestTokens(req, ModelGPT4o); got != base+4+100 {
+		t.Errorf("system content added %d tokens, want %d", got-base, 4+100)
+	}
+	if len(req.Messages) != 1 || len(req.SystemContent) != 1 {
+		t.Errorf("estimating modified the request: %+v", req)
+	}
+}
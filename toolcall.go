@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// NewToolCall creates a function tool call with args encoded as JSON arguments.
+func NewToolCall(id, name string, args any) (ToolCall, error) {
+	arguments, err := json.Marshal(args)
+	if err != nil {
+		return ToolCall{}, fmt.Errorf("failed to marshal arguments for tool call %s: %w", name, err)
+	}
+	return ToolCall{
+		ID:   id,
+		Type: "function",
+		Function: ToolCallFunction{
+			Name:      name,
+			Arguments: string(arguments),
+		},
+	}, nil
+}
+
+// UnmarshalArgs decodes the JSON arguments of the tool call into v.
+// Empty arguments are treated as an empty JSON object.
+func (tc ToolCall) UnmarshalArgs(v any) error {
+	arguments := tc.Function.Arguments
+	if arguments == "" {
+		arguments = "{}"
+	}
+	if err := json.Unmarshal([]byte(arguments), v); err != nil {
+		return fmt.Errorf("failed to unmarshal arguments for tool call %s: %w", tc.Function.Name, err)
+	}
+	return nil
+}
+
+// SanitizeToolArguments normalizes tool call arguments before they are
+// dispatched: surrounding whitespace and stray control characters are removed,
+// control characters inside strings are escaped and empty arguments become an
+// empty object. It returns an error if the result is not a JSON object.
+func SanitizeToolArguments(arguments string) (string, error) {
+	var b strings.Builder
+	inString, escaped := false, false
+	for _, r := range arguments {
+		switch {
+		case inString && escaped:
+			escaped = false
+		case inString && r == '\\':
+			escaped = true
+		case r == '"':
+			inString = !inString
+		case inString && r < 0x20:
+			// raw control characters are not allowed inside JSON strings
+			fmt.Fprintf(&b, "\\u%04x", r)
+			continue
+		case !inString && unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t':
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	sanitized := strings.TrimSpace(b.String())
+	if sanitized == "" {
+		return "{}", nil
+	}
+
+	var args map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(sanitized), &args); err != nil {
+		return "", fmt.Errorf("tool arguments must be a JSON object: %w", err)
+	}
+	if args == nil {
+		return "", fmt.Errorf("tool arguments must be a JSON object, got null")
+	}
+	return sanitized, nil
+}
+
+// syntheticToolCallID returns an ID for a tool call of a provider that does
+// not assign IDs, e.g. Gemini, so that tool results can be matched to it. The
+// ID is derived from the call's position in the response, name and arguments,
+// so the same response always yields the same IDs.
+func syntheticToolCallID(index int, name, arguments string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s", index, name, arguments)))
+	return "call_" + hex.EncodeToString(sum[:12])
+}
+
+// ToolCallAccumulator assembles the fragments passed to OnToolCallDelta into
+// tool calls. Embed it in a StreamHandler to implement ToolCallDeltaHandler,
+// e.g. to show the arguments of a call while they are streamed.
+type ToolCallAccumulator struct {
+	mu    sync.Mutex
+	calls []ToolCall
+}
+
+// OnToolCallDelta adds the fragment to the tool call at its index.
+func (a *ToolCallAccumulator) OnToolCallDelta(delta ToolCallDelta) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for len(a.calls) <= delta.Index {
+		a.calls = append(a.calls, ToolCall{Type: "function"})
+	}
+	call := &a.calls[delta.Index]
+	if call.ID == "" {
+		call.ID = delta.ID
+	}
+	if call.Function.Name == "" {
+		call.Function.Name = delta.Name
+	}
+	call.Function.Arguments += delta.Arguments
+}
+
+// ToolCalls returns the tool calls assembled so far in the order of their
+// index. The arguments of a call that is still streamed are incomplete JSON.
+func (a *ToolCallAccumulator) ToolCalls() []ToolCall {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]ToolCall(nil), a.calls...)
+}
+
+// Reset discards the assembled tool calls, e.g. in OnStart.
+func (a *ToolCallAccumulator) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = nil
+}
@@ -0,0 +1,204 @@
+package llm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToolCallAccumulator(t *testing.T) {
+	tests := []struct {
+		name   string
+		deltas []ToolCallDelta
+		want   []ToolCall
+	}{
+		{
+			name: "single call in fragments",
+			deltas: []ToolCallDelta{
+				{Index: 0, ID: "call_1", Name: "get_weather"},
+				{Index: 0, Arguments: `{"city":`},
+				{Index: 0, Arguments: `"Paris"}`},
+			},
+			want: []ToolCall{
+				{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+			},
+		},
+		{
+			name: "interleaved calls",
+			deltas: []ToolCallDelta{
+				{Index: 0, ID: "call_1", Name: "a", Arguments: `{"x":`},
+				{Index: 1, ID: "call_2", Name: "b", Arguments: `{}`},
+				{Index: 0, Arguments: `1}`},
+			},
+			want: []ToolCall{
+				{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "a", Arguments: `{"x":1}`}},
+				{ID: "call_2", Type: "function", Function: ToolCallFunction{Name: "b", Arguments: `{}`}},
+			},
+		},
+		{
+			name: "repeated ID and name are kept once",
+			deltas: []ToolCallDelta{
+				{Index: 0, ID: "call_1", Name: "a", Arguments: `{`},
+				{Index: 0, ID: "call_1", Name: "a", Arguments: `}`},
+			},
+			want: []ToolCall{
+				{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "a", Arguments: `{}`}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var acc ToolCallAccumulator
+			for _, delta := range tt.deltas {
+				acc.OnToolCallDelta(delta)
+			}
+			if got := acc.ToolCalls(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ToolCalls() = %+v, want %+v", got, tt.want)
+			}
+
+			acc.Reset()
+			if got := acc.ToolCalls(); len(got) != 0 {
+				t.Errorf("ToolCalls() after Reset = %+v, want none", got)
+			}
+		})
+	}
+}
+
+func TestToolCallArgsRoundTrip(t *testing.T) {
+	type location struct {
+		City    string   `json:"city"`
+		Country string   `json:"country,omitempty"`
+		Days    int      `json:"days"`
+		Units   []string `json:"units"`
+	}
+
+	tests := []struct {
+		name string
+		args any
+		// into is a pointer to decode the arguments into, want the expected result
+		into any
+		want any
+	}{
+		{
+			name: "struct",
+			args: location{City: "Paris", Days: 3, Units: []string{"celsius"}},
+			into: &location{},
+			want: &location{City: "Paris", Days: 3, Units: []string{"celsius"}},
+		},
+		{
+			name: "map",
+			args: map[string]any{"query": "weather", "limit": 5},
+			into: &map[string]any{},
+			want: &map[string]any{"query": "weather", "limit": 5.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, err := NewToolCall("call_1", "get_weather", tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.ID != "call_1" || tc.Type != "function" || tc.Function.Name != "get_weather" {
+				t.Errorf("tool call = %+v", tc)
+			}
+			if err := tc.UnmarshalArgs(tt.into); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.into, tt.want) {
+				t.Errorf("decoded %+v, want %+v", tt.into, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolCallArgsErrors(t *testing.T) {
+	if _, err := NewToolCall("call_1", "f", map[string]any{"ch": make(chan int)}); err == nil {
+		t.Error("expected an error for arguments that cannot be encoded")
+	}
+
+	type days struct {
+		Days int `json:"days"`
+	}
+	tests := []struct {
+		name      string
+		arguments string
+		wantErr   bool
+	}{
+		{"empty arguments are an empty object", "", false},
+		{"wrong type", `{"days":"three"}`, true},
+		{"not JSON", `{"days":`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := ToolCall{Function: ToolCallFunction{Name: "f", Arguments: tt.arguments}}
+			var into days
+			if err := tc.UnmarshalArgs(&into); (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSanitizeToolArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments string
+		want      string
+		wantErr   bool
+	}{
+		{name: "valid object", arguments: `{"city":"Paris"}`, want: `{"city":"Paris"}`},
+		{name: "surrounding whitespace", arguments: " \n\t{\"city\":\"Paris\"}\n ", want: `{"city":"Paris"}`},
+		{name: "empty", arguments: "", want: "{}"},
+		{name: "only whitespace", arguments: "  \n", want: "{}"},
+		{name: "stray control characters", arguments: "\x00{\"a\":\x071}\x1b", want: `{"a":1}`},
+		{name: "raw newline in a string", arguments: "{\"text\":\"line 1\nline 2\"}", want: `{"text":"line 1\u000aline 2"}`},
+		{name: "escaped quote in a string", arguments: `{"text":"say \"hi\"\n"}`, want: `{"text":"say \"hi\"\n"}`},
+
+		{name: "truncated fragment", arguments: `{"city":"Par`, wantErr: true},
+		{name: "concatenated fragments", arguments: `{"a":1}{"b":2}`, wantErr: true},
+		{name: "array", arguments: `["Paris"]`, wantErr: true},
+		{name: "string", arguments: `"Paris"`, wantErr: true},
+		{name: "number", arguments: `42`, wantErr: true},
+		{name: "null", arguments: `null`, wantErr: true},
+		{name: "not JSON", arguments: `city=Paris`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SanitizeToolArguments(tt.arguments)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamMalformedToolArguments(t *testing.T) {
+	chunk := textChunk("", FinishReasonToolCalls)
+	chunk.Choices[0].Message.ToolCalls = []ToolCall{{
+		ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "weather", Arguments: `["Paris"]`},
+	}}
+	model := &scriptedLLM{streams: []*scriptedStream{{chunks: []ChatCompletionResponse{chunk}}}}
+	handler := &eventLog{}
+
+	err := StreamChatCompletion(context.Background(), testRequest(ModelGPT4o, "hi"), handler, model)
+	if err == nil || !strings.Contains(err.Error(), "weather") {
+		t.Fatalf("got error %v, want one naming the tool", err)
+	}
+	if handler.err == nil {
+		t.Error("the error was not passed to OnError")
+	}
+	if len(handler.events) != 0 {
+		t.Errorf("events = %q, want the tool call not to be dispatched", handler.events)
+	}
+}
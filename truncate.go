@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ToolResultTruncationMarker is appended to tool results cut by
+// TruncateToolResults. The %d verb receives the number of dropped characters.
+var ToolResultTruncationMarker = "\n[truncated %d characters]"
+
+// TruncateToolResults returns a copy of messages in which every tool result
+// longer than maxChars characters is cut to maxChars and marked with
+// ToolResultTruncationMarker. The input messages are not modified.
+func TruncateToolResults(messages []InputMessage, maxChars int) []InputMessage {
+	truncated := make([]InputMessage, len(messages))
+	for i, msg := range messages {
+		truncated[i] = msg
+		copied := false
+		for j, tr := range msg.ToolResults {
+			n := utf8.RuneCountInString(tr.Result)
+			if n <= maxChars {
+				continue
+			}
+			if !copied {
+				truncated[i].ToolResults = append([]ToolResult(nil), msg.ToolResults...)
+				copied = true
+			}
+			truncated[i].ToolResults[j].Result = truncateRunes(tr.Result, maxChars) + fmt.Sprintf(ToolResultTruncationMarker, n-maxChars)
+		}
+	}
+	return truncated
+}
+
+// truncateRunes returns the first n characters of s.
+func truncateRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// toolResultLimitLLM wraps an LLM and truncates oversized tool results.
+type toolResultLimitLLM struct {
+	llm      LLM
+	maxChars int
+}
+
+// WithToolResultLimit wraps llm so that tool results longer than maxChars
+// characters are truncated before the request is sent, keeping large tool
+// outputs from filling the context window in tool calling loops.
+func WithToolResultLimit(llm LLM, maxChars int) LLM {
+	return &toolResultLimitLLM{llm: llm, maxChars: maxChars}
+}
+
+func (t *toolResultLimitLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	req.Messages = TruncateToolResults(req.Messages, t.maxChars)
+	return t.llm.CreateChatCompletion(ctx, req)
+}
+
+func (t *toolResultLimitLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	req.Messages = TruncateToolResults(req.Messages, t.maxChars)
+	return t.llm.CreateChatCompletionStream(ctx, req)
+}
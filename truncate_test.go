@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTruncateToolResults(t *testing.T) {
+	payload := strings.Repeat("ä", 1000)
+	messages := []InputMessage{
+		{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: strings.Repeat("x", 1000)}}},
+		{Role: RoleTool, ToolResults: []ToolResult{
+			{ToolCallID: "call_1", Result: "small"},
+			{ToolCallID: "call_2", Result: payload},
+		}},
+	}
+
+	got := TruncateToolResults(messages, 10)
+
+	want := strings.Repeat("ä", 10) + "\n[truncated 990 characters]"
+	if r := got[1].ToolResults[1].Result; r != want {
+		t.Errorf("oversized result = %q, want %q", r, want)
+	}
+	if r := got[1].ToolResults[0].Result; r != "small" {
+		t.Errorf("small result = %q, want it unchanged", r)
+	}
+	if got[0].MultiContent[0].Text != messages[0].MultiContent[0].Text {
+		t.Error("content other than tool results was truncated")
+	}
+	if messages[1].ToolResults[1].Result != payload {
+		t.Error("the input messages were modified")
+	}
+
+	if r := TruncateToolResults(messages, 1000)[1].ToolResults[1].Result; r != payload {
+		t.Errorf("a result at the limit was truncated to %d characters", len([]rune(r)))
+	}
+}
+
+func TestWithToolResultLimit(t *testing.T) {
+	var sent ChatCompletionRequest
+	backend := &stubLLM{complete: func(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+		sent = req
+		return ChatCompletionResponse{}, nil
+	}}
+
+	req := testRequest(ModelGPT4o, "weather?")
+	req.Messages = append(req.Messages, InputMessage{Role: RoleTool, ToolResults: []ToolResult{
+		{ToolCallID: "call_1", Result: strings.Repeat("{}", 5000)},
+	}})
+	if _, err := WithToolResultLimit(backend, 100).CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	result := sent.Messages[1].ToolResults[0].Result
+	if !strings.HasPrefix(result, strings.Repeat("{}", 50)) || !strings.HasSuffix(result, "[truncated 9900 characters]") {
+		t.Errorf("sent result %q, want it truncated to 100 characters", result)
+	}
+}
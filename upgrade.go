@@ -0,0 +1,48 @@
+package llm
+
+import "context"
+
+// contextUpgradeLLM wraps an LLM and moves requests that do not fit the
+// context window of their model to a model with a larger window.
+type contextUpgradeLLM struct {
+	llm      LLM
+	upgrades map[Model]Model
+}
+
+// WithContextUpgrade wraps llm so that a request whose estimated size,
+// including MaxTokens, exceeds the context window of its model is sent to
+// upgrades[model] instead, following the mapping until a model fits. The
+// upgraded models must be served by llm. Requests for models without a known
+// context window or upgrade are passed through unchanged.
+func WithContextUpgrade(llm LLM, upgrades map[Model]Model) LLM {
+	return &contextUpgradeLLM{llm: llm, upgrades: upgrades}
+}
+
+func (c *contextUpgradeLLM) CreateChatCompletion(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+	req.Model = c.upgrade(req)
+	return c.llm.CreateChatCompletion(ctx, req)
+}
+
+func (c *contextUpgradeLLM) CreateChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (ChatCompletionStream, error) {
+	req.Model = c.upgrade(req)
+	return c.llm.CreateChatCompletionStream(ctx, req)
+}
+
+// upgrade returns the first model in the upgrade chain of the request's
+// model whose context window fits the request
+func (c *contextUpgradeLLM) upgrade(req ChatCompletionRequest) Model {
+	model := req.Model
+	// bound the walk so that a cyclic mapping cannot loop forever
+	for i := 0; i <= len(c.upgrades); i++ {
+		window, ok := ContextWindow(model)
+		if !ok || EstimateRequestTokens(req, model)+req.MaxTokens <= window {
+			return model
+		}
+		next, ok := c.upgrades[model]
+		if !ok {
+			return model
+		}
+		model = next
+	}
+	return model
+}
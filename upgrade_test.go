@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWithContextUpgrade(t *testing.T) {
+	// about three tokens per repetition
+	small := "hello world"
+	oversized := strings.Repeat("hello world ", 50000)
+	huge := strings.Repeat("hello world ", 80000)
+
+	tests := []struct {
+		name      string
+		model     Model
+		text      string
+		maxTokens int
+		upgrades  map[Model]Model
+		want      Model
+	}{
+		{"fits", ModelGPT4o, small, 0, map[Model]Model{ModelGPT4o: ModelO1}, ModelGPT4o},
+		{"oversized request", ModelGPT4o, oversized, 0, map[Model]Model{ModelGPT4o: ModelO1}, ModelO1},
+		{"max tokens count", ModelGPT4o, small, 130000, map[Model]Model{ModelGPT4o: ModelO1}, ModelO1},
+		{"follows the chain", ModelGPT4oMini, oversized, 0, map[Model]Model{ModelGPT4oMini: ModelGPT4o, ModelGPT4o: ModelO1}, ModelO1},
+		{"no upgrade fits", ModelGPT4o, huge, 0, map[Model]Model{ModelGPT4o: ModelO1}, ModelO1},
+		{"no upgrade", ModelGPT4o, oversized, 0, nil, ModelGPT4o},
+		// the walk is bounded by the size of the mapping
+		{"cyclic mapping", ModelGPT4o, huge, 0, map[Model]Model{ModelGPT4o: ModelO1, ModelO1: ModelGPT4o}, ModelO1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := testRequest(tt.model, tt.text)
+			req.MaxTokens = tt.maxTokens
+
+			resp, err := WithContextUpgrade(answerLLM("ok"), tt.upgrades).CreateChatCompletion(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.ID != string(tt.want) {
+				t.Errorf("request was sent to %s, want %s", resp.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithContextUpgradeStream(t *testing.T) {
+	inner := &scriptedLLM{streams: []*scriptedStream{{}}}
+	l := WithContextUpgrade(inner, map[Model]Model{ModelGPT4o: ModelO1})
+
+	stream, err := l.CreateChatCompletionStream(context.Background(), testRequest(ModelGPT4o, strings.Repeat("hello world ", 50000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	if got := inner.requests[0].Model; got != ModelO1 {
+		t.Errorf("stream was sent to %s, want %s", got, ModelO1)
+	}
+}
+
+func TestWithContextUpgradeSystemPrompt(t *testing.T) {
+	var sent ChatCompletionRequest
+	inner := &stubLLM{complete: func(ctx context.Context, req ChatCompletionRequest) (ChatCompletionResponse, error) {
+		sent = req
+		return ChatCompletionResponse{}, nil
+	}}
+
+	// only the system prompt makes the request exceed the window of gpt-4o
+	system := strings.Repeat("hello world ", 50000)
+	req := testRequest(ModelGPT4o, "hi")
+	req.SystemPrompt = &system
+	if _, err := WithContextUpgrade(inner, map[Model]Model{ModelGPT4o: ModelO1}).CreateChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Model != ModelO1 {
+		t.Errorf("request was sent to %s, want %s", sent.Model, ModelO1)
+	}
+	if sent.SystemPrompt == nil || *sent.SystemPrompt != system {
+		t.Error("the system prompt was not preserved")
+	}
+}
@@ -0,0 +1,24 @@
+package llm
+
+import "fmt"
+
+// Validate checks the conversation of the request for mistakes providers
+// reject: every tool message must carry tool results, and every tool result
+// must reference a tool call issued by an earlier assistant message.
+func (r ChatCompletionRequest) Validate() error {
+	issued := make(map[string]bool)
+	for i, msg := range r.Messages {
+		for _, tc := range msg.ToolCalls {
+			issued[tc.ID] = true
+		}
+		if msg.Role == RoleTool && len(msg.ToolResults) == 0 {
+			return fmt.Errorf("tool message %d has no tool results", i)
+		}
+		for _, tr := range msg.ToolResults {
+			if !issued[tr.ToolCallID] {
+				return fmt.Errorf("tool result in message %d references unknown tool call %q", i, tr.ToolCallID)
+			}
+		}
+	}
+	return nil
+}
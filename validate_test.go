@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateToolResults(t *testing.T) {
+	user := InputMessage{Role: RoleUser, MultiContent: []ContentPart{{Type: ContentTypeText, Text: "weather?"}}}
+	call := InputMessage{Role: RoleAssistant, ToolCalls: []ToolCall{
+		{ID: "call_1", Type: "function", Function: ToolCallFunction{Name: "weather", Arguments: `{}`}},
+		{ID: "call_2", Type: "function", Function: ToolCallFunction{Name: "time", Arguments: `{}`}},
+	}}
+	result := func(ids ...string) InputMessage {
+		msg := InputMessage{Role: RoleTool}
+		for _, id := range ids {
+			msg.ToolResults = append(msg.ToolResults, ToolResult{ToolCallID: id, Result: "ok"})
+		}
+		return msg
+	}
+
+	tests := []struct {
+		name     string
+		messages []InputMessage
+		// wantErr is a substring of the error, empty if the request is valid
+		wantErr string
+	}{
+		{"no tools", []InputMessage{user}, ""},
+		{"matched IDs", []InputMessage{user, call, result("call_1", "call_2")}, ""},
+		{"mismatched ID", []InputMessage{user, call, result("call_1", "call_3")}, `message 2 references unknown tool call "call_3"`},
+		{"result before its call", []InputMessage{user, result("call_1"), call}, `unknown tool call "call_1"`},
+		{"tool message without results", []InputMessage{user, call, result()}, "tool message 2 has no tool results"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ChatCompletionRequest{Model: ModelGPT4o, Messages: tt.messages}.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}